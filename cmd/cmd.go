@@ -22,6 +22,7 @@ const (
 	TargetFolderFlag   = "target"
 	DebugFlag          = "debug"
 	SuppressErrorsFlag = "suppress-error"
+	DryRunFlag         = "dry-run"
 )
 
 func New(fs afero.Fs) *cobra.Command {
@@ -31,12 +32,16 @@ func New(fs afero.Fs) *cobra.Command {
 		FParseErrWhitelist: cobra.FParseErrWhitelist{UnknownFlags: true},
 		Version:            version.Version,
 		Short:              fmt.Sprintf("%s version %s", version.AppName, version.Version),
+		// positional args were always ignored, the subcommands must not change that
+		Args: cobra.ArbitraryArgs,
 	}
 
 	AddFlags(cmd)
 	move.AddFlags(cmd)
 	configure.AddFlags(cmd)
 
+	cmd.AddCommand(newManifestCmd(fs))
+
 	return cmd
 }
 
@@ -44,17 +49,19 @@ var (
 	log                 logr.Logger
 	isDebug             bool
 	areErrorsSuppressed bool
+	isDryRun            bool
 
 	sourceFolder string
 	targetFolder string
 )
 
 func AddFlags(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&sourceFolder, SourceFolderFlag, "", "Base path where to copy the codemodule FROM.")
-	_ = cmd.MarkPersistentFlagRequired(SourceFolderFlag)
+	// not persistent, as the subcommands (for example manifest) don't need a target
+	cmd.Flags().StringVar(&sourceFolder, SourceFolderFlag, "", "Base path where to copy the codemodule FROM.")
+	_ = cmd.MarkFlagRequired(SourceFolderFlag)
 
-	cmd.PersistentFlags().StringVar(&targetFolder, TargetFolderFlag, "", "Base path where to copy the codemodule TO.")
-	_ = cmd.MarkPersistentFlagRequired(TargetFolderFlag)
+	cmd.Flags().StringVar(&targetFolder, TargetFolderFlag, "", "Base path where to copy the codemodule TO.")
+	_ = cmd.MarkFlagRequired(TargetFolderFlag)
 
 	cmd.PersistentFlags().BoolVar(&isDebug, DebugFlag, false, "(Optional) Enables debug logs.")
 
@@ -63,11 +70,21 @@ func AddFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().BoolVar(&areErrorsSuppressed, SuppressErrorsFlag, false, "(Optional) Always return exit code 0, even on error")
 
 	cmd.PersistentFlags().Lookup(SuppressErrorsFlag).NoOptDefVal = "true"
+
+	cmd.PersistentFlags().BoolVar(&isDryRun, DryRunFlag, false, "(Optional) Print what would be copied and configured as JSON, without writing anything.")
+
+	cmd.PersistentFlags().Lookup(DryRunFlag).NoOptDefVal = "true"
 }
 
 func run(fs afero.Fs) func(cmd *cobra.Command, _ []string) error {
-	return func(_ *cobra.Command, _ []string) error {
-		setupLogger()
+	return func(cmd *cobra.Command, _ []string) error {
+		// in case of a dry-run, the plan is printed to stdout, so the logs must not be mixed into it
+		logOutput := os.Stdout
+		if isDryRun {
+			logOutput = os.Stderr
+		}
+
+		setupLogger(logOutput)
 
 		if isDebug {
 			log.Info("debug logs enabled")
@@ -75,6 +92,17 @@ func run(fs afero.Fs) func(cmd *cobra.Command, _ []string) error {
 
 		version.Print(log)
 
+		if isDryRun {
+			err := dryRun(fs, cmd.OutOrStdout())
+			if err != nil && areErrorsSuppressed {
+				log.Error(err, "error during dry-run, the error was suppressed")
+
+				return nil
+			}
+
+			return err
+		}
+
 		aferoFs := afero.Afero{
 			Fs: fs,
 		}
@@ -122,7 +150,7 @@ func run(fs afero.Fs) func(cmd *cobra.Command, _ []string) error {
 	}
 }
 
-func setupLogger() {
+func setupLogger(logOutput zapcore.WriteSyncer) {
 	config := zap.NewProductionEncoderConfig()
 	config.EncodeTime = zapcore.ISO8601TimeEncoder
 	config.StacktraceKey = "stacktrace"
@@ -134,7 +162,7 @@ func setupLogger() {
 		logLevel = zap.DebugLevel
 	}
 
-	zapLog := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(config), os.Stdout, logLevel))
+	zapLog := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(config), logOutput, logLevel))
 
 	log = zapr.NewLogger(zapLog)
 }
@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"path/filepath"
 	"testing"
 
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/enrichment/endpoint"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/pmc"
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
 	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,10 +24,10 @@ func TestBootstrapper(t *testing.T) {
 	})
 	t.Run("should validate required flags - present flags -> no error", func(t *testing.T) {
 		fs := afero.NewMemMapFs()
-		_ = afero.WriteFile(fs, filepath.Join("./", move.InstallerVersionFilePath), []byte("123"), 0644)
+		_ = afero.WriteFile(fs, filepath.Join("/source", move.InstallerVersionFilePath), []byte("123"), 0644)
 
 		cmd := New(fs)
-		cmd.SetArgs([]string{"--source", "./", "--target", "./"})
+		cmd.SetArgs([]string{"--source", "/source", "--target", "/target"})
 
 		err := cmd.Execute()
 
@@ -56,13 +61,173 @@ func TestBootstrapper(t *testing.T) {
 
 	t.Run("should allow unknown flags -> no error", func(t *testing.T) {
 		fs := afero.NewMemMapFs()
-		_ = afero.WriteFile(fs, filepath.Join("./", move.InstallerVersionFilePath), []byte("123"), 0644)
+		_ = afero.WriteFile(fs, filepath.Join("/source", move.InstallerVersionFilePath), []byte("123"), 0644)
 
 		cmd := New(fs)
-		cmd.SetArgs([]string{"--source", "./", "--target", "./", "--unknown", "--flag", "value"})
+		cmd.SetArgs([]string{"--source", "/source", "--target", "/target", "--unknown", "--flag", "value"})
 
 		err := cmd.Execute()
 
 		require.NoError(t, err)
 	})
 }
+
+func TestDryRun(t *testing.T) {
+	source := "/source"
+	target := "/target"
+	input := "/input"
+	config := "/config"
+
+	setupFs := func(t *testing.T) afero.Afero {
+		t.Helper()
+
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile(filepath.Join(source, move.InstallerVersionFilePath), []byte("1.2.3"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, pmc.SourceRuxitAgentProcPath), []byte("[general]\nkey value\n"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, "agent/lib64/java.so"), []byte("java"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(input, pmc.InputFileName), []byte(`{"properties": [{"section": "general", "key": "tenantToken", "value": "secret-tenant-token"}]}`), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(input, endpoint.InputFileName), []byte("DT_METRICS_INGEST_URL=http://ag/api\nDT_METRICS_INGEST_API_TOKEN=secret-api-token\n"), 0644))
+
+		return fs
+	}
+
+	execute := func(t *testing.T, fs afero.Afero, args ...string) (dryRunPlan, error) {
+		t.Helper()
+
+		var out bytes.Buffer
+
+		cmd := New(fs)
+		cmd.SetOut(&out)
+		cmd.SetArgs(append([]string{"--source", source, "--target", target, "--dry-run"}, args...))
+
+		err := cmd.Execute()
+
+		// cobra prints the usage after the plan, in case of an error
+		var plan dryRunPlan
+		require.NoError(t, json.NewDecoder(&out).Decode(&plan))
+
+		return plan, err
+	}
+
+	t.Run("copy + configure -> plan printed, nothing written", func(t *testing.T) {
+		fs := setupFs(t)
+
+		plan, err := execute(t, fs,
+			"--input-directory", input,
+			"--config-directory", config,
+			"--attribute-container", `{"k8s.container.name": "app"}`,
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, move.ActionCopy, plan.Move.Action)
+		assert.Equal(t, move.SourceTypeDirectory, plan.Move.SourceType)
+		assert.Equal(t, "1.2.3", plan.Move.Version)
+		assert.Len(t, plan.Move.Files, 3)
+		require.NotNil(t, plan.Move.CurrentSymlink)
+		assert.Equal(t, filepath.Join(target, "agent/bin/current"), plan.Move.CurrentSymlink.Path)
+
+		configFiles := map[string]string{}
+		for _, file := range plan.Config {
+			configFiles[file.Path] = file.Content
+		}
+
+		ruxitAgentProc := configFiles[pmc.GetDestinationRuxitAgentProcFilePath(filepath.Join(config, "app"))]
+		assert.Contains(t, ruxitAgentProc, "key value")
+		assert.Contains(t, ruxitAgentProc, "tenantToken "+redacted)
+		assert.NotContains(t, ruxitAgentProc, "secret-tenant-token")
+
+		endpointProperties := configFiles[filepath.Join(config, "app", endpoint.ConfigBasePath, endpoint.InputFileName)]
+		assert.Contains(t, endpointProperties, "DT_METRICS_INGEST_URL=http://ag/api")
+		assert.Contains(t, endpointProperties, "DT_METRICS_INGEST_API_TOKEN="+redacted)
+
+		assert.NotContains(t, configFiles, pmc.GetSourceRuxitAgentProcFilePath(target))
+
+		for _, path := range []string{target, config} {
+			exists, err := fs.Exists(path)
+			require.NoError(t, err)
+			assert.False(t, exists, path)
+		}
+	})
+	t.Run("existing target + skip -> nothing copied", func(t *testing.T) {
+		fs := setupFs(t)
+		require.NoError(t, fs.WriteFile(filepath.Join(target, move.InstallerVersionFilePath), []byte("1.2.2"), 0644))
+
+		plan, err := execute(t, fs, "--work", "/work", "--on-existing-target", "skip")
+		require.NoError(t, err)
+
+		assert.Equal(t, move.ActionSkip, plan.Move.Action)
+		assert.Empty(t, plan.Move.Files)
+		assert.Empty(t, plan.Config)
+	})
+	t.Run("configuration would fail -> plan printed with error", func(t *testing.T) {
+		fs := setupFs(t)
+		require.NoError(t, fs.Remove(filepath.Join(source, pmc.SourceRuxitAgentProcPath)))
+
+		plan, err := execute(t, fs,
+			"--input-directory", input,
+			"--config-directory", config,
+			"--attribute-container", `{"k8s.container.name": "app"}`,
+		)
+		require.Error(t, err)
+		assert.NotEmpty(t, plan.Errors)
+		assert.Len(t, plan.Move.Files, 2)
+	})
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "DT_METRICS_INGEST_API_TOKEN="+redacted+"\nDT_METRICS_INGEST_URL=url", redact("DT_METRICS_INGEST_API_TOKEN=abc\nDT_METRICS_INGEST_URL=url"))
+	assert.Equal(t, "[general]\ntenantToken "+redacted+"\nserver url", redact("[general]\ntenantToken abc\nserver url"))
+	assert.Equal(t, `{"key":"tenantToken","value":"`+redacted+`"},{"key":"server","value":"url"}`, redact(`{"key":"tenantToken","value":"abc"},{"key":"server","value":"url"}`))
+}
+
+func TestManifest(t *testing.T) {
+	setupFs := func(t *testing.T) afero.Fs {
+		t.Helper()
+
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/source/manifest.json", []byte(`{
+			"version": "1.2.3",
+			"technologies": {"java": {"x86": [{"path": "agent/lib64/java.so"}]}}
+		}`), 0644))
+		require.NoError(t, afero.WriteFile(fs, "/source/agent/lib64/java.so", []byte("java"), 0755))
+
+		return fs
+	}
+
+	t.Run("--output=json -> summary as JSON, no target needed", func(t *testing.T) {
+		var out bytes.Buffer
+
+		cmd := New(setupFs(t))
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{ManifestUse, "--source", "/source", "--output", OutputJSON})
+
+		require.NoError(t, cmd.Execute())
+
+		var summary move.ManifestSummary
+		require.NoError(t, json.Unmarshal(out.Bytes(), &summary))
+		assert.Equal(t, "1.2.3", summary.Version)
+		assert.Equal(t, []move.TechnologySummary{{
+			Name:  "java",
+			Files: 1,
+			Size:  int64(len("java")),
+			Archs: []move.ArchSummary{{Name: "x86", Files: 1, Size: int64(len("java"))}},
+		}}, summary.Technologies)
+	})
+	t.Run("inspect alias -> table", func(t *testing.T) {
+		var out bytes.Buffer
+
+		cmd := New(setupFs(t))
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"inspect", "--source", "/source"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, out.String(), "VERSION  1.2.3")
+		assert.Contains(t, out.String(), "java        x86   1      4")
+	})
+	t.Run("unknown output -> error", func(t *testing.T) {
+		cmd := New(setupFs(t))
+		cmd.SetArgs([]string{ManifestUse, "--source", "/source", "--output", "yaml"})
+
+		require.Error(t, cmd.Execute())
+	})
+}
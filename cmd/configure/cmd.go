@@ -1,6 +1,7 @@
 package configure
 
 import (
+	"context"
 	"path/filepath"
 
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/cmd/configure/attributes/container"
@@ -11,6 +12,7 @@ import (
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/conf"
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/curl"
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/pmc"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/pmc/ruxit"
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/preload"
 	"github.com/go-logr/logr"
 	"github.com/spf13/afero"
@@ -23,14 +25,19 @@ const (
 	InstallPathFlag  = "install-path"
 	IsFullstackFlag  = "fullstack"
 	TenantFlag       = "tenant"
+
+	PmcFromAPIFlag = "processmoduleconfig-from-api"
+	PmcCacheFlag   = "processmoduleconfig-cache"
 )
 
 var (
-	inputDir    string
-	configDir   string
-	installPath string
-	isFullstack bool
-	tenant      string
+	inputDir     string
+	configDir    string
+	installPath  string
+	isFullstack  bool
+	tenant       string
+	isPmcFromAPI bool
+	pmcCache     string
 
 	podAttributes       []string
 	containerAttributes []string
@@ -48,7 +55,16 @@ func AddFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().BoolVar(&isFullstack, IsFullstackFlag, false, "(Optional) Configure the CodeModule to be fullstack.")
 	cmd.PersistentFlags().StringVar(&tenant, TenantFlag, "", "The name of the tenant that the CodeModule will communicate with. Mandatory in case of --fullstack.")
 
+	cmd.PersistentFlags().BoolVar(&isPmcFromAPI, PmcFromAPIFlag, false, "(Optional) Fetch the ruxitagentproc config from the Dynatrace API (using the api-url and token of the input directory), instead of the ruxitagentproc.json input file. The input file is used as a fallback.")
+	cmd.PersistentFlags().StringVar(&pmcCache, PmcCacheFlag, "", "(Optional) Path of the file where the ruxitagentproc config fetched from the API is cached. Defaults to "+pmc.CacheFileName+" next to the target.")
+
 	cmd.PersistentFlags().Lookup(IsFullstackFlag).NoOptDefVal = "true"
+	cmd.PersistentFlags().Lookup(PmcFromAPIFlag).NoOptDefVal = "true"
+}
+
+// InputDir returns the base path of the configuration files, so other steps (for example downloading the CodeModule) can use them as well.
+func InputDir() string {
+	return inputDir
 }
 
 func SetupOneAgent(log logr.Logger, fs afero.Afero, targetDir string) error {
@@ -75,11 +91,21 @@ func SetupOneAgent(log logr.Logger, fs afero.Afero, targetDir string) error {
 		return err
 	}
 
+	procConf, isProcConfPresent, err := getProcConf(log, fs, targetDir)
+	if err != nil {
+		log.Info("failed to get the ruxitagentproc config", "input-directory", inputDir)
+
+		return err
+	}
+
 	for _, containerAttr := range containerAttrs {
 		containerConfigDir := filepath.Join(configDir, containerAttr.ContainerName)
 		log.Info("starting to configure the container", "path", containerConfigDir)
 
-		err = pmc.Configure(log, fs, inputDir, targetDir, containerConfigDir, installPath)
+		if isProcConfPresent {
+			err = pmc.ConfigureWithConf(log, fs, procConf, targetDir, containerConfigDir, installPath)
+		}
+
 		if err != nil {
 			log.Info("failed to configure the ruxitagentproc.conf", "config-directory", containerConfigDir)
 
@@ -106,6 +132,20 @@ func SetupOneAgent(log logr.Logger, fs afero.Afero, targetDir string) error {
 	return nil
 }
 
+// getProcConf gets the ruxitagentproc config only once, as it is the same for every container.
+func getProcConf(log logr.Logger, fs afero.Afero, targetDir string) (ruxit.ProcConf, bool, error) {
+	if !isPmcFromAPI {
+		return pmc.FromInputFile(log, fs, inputDir)
+	}
+
+	cachePath := pmcCache
+	if cachePath == "" {
+		cachePath = filepath.Join(filepath.Dir(filepath.Clean(targetDir)), pmc.CacheFileName)
+	}
+
+	return pmc.FromAPIWithFallback(context.Background(), log, fs, inputDir, cachePath)
+}
+
 func configureFromInputDir(log logr.Logger, fs afero.Afero, containerConfigDir, inputDir string) error {
 	err := curl.Configure(log, fs, inputDir, containerConfigDir)
 	if err != nil {
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/cmd/configure"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/cmd/move"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/pmc"
+	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const redacted = "<redacted>"
+
+var (
+	// secretLineRegexp matches lines like `DT_METRICS_INGEST_API_TOKEN=<token>` or `tenantToken <token>`.
+	secretLineRegexp = regexp.MustCompile(`(?im)^(\s*[^\s=:"]*(?:token|secret|password|passwd)[^\s=:"]*\s*[=:\s]\s*)\S.*$`)
+	// secretJSONRegexp matches properties of a (cached) ruxitagentproc config, like `"key":"tenantToken","value":"<token>"`.
+	secretJSONRegexp = regexp.MustCompile(`(?i)("key"\s*:\s*"[^"]*(?:token|secret|password|passwd)[^"]*"\s*,\s*"value"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+type dryRunPlan struct {
+	Move   impl.Plan           `json:"move"`
+	Config []plannedConfigFile `json:"config"`
+	Errors []string            `json:"errors,omitempty"`
+}
+
+// plannedConfigFile is a file that the configuration (or enrichment) would write, secrets in the content are redacted.
+type plannedConfigFile struct {
+	Path    string `json:"path"`
+	Mode    string `json:"mode"`
+	Content string `json:"content"`
+}
+
+// dryRun prints the plan of what the bootstrapper would do as JSON, without writing anything.
+// The configuration is done on an in-memory layer on top of the (read-only) filesystem, so the written files can be collected.
+func dryRun(fs afero.Fs, out io.Writer) error {
+	aferoFs := afero.Afero{Fs: fs}
+
+	movePlan, err := move.Plan(log, aferoFs, sourceFolder, targetFolder)
+	if err != nil {
+		return err
+	}
+
+	plan := dryRunPlan{Move: movePlan}
+
+	layer := afero.NewMemMapFs()
+	dryFs := afero.Afero{Fs: afero.NewCopyOnWriteFs(afero.NewReadOnlyFs(fs), layer)}
+
+	seededPath, err := seedRuxitAgentProc(dryFs, movePlan)
+	if err != nil {
+		// only a problem in case the configuration needs it, which then fails on its own
+		log.Info("failed to seed the ruxitagentproc.conf of the source", "error", err.Error())
+	}
+
+	err = configure.SetupOneAgent(log, dryFs, targetFolder)
+	if err != nil {
+		plan.Errors = append(plan.Errors, errors.WithMessage(err, "oneagent setup").Error())
+	} else {
+		err = configure.EnrichWithMetadata(log, dryFs)
+		if err != nil {
+			plan.Errors = append(plan.Errors, errors.WithMessage(err, "enrichment").Error())
+		}
+	}
+
+	plan.Config, err = plannedConfigFiles(layer, seededPath)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	err = encoder.Encode(plan)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(plan.Errors) > 0 {
+		return errors.Errorf("the run would fail: %v", plan.Errors)
+	}
+
+	return nil
+}
+
+// seedRuxitAgentProc puts the ruxitagentproc.conf of the source into the target (of the in-memory layer), as the configuration merges it into its own.
+// Returns the seeded path, so it is not part of the plan.
+func seedRuxitAgentProc(dryFs afero.Afero, movePlan impl.Plan) (string, error) {
+	if movePlan.Action == impl.ActionSkip || movePlan.Download != nil {
+		// the target is kept as is or the source is not available without downloading it
+		return "", nil
+	}
+
+	content, err := move.SourceFile(log, dryFs, sourceFolder, pmc.SourceRuxitAgentProcPath)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to read the ruxitagentproc.conf of the source")
+	}
+
+	seededPath := pmc.GetSourceRuxitAgentProcFilePath(targetFolder)
+
+	err = dryFs.MkdirAll(filepath.Dir(seededPath), os.ModePerm)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return seededPath, errors.WithStack(dryFs.WriteFile(seededPath, content, 0644))
+}
+
+// plannedConfigFiles returns every file of the in-memory layer, besides the seeded one.
+// Relative paths are not found when walking from "/" (and vice versa), so both are walked.
+func plannedConfigFiles(layer afero.Fs, seededPath string) ([]plannedConfigFile, error) {
+	files := map[string]plannedConfigFile{}
+
+	for _, root := range []string{string(filepath.Separator), "."} {
+		err := afero.Walk(layer, root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil //nolint:nilerr // the paths of the other root can not be found
+			}
+
+			if info.IsDir() || filepath.Clean(path) == filepath.Clean(seededPath) {
+				return nil
+			}
+
+			content, err := afero.ReadFile(layer, path)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			files[path] = plannedConfigFile{
+				Path:    path,
+				Mode:    fmt.Sprintf("%04o", info.Mode().Perm()),
+				Content: redact(string(content)),
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	planned := make([]plannedConfigFile, 0, len(files))
+	for _, file := range files {
+		planned = append(planned, file)
+	}
+
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].Path < planned[j].Path
+	})
+
+	return planned, nil
+}
+
+// redact replaces the values of everything that looks like a secret (token, secret, password).
+func redact(content string) string {
+	content = secretLineRegexp.ReplaceAllString(content, "${1}"+redacted)
+
+	return secretJSONRegexp.ReplaceAllString(content, `${1}"`+redacted+`"`)
+}
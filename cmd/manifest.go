@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/cmd/move"
+	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ManifestUse = "manifest"
+	OutputFlag  = "output"
+
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+var manifestOutput string
+
+// newManifestCmd creates the subcommand that lists what the manifest.json of the source contains, to find the valid values of --technology and --arch.
+func newManifestCmd(fs afero.Fs) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     ManifestUse,
+		Aliases: []string{"inspect"},
+		Short:   "Lists the technologies, architectures, file counts and sizes of the manifest.json of the source.",
+		Args:    cobra.NoArgs,
+		RunE:    runManifest(fs),
+	}
+
+	cmd.Flags().StringVar(&sourceFolder, SourceFolderFlag, "", "Base path (or archive, or image) of the codemodule to inspect.")
+	_ = cmd.MarkFlagRequired(SourceFolderFlag)
+
+	cmd.Flags().StringVar(&manifestOutput, OutputFlag, OutputTable, "(Optional) Output format, either "+OutputTable+" or "+OutputJSON+".")
+
+	return cmd
+}
+
+func runManifest(fs afero.Fs) func(cmd *cobra.Command, _ []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		if manifestOutput != OutputTable && manifestOutput != OutputJSON {
+			return errors.Errorf("unknown output format %q, must be one of: %s, %s", manifestOutput, OutputTable, OutputJSON)
+		}
+
+		// the summary is printed to stdout, so the logs must not be mixed into it
+		setupLogger(os.Stderr)
+
+		summary, err := move.Manifest(log, afero.Afero{Fs: fs}, sourceFolder)
+		if err != nil {
+			return err
+		}
+
+		if manifestOutput == OutputJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+
+			return errors.WithStack(encoder.Encode(summary))
+		}
+
+		return printManifestTable(cmd.OutOrStdout(), summary)
+	}
+}
+
+func printManifestTable(out io.Writer, summary impl.ManifestSummary) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(writer, "VERSION\t%s\n", summary.Version)
+	_, _ = fmt.Fprintf(writer, "ARCHS\t%s\n\n", strings.Join(summary.Archs, ","))
+	_, _ = fmt.Fprintln(writer, "TECHNOLOGY\tARCH\tFILES\tSIZE")
+
+	for _, tech := range summary.Technologies {
+		for _, arch := range tech.Archs {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%d\t%d\n", tech.Name, arch.Name, arch.Files, arch.Size)
+		}
+
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%d\t%d\n", tech.Name, impl.AllArchs, tech.Files, tech.Size)
+	}
+
+	return errors.WithStack(writer.Flush())
+}
@@ -1,45 +1,486 @@
 package move
 
 import (
+	"strings"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/download"
 	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/version"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
 const (
-	WorkFolderFlag = "work"
-	TechnologyFlag = "technology"
+	WorkFolderFlag       = "work"
+	TechnologyFlag       = "technology"
+	TechnologyStrictFlag = "technology-strict"
+	ArchFlag             = "arch"
+	ExcludeFlag          = "exclude"
+	IncludeFlag          = "include"
+
+	CopyConcurrencyFlag    = "copy-concurrency"
+	CopyModeFlag           = "copy-mode"
+	CopyBytesPerSecondFlag = "copy-bytes-per-second"
+	IOPriorityFlag         = "io-priority"
+
+	IncrementalFlag         = "incremental"
+	IncrementalChecksumFlag = "incremental-checksum"
+
+	PreserveMetadataFlag = "preserve-metadata"
+
+	LockTimeoutFlag      = "lock-timeout"
+	OnExistingTargetFlag = "on-existing-target"
+	VerifyCompleteFlag   = "verify-complete"
+
+	KeepVersionsFlag = "keep-versions"
+	VersionAliasFlag = "version-alias"
+
+	StoreFlag = "store"
+
+	ImagePlatformFlag = "image-platform"
+	ImagePathFlag     = "image-path"
+
+	defaultLockTimeout = 5 * time.Minute
 )
 
 var (
-	workFolder string
-	technology string
+	workFolder         string
+	technology         string
+	isTechnologyStrict bool
+	arch               string
+	excludePatterns    []string
+	includePatterns    []string
+
+	copyConcurrency    int
+	copyMode           string
+	copyBytesPerSecond int64
+	ioPriority         string
+
+	isIncremental         bool
+	isIncrementalChecksum bool
+
+	isPreserveMetadata bool
+
+	lockTimeout      time.Duration
+	onExistingTarget string
+	isVerifyComplete bool
+
+	keepVersions   int
+	versionAliases []string
+
+	storeFolder string
+
+	imagePlatform string
+	imagePath     string
 )
 
 func AddFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVar(&workFolder, WorkFolderFlag, "", "(Optional) Base path for a tmp folder, this is where the command will do its work, to make sure the operations are atomic. It must be on the same disk as the target folder.")
 
-	cmd.PersistentFlags().StringVar(&technology, TechnologyFlag, "", "(Optional) Comma-separated list of technologies to filter files.")
+	cmd.PersistentFlags().StringVar(&technology, TechnologyFlag, "", "(Optional) Comma-separated list of technologies to filter files. Use \"all\" (or \"*\") to select every technology and \"!<technology>\" to exclude one, for example \"all,!php\".")
+
+	cmd.PersistentFlags().BoolVar(&isTechnologyStrict, TechnologyStrictFlag, false, "(Optional) Fail in case a technology is not present in the manifest.json, instead of ignoring it.")
+
+	cmd.PersistentFlags().Lookup(TechnologyStrictFlag).NoOptDefVal = "true"
+
+	cmd.PersistentFlags().StringVar(&arch, ArchFlag, impl.DefaultArch(), "(Optional) Comma-separated list of architectures/flavors (for example x86, arm, musl) to copy when filtering by technology. Use \"all\" to copy every architecture.")
+
+	cmd.PersistentFlags().StringArrayVar(&excludePatterns, ExcludeFlag, nil, "(Optional) Glob pattern (doublestar syntax, relative to the source) of files and dirs to leave out of the copy, for example \"**/*.log\". Can be repeated, excluding wins over including.")
+
+	cmd.PersistentFlags().StringArrayVar(&includePatterns, IncludeFlag, nil, "(Optional) Glob pattern (doublestar syntax, relative to the source) of files to copy, for example \"agent/bin/**\". Can be repeated, in case it is not set every file is copied.")
+
+	cmd.PersistentFlags().IntVar(&copyConcurrency, CopyConcurrencyFlag, 1, "(Optional) Maximum number of files copied in parallel.")
+
+	cmd.PersistentFlags().StringVar(&copyMode, CopyModeFlag, fsutils.CopyModeCopy, "(Optional) How the files are copied, one of: copy, hardlink, reflink, auto. The auto mode tries reflink, then hardlink, then falls back to copy for each file.")
+
+	cmd.PersistentFlags().Int64Var(&copyBytesPerSecond, CopyBytesPerSecondFlag, 0, "(Optional) Maximum number of bytes per second read from the source, shared by every file copied in parallel. 0 means unlimited.")
+
+	cmd.PersistentFlags().StringVar(&ioPriority, IOPriorityFlag, "", "(Optional) I/O priority of the bootstrapper (Linux only), one of: idle, best-effort[:<0-7>]. Defaults to the priority inherited from the parent process.")
+
+	cmd.PersistentFlags().BoolVar(&isIncremental, IncrementalFlag, false, "(Optional) Only copy the files that are missing or changed (size, mode, modification time) in an already existing target.")
+
+	cmd.PersistentFlags().Lookup(IncrementalFlag).NoOptDefVal = "true"
+
+	cmd.PersistentFlags().BoolVar(&isIncrementalChecksum, IncrementalChecksumFlag, false, "(Optional) In case of --incremental, also compare the md5 checksum from the manifest.json of the already present files.")
+
+	cmd.PersistentFlags().Lookup(IncrementalChecksumFlag).NoOptDefVal = "true"
+
+	cmd.PersistentFlags().BoolVar(&isPreserveMetadata, PreserveMetadataFlag, false, "(Optional) Keep symlinks as symlinks and preserve the modification time and ownership (if privileged) of the copied files and dirs.")
+
+	cmd.PersistentFlags().Lookup(PreserveMetadataFlag).NoOptDefVal = "true"
+
+	cmd.PersistentFlags().DurationVar(&lockTimeout, LockTimeoutFlag, defaultLockTimeout, "(Optional) How long to wait for another bootstrapper that is copying (or downloading) into the same target or work folder, before failing.")
+
+	cmd.PersistentFlags().StringVar(&onExistingTarget, OnExistingTargetFlag, string(impl.ExistingTargetFail), "(Optional) What to do in case the target already exists and is not empty when using a work folder, one of: fail, skip, replace, verify-then-skip.")
+
+	cmd.PersistentFlags().BoolVar(&isVerifyComplete, VerifyCompleteFlag, false, "(Optional) Verify the content (tree hash) of an already complete target, before skipping the copy. Otherwise its files are only compared with its complete marker by size and modification time.")
+
+	cmd.PersistentFlags().Lookup(VerifyCompleteFlag).NoOptDefVal = "true"
+
+	cmd.PersistentFlags().IntVar(&keepVersions, KeepVersionsFlag, 0, "(Optional) Number of versions to keep next to the target (ordered by their installer.version), older ones are removed after copying. 0 keeps every version.")
+
+	cmd.PersistentFlags().StringArrayVar(&versionAliases, VersionAliasFlag, nil, "(Optional) Additional symlink to the version, next to agent/bin/current, for example \"{major}.{minor}\". A \"../\" prefix puts it next to the target instead, for example \"../latest\". Can be repeated.")
+
+	cmd.PersistentFlags().StringVar(&storeFolder, StoreFlag, "", "(Optional) Base path of a content-addressable store shared by the versions next to the target. Each file is stored once (by its sha256 checksum) and hardlinked into the target. It must be on the same disk as the target folder.")
+
+	cmd.PersistentFlags().StringVar(&imagePlatform, ImagePlatformFlag, "", "(Optional) In case the source is an image, the platform (os/architecture[/variant], for example linux/arm64) of the image to copy from. Defaults to the platform the bootstrapper runs on.")
+
+	cmd.PersistentFlags().StringVar(&imagePath, ImagePathFlag, impl.DefaultImagePath, "(Optional) In case the source is an image, the path of the CodeModule inside the image.")
+
+	addDownloadFlags(cmd)
 }
 
 // Execute moves the contents of a folder to another via copying.
 // This could be a simple os.Rename, however that will not work if the source and target are on different disk.
 func Execute(log logr.Logger, fs afero.Afero, from, to string) error {
-	copyFunc := impl.SimpleCopy
+	_, err := fsutils.GetFileCopyFunc(copyMode)
+	if err != nil {
+		return err
+	}
+
+	policy, err := impl.ParseExistingTargetPolicy(onExistingTarget)
+	if err != nil {
+		return err
+	}
+
+	err = validateStore()
+	if err != nil {
+		return err
+	}
+
+	err = validateCopyBytesPerSecond()
+	if err != nil {
+		return err
+	}
+
+	err = setIOPriority(log)
+	if err != nil {
+		return err
+	}
+
+	pathFilter, err := newPathFilter(from)
+	if err != nil {
+		return err
+	}
+
+	aliases, err := parseVersionAliases()
+	if err != nil {
+		return err
+	}
+
+	copyOptions := fsutils.CopyOptions{
+		Mode:                copyMode,
+		Concurrency:         copyConcurrency,
+		PathFilter:          pathFilter,
+		BytesPerSecond:      copyBytesPerSecond,
+		Incremental:         isIncremental,
+		IncrementalChecksum: isIncrementalChecksum,
+		PreserveMetadata:    isPreserveMetadata,
+		Store:               storeFolder,
+	}
+
+	filter := impl.Filter{Technology: technology, Arch: arch, IsStrict: isTechnologyStrict, Paths: pathFilter}
+	image := impl.ImageOptions{Platform: imagePlatform, Path: imagePath}
+
+	isAtomic, err := isWorkFolderUsed(log, fs, to)
+	if err != nil {
+		return err
+	}
 
-	if technology != "" {
-		copyFunc = impl.CopyByTechnologyWrapper(technology)
+	// only the work folder is resumable, as an interrupted copy into it is never seen by anyone
+	copyOptions.Resumable = isAtomic
+
+	isCopied := false
+
+	copyFunc, completeVerifyFunc, err := newCopyFunc(fs, from, &isCopied, isAtomic, policy, filter, image, copyOptions)
+	if err != nil {
+		return err
 	}
 
-	if workFolder != "" {
-		copyFunc = impl.Atomic(workFolder, copyFunc)
+	// the target is only complete once the symlinks and the marker are written, so this has to happen while still holding the lock
+	finishFunc := func(log logr.Logger, fs afero.Afero, _, to string) error {
+		err := createSymlinks(log, fs, to, aliases, isCopied)
+		if err != nil || !isCopied {
+			return err
+		}
+
+		return impl.WriteCompleteMarker(log, fs, to, completeMarker(filter))
 	}
 
-	err := copyFunc(log, fs, from, to)
+	err = impl.Locked(workFolder, lockTimeout, completeVerifyFunc, copyFunc, finishFunc)(log, fs, from, to)
 	if err != nil {
 		return err
 	}
 
-	return impl.CreateCurrentSymlink(log, fs, to)
+	err = impl.RemoveOldVersions(log, fs, to, keepVersions)
+	if err != nil {
+		return err
+	}
+
+	if storeFolder != "" {
+		return fsutils.PruneStore(log, fs, storeFolder)
+	}
+
+	return nil
+}
+
+// isWorkFolderUsed checks if the copy is done in the --work folder (and then moved to the target), which is not the case for an incremental copy into an already populated target.
+func isWorkFolderUsed(log logr.Logger, fs afero.Afero, to string) (bool, error) {
+	if workFolder == "" {
+		return false, nil
+	}
+
+	isPopulated, err := impl.IsPopulated(fs, to)
+	if err != nil {
+		return false, err
+	}
+
+	if isIncremental && isPopulated {
+		// the atomic copy would start from scratch, which would defeat the purpose of the incremental copy
+		log.Info("target already exists, copying incrementally into it without using the work folder", "target", to, "work", workFolder)
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// newCopyFunc returns how the CodeModule is copied from the source (including the checks before copying), and how an already complete target is verified against the source (see impl.Locked).
+// In case the source is a URL, the CodeModule is only downloaded once it has to be copied, an already complete target is verified against the --download-version instead.
+func newCopyFunc(fs afero.Afero, from string, isCopied *bool, isAtomic bool, policy impl.ExistingTargetPolicy, filter impl.Filter, image impl.ImageOptions, copyOptions fsutils.CopyOptions) (impl.CopyFunc, impl.VerifyFunc, error) {
+	isDownload := download.IsURL(from)
+	// everything that is built here reads the source through the same cache, so an archive is only indexed once
+	cache := impl.NewSourceCache()
+
+	// the downloaded CodeModule is a zip
+	sourceType := impl.SourceTypeArchive
+	if !isDownload {
+		sourceType = impl.SourceType(fs, from, cache)
+	}
+
+	copyFunc, verifyFunc, err := sourceFuncs(sourceType, filter, image, copyOptions, cache)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// right around the source copy, so it is only checked in case something is copied, into the folder that is actually written
+	copyFunc = freeSpaceCheckWrapper(sourceType, filter, image, cache, copyFunc)
+	copyFunc = impl.UnmarkedCopyWrapper(isCopied, copyFunc)
+
+	if isAtomic {
+		copyFunc = impl.AtomicWithPolicy(workFolder, policy, verifyFunc, copyFunc)
+	}
+
+	if isDownload {
+		return downloadCopyWrapper(filter, copyFunc), impl.CompleteVersionVerifyWrapper(completeMarker(filter), downloadVersion, isVerifyComplete), nil
+	}
+
+	return copyFunc, impl.CompleteVerifyWrapper(completeMarker(filter), image, isVerifyComplete, cache), nil
+}
+
+// parseVersionAliases parses the --version-alias flags.
+func parseVersionAliases() ([]impl.VersionAlias, error) {
+	aliases := make([]impl.VersionAlias, 0, len(versionAliases))
+
+	for _, versionAlias := range versionAliases {
+		alias, err := impl.ParseVersionAlias(versionAlias)
+		if err != nil {
+			return nil, err
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
+
+// createSymlinks creates the "current" symlink and the version aliases in the target.
+// In case the copy was skipped, the symlinks could still change the target, its complete marker is refreshed in that case (but only if it was valid before).
+func createSymlinks(log logr.Logger, fs afero.Afero, to string, aliases []impl.VersionAlias, isCopied bool) error {
+	var (
+		marker     impl.CompleteMarker
+		isVerified bool
+	)
+
+	if !isCopied {
+		var err error
+
+		marker, err = impl.VerifyCompleteMarker(log, fs, to)
+		isVerified = err == nil
+	}
+
+	err := impl.CreateCurrentSymlink(log, fs, to)
+	if err != nil {
+		return err
+	}
+
+	err = impl.CreateVersionAliases(log, fs, to, aliases, lockTimeout)
+	if err != nil {
+		return err
+	}
+
+	if !isVerified {
+		return nil
+	}
+
+	_, err = impl.VerifyCompleteMarker(log, fs, to)
+	if err == nil {
+		return nil
+	}
+
+	log.Info("the symlinks changed the target, refreshing its complete marker", "target", to)
+
+	return impl.WriteCompleteMarker(log, fs, to, marker)
+}
+
+// setIOPriority sets the --io-priority of the bootstrapper, on platforms that don't support it the priority is only ignored, as it is not needed for the copy to work.
+func setIOPriority(log logr.Logger) error {
+	err := fsutils.SetIOPriority(ioPriority)
+	if errors.Is(err, fsutils.ErrIOPriorityNotSupported) {
+		log.Info("ignoring the I/O priority, as it is not supported", "priority", ioPriority, "reason", err.Error())
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if ioPriority != "" {
+		log.Info("set the I/O priority", "priority", ioPriority)
+	}
+
+	return nil
+}
+
+// newPathFilter parses the --exclude and --include patterns, they are only supported in case the source is a folder, as archives and images are extracted entry by entry.
+func newPathFilter(from string) (*fsutils.PathFilter, error) {
+	pathFilter, err := fsutils.NewPathFilter(includePatterns, excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pathFilter.IsEmpty() && download.IsURL(from) {
+		return nil, errors.Errorf("--%s and --%s are not supported for download sources", ExcludeFlag, IncludeFlag)
+	}
+
+	return pathFilter, nil
+}
+
+// validateStore makes sure that the store is not combined with options that would change the (shared) stored files.
+// validateCopyBytesPerSecond makes sure the limit is not silently ignored, as linked files are not read (and the auto mode only falls back to copying per file).
+func validateCopyBytesPerSecond() error {
+	if copyBytesPerSecond > 0 && copyMode != "" && copyMode != fsutils.CopyModeCopy {
+		return errors.Errorf("--%s can't be combined with --%s=%s", CopyBytesPerSecondFlag, CopyModeFlag, copyMode)
+	}
+
+	return nil
+}
+
+func validateStore() error {
+	if storeFolder == "" {
+		return nil
+	}
+
+	switch {
+	case isIncremental:
+		return errors.Errorf("--%s can't be combined with --%s", StoreFlag, IncrementalFlag)
+	case isPreserveMetadata:
+		return errors.Errorf("--%s can't be combined with --%s", StoreFlag, PreserveMetadataFlag)
+	case copyMode != "" && copyMode != fsutils.CopyModeCopy:
+		return errors.Errorf("--%s can't be combined with --%s=%s", StoreFlag, CopyModeFlag, copyMode)
+	}
+
+	return nil
+}
+
+// completeMarker describes what was copied according to the Filter, the files and digest are computed when the marker is written.
+func completeMarker(filter impl.Filter) impl.CompleteMarker {
+	marker := impl.CompleteMarker{Version: version.Version, Arch: filter.Arch}
+
+	if filter.Technology != "" {
+		marker.Technologies = strings.Split(filter.Technology, ",")
+	}
+
+	return marker
+}
+
+// sourceFuncs returns how the CodeModule is copied from the source (of the impl.SourceType), and how an existing target is verified against the source.
+func sourceFuncs(sourceType string, filter impl.Filter, image impl.ImageOptions, copyOptions fsutils.CopyOptions, cache *impl.SourceCache) (impl.CopyFunc, impl.VerifyFunc, error) {
+	switch {
+	case sourceType == impl.SourceTypeImage:
+		if copyMode == fsutils.CopyModeHardlink || copyMode == fsutils.CopyModeReflink {
+			return nil, nil, errors.Errorf("copy mode %s is not supported for image sources", copyMode)
+		} else if !filter.Paths.IsEmpty() {
+			return nil, nil, errors.Errorf("--%s and --%s are not supported for image sources", ExcludeFlag, IncludeFlag)
+		} else if copyOptions.Incremental {
+			// the extraction neither skips the unchanged files, nor removes the ones that are no longer part of the source
+			return nil, nil, errors.Errorf("--%s is not supported for image sources", IncrementalFlag)
+		}
+
+		return impl.ImageCopyWrapper(image, filter, copyOptions, cache), impl.VerifyImageTargetWrapper(image, filter, cache), nil
+	case sourceType == impl.SourceTypeArchive:
+		if copyMode == fsutils.CopyModeHardlink || copyMode == fsutils.CopyModeReflink {
+			return nil, nil, errors.Errorf("copy mode %s is not supported for archive sources", copyMode)
+		} else if !filter.Paths.IsEmpty() {
+			return nil, nil, errors.Errorf("--%s and --%s are not supported for archive sources", ExcludeFlag, IncludeFlag)
+		} else if copyOptions.Incremental {
+			// the extraction neither skips the unchanged files, nor removes the ones that are no longer part of the source
+			return nil, nil, errors.Errorf("--%s is not supported for archive sources", IncrementalFlag)
+		}
+
+		return impl.ArchiveCopyWrapper(filter, copyOptions, cache), impl.VerifyTargetWrapper(filter, cache), nil
+	case technology != "":
+		return impl.CopyByTechnologyWrapper(filter, copyOptions), impl.VerifyTargetWrapper(filter, cache), nil
+	default:
+		return impl.SimpleCopyWrapper(copyOptions), impl.VerifyTargetWrapper(filter, cache), nil
+	}
+}
+
+// freeSpaceCheckWrapper checks the free space of the folder that is actually written (the work folder, in case of an atomic copy), right before copying.
+// So it only runs in case a copy happens, and the folder already contains the files that are left over from an interrupted copy.
+// With a store, the content is written into the store instead, the folder only gets hardlinks.
+func freeSpaceCheckWrapper(sourceType string, filter impl.Filter, image impl.ImageOptions, cache *impl.SourceCache, copyFunc impl.CopyFunc) impl.CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		// linking doesn't need (significant) space
+		if copyMode == fsutils.CopyModeHardlink || copyMode == fsutils.CopyModeReflink {
+			return copyFunc(log, fs, from, to)
+		}
+
+		required, err := requiredSpace(log, fs, from, to, sourceType, filter, image, cache)
+		if err != nil {
+			return err
+		}
+
+		needs := []impl.SpaceNeed{{Dir: to, Bytes: required}}
+		if storeFolder != "" {
+			needs = []impl.SpaceNeed{{Dir: to}, {Dir: storeFolder, Bytes: required}}
+		}
+
+		err = impl.CheckSpaceNeeds(log, fs, needs)
+		if err != nil {
+			return err
+		}
+
+		return copyFunc(log, fs, from, to)
+	}
+}
+
+// requiredSpace is the size of the files that are copied into the `to` folder, for a folder source the files that are already present in it are considered, as they are overwritten.
+func requiredSpace(log logr.Logger, fs afero.Afero, from, to, sourceType string, filter impl.Filter, image impl.ImageOptions, cache *impl.SourceCache) (uint64, error) {
+	switch sourceType {
+	case impl.SourceTypeImage:
+		return impl.ImageSize(log, fs, from, image, filter, cache)
+	case impl.SourceTypeArchive:
+		return impl.ArchiveSize(log, fs, from, filter, cache)
+	}
+
+	files, err := impl.ListFiles(log, fs, from, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return impl.RequiredSpace(fs, from, files, to)
 }
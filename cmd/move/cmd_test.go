@@ -1,10 +1,15 @@
 package move
 
 import (
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
 	"github.com/go-logr/zapr"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -27,6 +32,7 @@ func TestExecute(t *testing.T) {
 		_ = afero.WriteFile(fs, sourceDir+"/file1.txt", []byte("file1 content"), 0644)
 		_ = afero.WriteFile(fs, sourceDir+"/file2.txt", []byte("file2 content"), 0644)
 		_ = afero.WriteFile(fs, filepath.Join(sourceDir, impl.InstallerVersionFilePath), []byte("123"), 0644)
+		_ = fs.MkdirAll(filepath.Join(sourceDir, "agent/bin/123"), 0755)
 
 		workFolder = workDir
 
@@ -59,6 +65,11 @@ func TestExecute(t *testing.T) {
 		exists, err = afero.DirExists(fs, workDir)
 		require.NoError(t, err)
 		assert.False(t, exists)
+
+		// Check the target is marked as complete
+		marker, err := impl.VerifyCompleteMarker(testLog, fs, targetDir)
+		require.NoError(t, err)
+		assert.Equal(t, 3, marker.Files)
 	})
 	t.Run("execute with technology param", func(t *testing.T) {
 		fs := afero.Afero{Fs: afero.NewMemMapFs()}
@@ -68,8 +79,9 @@ func TestExecute(t *testing.T) {
 			"technologies": {
 				"java": {
 					"x86": [
-						{"path": "fileA1.txt", "version": "1.0", "md5": "abc123"},
-						{"path": "agent/installer.version", "version": "1.0", "md5": "abc123"}
+						{"path": "fileA1.txt", "version": "1.0", "md5": "7eed2cd60d1e86fe16b0f7ab89c89d0e"},
+						{"path": "agent/installer.version", "version": "1.0", "md5": "202cb962ac59075b964b07152d234b70"},
+						{"path": "agent/bin/123/liboneagent.so", "version": "1.0"}
 					]
 				},
 				"python": {
@@ -86,8 +98,10 @@ func TestExecute(t *testing.T) {
 		_ = afero.WriteFile(fs, sourceDir+"/fileA1.txt", []byte("fileA1 content"), 0644)
 		_ = afero.WriteFile(fs, sourceDir+"/fileA2.txt", []byte("fileA2 content"), 0644)
 		_ = afero.WriteFile(fs, filepath.Join(sourceDir, impl.InstallerVersionFilePath), []byte("123"), 0644)
+		_ = afero.WriteFile(fs, filepath.Join(sourceDir, "agent/bin/123/liboneagent.so"), []byte("lib"), 0644)
 
 		technology = technologyList
+		arch = "x86"
 
 		err := Execute(testLog, fs, sourceDir, targetDir)
 		require.NoError(t, err)
@@ -114,4 +128,292 @@ func TestExecute(t *testing.T) {
 		require.Error(t, err)
 		assert.Empty(t, string(content))
 	})
+	t.Run("incremental copy into existing target", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		workDir := "/work"
+		_ = fs.MkdirAll(sourceDir, 0755)
+		_ = afero.WriteFile(fs, sourceDir+"/file1.txt", []byte("file1 content"), 0644)
+		_ = afero.WriteFile(fs, filepath.Join(sourceDir, impl.InstallerVersionFilePath), []byte("123"), 0644)
+		_ = fs.MkdirAll(filepath.Join(sourceDir, "agent/bin/123"), 0755)
+		_ = afero.WriteFile(fs, targetDir+"/file1.txt", []byte("old content"), 0644)
+
+		technology = ""
+		workFolder = workDir
+		isIncremental = true
+
+		t.Cleanup(func() {
+			isIncremental = false
+		})
+
+		err := Execute(testLog, fs, sourceDir, targetDir)
+		require.NoError(t, err)
+
+		content, err := afero.ReadFile(fs, targetDir+"/file1.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "file1 content", string(content))
+
+		exists, err := afero.DirExists(fs, workDir)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("store -> versions share the stored files", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		dir := t.TempDir()
+
+		technology = ""
+		workFolder = filepath.Join(dir, "work")
+		storeFolder = filepath.Join(dir, "store")
+
+		t.Cleanup(func() {
+			storeFolder = ""
+		})
+
+		for _, version := range []string{"1.2.3", "1.2.4"} {
+			source := filepath.Join(dir, "source", version)
+			require.NoError(t, fs.MkdirAll(filepath.Join(source, "agent/lib64"), 0755))
+			require.NoError(t, fs.MkdirAll(filepath.Join(source, "agent/bin", version), 0755))
+			require.NoError(t, fs.WriteFile(filepath.Join(source, impl.InstallerVersionFilePath), []byte(version), 0644))
+			require.NoError(t, fs.WriteFile(filepath.Join(source, "agent/lib64/java.so"), []byte("java"), 0755))
+
+			err := Execute(testLog, fs, source, filepath.Join(dir, "bin", version))
+			require.NoError(t, err)
+		}
+
+		first, err := os.Stat(filepath.Join(dir, "bin", "1.2.3", "agent/lib64/java.so"))
+		require.NoError(t, err)
+
+		second, err := os.Stat(filepath.Join(dir, "bin", "1.2.4", "agent/lib64/java.so"))
+		require.NoError(t, err)
+
+		assert.True(t, os.SameFile(first, second))
+	})
+	t.Run("version aliases on skipped target -> aliases created, marker still valid", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		dir := t.TempDir()
+		source := filepath.Join(dir, "source")
+		target := filepath.Join(dir, "bin", "1.2.3")
+
+		technology = ""
+		workFolder = filepath.Join(dir, "work")
+
+		require.NoError(t, fs.MkdirAll(filepath.Join(source, "agent/bin/1.2.3"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, impl.InstallerVersionFilePath), []byte("1.2.3\n"), 0644))
+
+		require.NoError(t, Execute(testLog, fs, source, target))
+
+		previousOnExistingTarget := onExistingTarget
+		onExistingTarget = string(impl.ExistingTargetSkip)
+		versionAliases = []string{"{major}.{minor}", "../latest"}
+
+		t.Cleanup(func() {
+			onExistingTarget = previousOnExistingTarget
+			versionAliases = nil
+		})
+
+		require.NoError(t, Execute(testLog, fs, source, target))
+
+		linkTarget, err := os.Readlink(filepath.Join(target, "agent/bin/1.2"))
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3", linkTarget)
+
+		linkTarget, err = os.Readlink(filepath.Join(dir, "bin", "latest"))
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3", linkTarget)
+
+		_, err = impl.VerifyCompleteMarker(testLog, fs, target)
+		require.NoError(t, err)
+	})
+	t.Run("concurrent bootstrappers -> second one waits and skips", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		dir := t.TempDir()
+		source := filepath.Join(dir, "source")
+		target := filepath.Join(dir, "bin", "1.2.3")
+
+		technology = ""
+		workFolder = filepath.Join(dir, "work")
+		versionAliases = []string{"../latest"}
+		lockTimeout = time.Minute
+
+		t.Cleanup(func() {
+			versionAliases = nil
+			lockTimeout = 0
+		})
+
+		require.NoError(t, fs.MkdirAll(filepath.Join(source, "agent/bin/1.2.3"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, impl.InstallerVersionFilePath), []byte("1.2.3\n"), 0644))
+
+		errs := make(chan error, 2)
+
+		for range 2 {
+			go func() {
+				errs <- Execute(testLog, fs, source, target)
+			}()
+		}
+
+		// with the default --on-existing-target=fail, the second one would fail in case it saw the target before it is complete
+		require.NoError(t, <-errs)
+		require.NoError(t, <-errs)
+
+		_, err := impl.VerifyCompleteMarker(testLog, fs, target)
+		require.NoError(t, err)
+	})
+	t.Run("download source with complete target -> not downloaded", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		dir := t.TempDir()
+		source := filepath.Join(dir, "source")
+		target := filepath.Join(dir, "bin", "1.2.3")
+
+		technology = ""
+		workFolder = filepath.Join(dir, "work")
+		downloadVersion = "1.2.3"
+
+		t.Cleanup(func() {
+			downloadVersion = ""
+		})
+
+		require.NoError(t, fs.MkdirAll(filepath.Join(source, "agent/bin/1.2.3"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, impl.InstallerVersionFilePath), []byte("1.2.3\n"), 0644))
+		require.NoError(t, Execute(testLog, fs, source, target))
+
+		// the API is not reachable (and there is no token), so downloading would fail
+		require.NoError(t, Execute(testLog, fs, "https://127.0.0.1:1/api", target))
+
+		downloadVersion = "1.2.4"
+
+		require.Error(t, Execute(testLog, fs, "https://127.0.0.1:1/api", target))
+	})
+	t.Run("invalid version alias -> error", func(t *testing.T) {
+		versionAliases = []string{"{build}"}
+
+		t.Cleanup(func() {
+			versionAliases = nil
+		})
+
+		err := Execute(testLog, afero.Afero{Fs: afero.NewMemMapFs()}, sourceDir, targetDir)
+		require.ErrorContains(t, err, "unknown placeholder")
+	})
+	t.Run("store + incremental -> error", func(t *testing.T) {
+		storeFolder = "/store"
+		isIncremental = true
+
+		t.Cleanup(func() {
+			storeFolder = ""
+			isIncremental = false
+		})
+
+		err := Execute(testLog, afero.Afero{Fs: afero.NewMemMapFs()}, sourceDir, targetDir)
+		require.Error(t, err)
+	})
+	t.Run("copy bytes per second + link mode -> error", func(t *testing.T) {
+		copyBytesPerSecond = 1024
+		copyMode = fsutils.CopyModeHardlink
+
+		t.Cleanup(func() {
+			copyBytesPerSecond = 0
+			copyMode = ""
+		})
+
+		err := Execute(testLog, afero.Afero{Fs: afero.NewMemMapFs()}, sourceDir, targetDir)
+		require.ErrorContains(t, err, CopyBytesPerSecondFlag)
+	})
+	t.Run("exclude -> excluded files not copied", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		_ = afero.WriteFile(fs, sourceDir+"/file1.txt", []byte("file1 content"), 0644)
+		_ = afero.WriteFile(fs, sourceDir+"/docs/readme.md", []byte("readme"), 0644)
+		_ = afero.WriteFile(fs, filepath.Join(sourceDir, impl.InstallerVersionFilePath), []byte("123"), 0644)
+		_ = fs.MkdirAll(filepath.Join(sourceDir, "agent/bin/123"), 0755)
+
+		excludePatterns = []string{"docs"}
+
+		t.Cleanup(func() {
+			excludePatterns = nil
+		})
+
+		err := Execute(testLog, fs, sourceDir, targetDir)
+		require.NoError(t, err)
+
+		exists, err := afero.Exists(fs, targetDir+"/file1.txt")
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = afero.DirExists(fs, targetDir+"/docs")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		// the verification of the target only considers the files that are not excluded
+		_, err = impl.VerifyCompleteMarker(testLog, fs, targetDir)
+		require.NoError(t, err)
+		require.NoError(t, impl.VerifyTargetWrapper(impl.Filter{Paths: mustPathFilter(t, nil, excludePatterns)}, nil)(testLog, fs, sourceDir, targetDir))
+	})
+	t.Run("exclude with archive source -> error", func(t *testing.T) {
+		excludePatterns = []string{"docs"}
+
+		t.Cleanup(func() {
+			excludePatterns = nil
+		})
+
+		err := Execute(testLog, afero.Afero{Fs: afero.NewMemMapFs()}, "/source.zip", targetDir)
+		require.ErrorContains(t, err, "not supported for archive sources")
+	})
+	t.Run("incremental with archive source -> error", func(t *testing.T) {
+		isIncremental = true
+
+		t.Cleanup(func() {
+			isIncremental = false
+		})
+
+		err := Execute(testLog, afero.Afero{Fs: afero.NewMemMapFs()}, "/source.zip", targetDir)
+		require.ErrorContains(t, err, "--incremental is not supported for archive sources")
+	})
+	t.Run("invalid io-priority -> error", func(t *testing.T) {
+		ioPriority = "realtime"
+
+		t.Cleanup(func() {
+			ioPriority = ""
+		})
+
+		err := Execute(testLog, afero.Afero{Fs: afero.NewMemMapFs()}, sourceDir, targetDir)
+		require.Error(t, err)
+	})
+}
+
+func TestDownloadArch(t *testing.T) {
+	arch, err := downloadArch(impl.DefaultArch())
+	require.NoError(t, err)
+	assert.Equal(t, impl.CPUArch(), arch)
+
+	archs := strings.Split(impl.DefaultArch(), ",")
+	slices.Reverse(archs)
+
+	arch, err = downloadArch(strings.Join(archs, " , "))
+	require.NoError(t, err)
+	assert.Equal(t, impl.CPUArch(), arch)
+
+	arch, err = downloadArch(" musl ")
+	require.NoError(t, err)
+	assert.Equal(t, "musl", arch)
+
+	_, err = downloadArch("x86,arm")
+	require.Error(t, err)
+
+	_, err = downloadArch(impl.AllArchs)
+	require.Error(t, err)
+}
+
+func TestDownloadTechnologies(t *testing.T) {
+	assert.Equal(t, []string{"java", "php"}, downloadTechnologies("java, php"))
+	assert.Nil(t, downloadTechnologies(""))
+	assert.Nil(t, downloadTechnologies("java,all"))
+	assert.Nil(t, downloadTechnologies("*"))
+	assert.Nil(t, downloadTechnologies("!php"))
+}
+
+func mustPathFilter(t *testing.T, include, exclude []string) *fsutils.PathFilter {
+	t.Helper()
+
+	filter, err := fsutils.NewPathFilter(include, exclude)
+	require.NoError(t, err)
+
+	return filter
 }
@@ -0,0 +1,177 @@
+package move
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/cmd/configure"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/api"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/download"
+	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+const (
+	DownloadFlavorFlag    = "download-flavor"
+	DownloadVersionFlag   = "download-version"
+	DownloadSHA256Flag    = "download-sha256"
+	DownloadRetriesFlag   = "download-retries"
+	DownloadTimeoutFlag   = "download-timeout"
+	DownloadProxyFlag     = "download-proxy"
+	DownloadTokenFileFlag = "download-token-file"
+	DownloadDirFlag       = "download-directory"
+)
+
+var (
+	downloadFlavor    string
+	downloadVersion   string
+	downloadSHA256    string
+	downloadRetries   int
+	downloadTimeout   time.Duration
+	downloadProxy     string
+	downloadTokenFile string
+	downloadDir       string
+)
+
+func addDownloadFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&downloadFlavor, DownloadFlavorFlag, download.DefaultFlavor, "(Optional) In case the source is a Dynatrace API URL, the flavor of the CodeModule to download (for example default, musl).")
+
+	cmd.PersistentFlags().StringVar(&downloadVersion, DownloadVersionFlag, "", "(Optional) In case the source is a Dynatrace API URL, the version of the CodeModule to download. Defaults to the latest version.")
+
+	cmd.PersistentFlags().StringVar(&downloadSHA256, DownloadSHA256Flag, "", "(Optional) In case the source is a Dynatrace API URL, the expected sha256 checksum of the downloaded zip.")
+
+	cmd.PersistentFlags().IntVar(&downloadRetries, DownloadRetriesFlag, api.DefaultRetries, "(Optional) In case the source is a Dynatrace API URL, how often a failed download is retried.")
+
+	cmd.PersistentFlags().DurationVar(&downloadTimeout, DownloadTimeoutFlag, api.DefaultTimeout, "(Optional) In case the source is a Dynatrace API URL, how long a single download attempt may take, including downloading the zip. 0 means no limit.")
+
+	cmd.PersistentFlags().StringVar(&downloadProxy, DownloadProxyFlag, "", "(Optional) In case the source is a Dynatrace API URL, the proxy to use for the download. Defaults to the proxy of the environment (HTTPS_PROXY).")
+
+	cmd.PersistentFlags().StringVar(&downloadTokenFile, DownloadTokenFileFlag, api.TokenInputFile, "(Optional) In case the source is a Dynatrace API URL, the name of the file in the --input-directory that contains the token.")
+
+	cmd.PersistentFlags().StringVar(&downloadDir, DownloadDirFlag, "", "(Optional) In case the source is a Dynatrace API URL, where to put the downloaded zip until it is extracted. Defaults to the tmp dir of the system.")
+}
+
+// downloadCodeModule downloads the CodeModule zip from the Dynatrace API, so it can be used as the source.
+// Returns the path of the downloaded zip, the caller is responsible for removing it.
+func downloadCodeModule(log logr.Logger, fs afero.Afero, apiURL string, filter impl.Filter) (string, error) {
+	opts, err := api.OptionsFromInputDir(fs, configure.InputDir(), downloadTokenFile, apiURL)
+	if err != nil {
+		return "", err
+	}
+
+	opts.Proxy = downloadProxy
+	opts.Retries = downloadRetries
+	opts.Timeout = downloadTimeout
+
+	client, err := api.NewClient(opts)
+	if err != nil {
+		return "", err
+	}
+
+	arch, err := downloadArch(filter.Arch)
+	if err != nil {
+		return "", err
+	}
+
+	zipDir := downloadDir
+	if zipDir == "" {
+		zipDir = os.TempDir()
+	}
+
+	err = fs.MkdirAll(zipDir, os.ModePerm)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	zipFile, err := fs.TempFile(zipDir, "codemodule-*.zip")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	_ = zipFile.Close()
+
+	downloadOpts := download.Options{
+		Flavor:       downloadFlavor,
+		Arch:         arch,
+		Version:      downloadVersion,
+		SHA256:       downloadSHA256,
+		Technologies: downloadTechnologies(filter.Technology),
+	}
+
+	err = download.CodeModule(context.Background(), log, fs, client, downloadOpts, zipFile.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return zipFile.Name(), nil
+}
+
+// downloadCopyWrapper downloads the CodeModule zip from the Dynatrace API (the `from` URL) and then copies from it, the zip is removed once the copy is done.
+func downloadCopyWrapper(filter impl.Filter, copyFunc impl.CopyFunc) impl.CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		zipPath, err := downloadCodeModule(log, fs, from, filter)
+		if err != nil {
+			return err
+		}
+
+		defer func() { _ = fs.Remove(zipPath) }()
+
+		return copyFunc(log, fs, zipPath, to)
+	}
+}
+
+// downloadArch returns the single architecture to download, the libc flavors of the default --arch (in any order) are selected by the --download-flavor instead.
+func downloadArch(arch string) (string, error) {
+	archs := splitArch(arch)
+	if slices.Equal(archs, splitArch(impl.DefaultArch())) {
+		return impl.CPUArch(), nil
+	}
+
+	if len(archs) != 1 || archs[0] == impl.AllArchs {
+		return "", errors.Errorf("downloading the CodeModule needs a single --%s, got: %s", ArchFlag, arch)
+	}
+
+	return archs[0], nil
+}
+
+// splitArch returns the (trimmed and sorted) architectures of the comma-separated list.
+func splitArch(arch string) []string {
+	var archs []string
+
+	for _, a := range strings.Split(arch, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			archs = append(archs, a)
+		}
+	}
+
+	slices.Sort(archs)
+
+	return slices.Compact(archs)
+}
+
+// downloadTechnologies returns the technologies to include in the download, the exact selection (for example exclusions) is applied when extracting the zip.
+func downloadTechnologies(technology string) []string {
+	var technologies []string
+
+	for _, tech := range strings.Split(technology, ",") {
+		tech = strings.TrimSpace(tech)
+
+		switch {
+		case tech == "":
+			continue
+		case tech == impl.AllTechnologies || tech == "*" || strings.HasPrefix(tech, "!"):
+			return nil
+		default:
+			technologies = append(technologies, tech)
+		}
+	}
+
+	return technologies
+}
@@ -0,0 +1,18 @@
+package move
+
+import (
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/download"
+	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// Manifest summarizes the manifest.json of the source, an image is resolved the same way as by Execute.
+func Manifest(log logr.Logger, fs afero.Afero, from string) (impl.ManifestSummary, error) {
+	if download.IsURL(from) {
+		return impl.ManifestSummary{}, errors.Errorf("the manifest.json of %s can't be inspected without downloading the CodeModule", from)
+	}
+
+	return impl.SummarizeManifest(log, fs, from, impl.ImageOptions{Platform: imagePlatform, Path: imagePath})
+}
@@ -0,0 +1,161 @@
+package move
+
+import (
+	"strings"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/download"
+	impl "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/move"
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/go-logr/logr"
+	"github.com/spf13/afero"
+)
+
+// Plan computes what Execute would do, without writing anything.
+// In case the source is a URL, nothing is downloaded, so the files are not known.
+func Plan(log logr.Logger, fs afero.Afero, from, to string) (impl.Plan, error) {
+	policy, err := impl.ParseExistingTargetPolicy(onExistingTarget)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	pathFilter, err := newPathFilter(from)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	aliases, err := parseVersionAliases()
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	filter := impl.Filter{Technology: technology, Arch: arch, IsStrict: isTechnologyStrict, Paths: pathFilter}
+	image := impl.ImageOptions{Platform: imagePlatform, Path: imagePath}
+	cache := impl.NewSourceCache()
+
+	plan := impl.Plan{
+		Source: from,
+		Target: to,
+		Work:   workFolder,
+		Files:  []impl.PlannedFile{},
+	}
+
+	var verifyFunc, completeVerifyFunc impl.VerifyFunc
+
+	if download.IsURL(from) {
+		plannedArch, err := downloadArch(arch)
+		if err != nil {
+			return impl.Plan{}, err
+		}
+
+		plan.SourceType = impl.SourceTypeDownload
+		plan.Version = downloadVersion
+		plan.Download = &impl.PlannedDownload{
+			URL:          from,
+			Flavor:       downloadFlavor,
+			Arch:         plannedArch,
+			Version:      downloadVersion,
+			Technologies: downloadTechnologies(technology),
+		}
+
+		completeVerifyFunc = impl.CompleteVersionVerifyWrapper(completeMarker(filter), downloadVersion, isVerifyComplete)
+	} else {
+		plan.SourceType = impl.SourceType(fs, from, cache)
+
+		_, verifyFunc, err = sourceFuncs(plan.SourceType, filter, image, fsutils.CopyOptions{Mode: copyMode, PathFilter: pathFilter}, cache)
+		if err != nil {
+			return impl.Plan{}, err
+		}
+
+		completeVerifyFunc = impl.CompleteVerifyWrapper(completeMarker(filter), image, isVerifyComplete, cache)
+	}
+
+	plan.Action, err = planAction(log, fs, from, to, policy, completeVerifyFunc, verifyFunc)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	if plan.Action == impl.ActionSkip || plan.Action == impl.ActionFail || plan.Download != nil {
+		return plan, nil
+	}
+
+	plan.Files, err = impl.PlanFiles(log, fs, from, image, filter, cache)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	version, err := impl.ReadSourceFile(log, fs, from, impl.InstallerVersionFilePath, image, cache)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	plan.Version = strings.TrimSpace(string(version))
+
+	isTargetReused := plan.Action == impl.ActionCopy || plan.Action == impl.ActionIncremental
+
+	symlink, isPlanned, err := impl.PlanCurrentSymlink(fs, to, plan.Version, plan.Files, isTargetReused)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	if isPlanned {
+		plan.CurrentSymlink = &symlink
+	}
+
+	plan.VersionAliases, err = impl.PlanVersionAliases(fs, to, plan.Version, aliases, isTargetReused)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	plan.RemovedVersions, err = impl.PlanOldVersions(log, fs, to, plan.Version, keepVersions)
+	if err != nil {
+		return impl.Plan{}, err
+	}
+
+	return plan, nil
+}
+
+// planAction mirrors how Execute handles an already existing target, the verify funcs are nil in case the source can not be verified (yet).
+func planAction(log logr.Logger, fs afero.Afero, from, to string, policy impl.ExistingTargetPolicy, completeVerifyFunc, verifyFunc impl.VerifyFunc) (string, error) {
+	isPopulated, err := impl.IsPopulated(fs, to)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case !isPopulated:
+		return impl.ActionCopy, nil
+	case completeVerifyFunc != nil && impl.IsComplete(log, fs, from, to, completeVerifyFunc):
+		return impl.ActionSkip, nil
+	case isIncremental:
+		return impl.ActionIncremental, nil
+	case workFolder == "":
+		return impl.ActionCopy, nil
+	}
+
+	switch policy {
+	case impl.ExistingTargetSkip:
+		return impl.ActionSkip, nil
+	case impl.ExistingTargetReplace:
+		return impl.ActionReplace, nil
+	case impl.ExistingTargetVerifyThenSkip:
+		if verifyFunc == nil {
+			return string(policy), nil
+		}
+
+		err := verifyFunc(log, fs, from, to)
+		if err != nil {
+			log.Info("existing target does not match the source", "target", to, "reason", err.Error())
+
+			return impl.ActionReplace, nil
+		}
+
+		return impl.ActionSkip, nil
+	default:
+		return impl.ActionFail, nil
+	}
+}
+
+// SourceFile returns the content of a single file (relative to the CodeModule) of the source, without copying it.
+func SourceFile(log logr.Logger, fs afero.Afero, from, path string) ([]byte, error) {
+	return impl.ReadSourceFile(log, fs, from, path, impl.ImageOptions{Platform: imagePlatform, Path: imagePath}, nil)
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/ca"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	// TokenInputFile is the default name of the file (in the input directory) that contains the token for the Dynatrace API.
+	TokenInputFile = "token"
+	// URLInputFile is the name of the file (in the input directory) that contains the URL of the Dynatrace API.
+	URLInputFile = "api-url"
+
+	DefaultRetries = 3
+	DefaultBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+
+	// DefaultTimeout limits a single attempt, it has to be long enough to download a full CodeModule zip.
+	DefaultTimeout = 10 * time.Minute
+
+	// responseHeaderTimeout and idleConnTimeout make sure an unresponsive server is detected, even without a Timeout.
+	responseHeaderTimeout = time.Minute
+	idleConnTimeout       = 90 * time.Second
+
+	// maxErrorBodySize limits how much of the response body is put into the error message, in case of an unexpected status.
+	maxErrorBodySize = 512
+)
+
+// Options configures the Client for the Dynatrace API (of an environment or an ActiveGate).
+type Options struct {
+	// URL is the base URL of the API, for example https://<environment-id>.live.dynatrace.com/api.
+	URL   string
+	Token string
+	// Proxy is the URL of the proxy to use, empty means the proxy is taken from the environment (HTTPS_PROXY, NO_PROXY, ...).
+	Proxy string
+	// TrustedCAs are PEM encoded certificates, that are trusted in addition to the ones of the system.
+	TrustedCAs string
+	// Retries is how often a failed request is retried, the wait between the attempts starts at Backoff and is doubled every time.
+	Retries int
+	Backoff time.Duration
+	// Timeout limits every attempt, including reading the body of the response, 0 means no limit.
+	Timeout time.Duration
+}
+
+type Client struct {
+	httpClient *http.Client
+	opts       Options
+}
+
+// OptionsFromInputDir reads the token (from the tokenFile) and the trusted.pem (if present) from the input directory.
+func OptionsFromInputDir(fs afero.Afero, inputDir, tokenFile, apiURL string) (Options, error) {
+	token, err := fs.ReadFile(filepath.Join(inputDir, tokenFile))
+	if err != nil {
+		return Options{}, errors.WithMessage(err, "failed to read the token for the Dynatrace API")
+	}
+
+	trustedCAs, err := ca.GetFromFs(fs, inputDir, ca.TrustedCertsInputFile)
+	if err != nil && !os.IsNotExist(err) {
+		return Options{}, errors.WithStack(err)
+	}
+
+	return Options{
+		URL:        apiURL,
+		Token:      strings.TrimSpace(string(token)),
+		TrustedCAs: trustedCAs,
+		Retries:    DefaultRetries,
+		Backoff:    DefaultBackoff,
+		Timeout:    DefaultTimeout,
+	}, nil
+}
+
+// URLFromInputDir reads the URL of the Dynatrace API from the URLInputFile in the input directory.
+func URLFromInputDir(fs afero.Afero, inputDir string) (string, error) {
+	apiURL, err := fs.ReadFile(filepath.Join(inputDir, URLInputFile))
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to read the URL of the Dynatrace API")
+	}
+
+	return strings.TrimSpace(string(apiURL)), nil
+}
+
+func NewClient(opts Options) (*Client, error) {
+	if opts.URL == "" {
+		return nil, errors.New("no URL provided for the Dynatrace API")
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if defaultTransport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = defaultTransport.Clone()
+	}
+
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	transport.IdleConnTimeout = idleConnTimeout
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid proxy URL")
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.TrustedCAs != "" {
+		certPool, err := x509.SystemCertPool()
+		if err != nil {
+			certPool = x509.NewCertPool()
+		}
+
+		if !certPool.AppendCertsFromPEM([]byte(opts.TrustedCAs)) {
+			return nil, errors.New("failed to parse the trusted certificates")
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Client{
+		httpClient: &http.Client{Transport: transport, Timeout: opts.Timeout},
+		opts:       opts,
+	}, nil
+}
+
+// Get requests the path (relative to the URL of the API) and passes the successful response to the handle func.
+// In case the request fails, the response has a 429 or 5xx status, or the handle func fails (for example the download was interrupted), the request is retried.
+// A 304 (not modified) response is passed to the handle func as well, as it is the answer to a conditional request (for example with a known revision).
+func (c *Client) Get(ctx context.Context, log logr.Logger, path string, query url.Values, handle func(response *http.Response) error) error {
+	requestURL := strings.TrimSuffix(c.opts.URL, "/") + "/" + strings.TrimPrefix(path, "/")
+	if len(query) > 0 {
+		requestURL += "?" + query.Encode()
+	}
+
+	backoff := c.opts.Backoff
+
+	var err error
+
+	for attempt := 0; attempt <= c.opts.Retries; attempt++ {
+		if attempt > 0 {
+			log.Info("retrying request to the Dynatrace API", "path", path, "attempt", attempt, "backoff", backoff, "reason", err.Error())
+
+			select {
+			case <-ctx.Done():
+				return errors.WithStack(ctx.Err())
+			case <-time.After(backoff):
+			}
+
+			backoff = min(2*backoff, maxBackoff)
+		}
+
+		var isRetryable bool
+
+		isRetryable, err = c.get(ctx, requestURL, handle)
+		if err == nil || !isRetryable {
+			return err
+		}
+	}
+
+	return errors.WithMessagef(err, "request to the Dynatrace API failed after %d attempts", c.opts.Retries+1)
+}
+
+func (c *Client) get(ctx context.Context, requestURL string, handle func(response *http.Response) error) (bool, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	request.Header.Set("Authorization", "Api-Token "+c.opts.Token)
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return true, errors.WithStack(err)
+	}
+
+	defer func() { _ = response.Body.Close() }()
+
+	isSuccess := response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices
+	if !isSuccess && response.StatusCode != http.StatusNotModified {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		isRetryable := response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError
+
+		return isRetryable, errors.Errorf("unexpected status %d from %s: %s", response.StatusCode, request.URL.Path, strings.TrimSpace(string(body)))
+	}
+
+	err = handle(response)
+	if err != nil {
+		return true, err
+	}
+
+	return false, nil
+}
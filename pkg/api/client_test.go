@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var testLog = zapr.NewLogger(zap.NewExample())
+
+func readBody(content *string) func(response *http.Response) error {
+	return func(response *http.Response) error {
+		body, err := io.ReadAll(response.Body)
+		*content = string(body)
+
+		return errors.WithStack(err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	t.Run("success -> token and query sent", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Api-Token secret", r.Header.Get("Authorization"))
+			assert.Equal(t, "/api/v1/test", r.URL.Path)
+			assert.Equal(t, "value", r.URL.Query().Get("key"))
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		client, err := NewClient(Options{URL: server.URL + "/api/", Token: "secret"})
+		require.NoError(t, err)
+
+		var content string
+		err = client.Get(context.Background(), testLog, "/v1/test", url.Values{"key": {"value"}}, readBody(&content))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", content)
+	})
+	t.Run("5xx and 429 -> retried", func(t *testing.T) {
+		var requests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			switch requests.Add(1) {
+			case 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			case 2:
+				w.WriteHeader(http.StatusTooManyRequests)
+			default:
+				_, _ = w.Write([]byte("ok"))
+			}
+		}))
+		defer server.Close()
+
+		client, err := NewClient(Options{URL: server.URL, Retries: 2, Backoff: time.Millisecond})
+		require.NoError(t, err)
+
+		var content string
+		err = client.Get(context.Background(), testLog, "/", nil, readBody(&content))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", content)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+	t.Run("retries exhausted -> error", func(t *testing.T) {
+		var requests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client, err := NewClient(Options{URL: server.URL, Retries: 1, Backoff: time.Millisecond})
+		require.NoError(t, err)
+
+		err = client.Get(context.Background(), testLog, "/", nil, readBody(new(string)))
+		require.ErrorContains(t, err, "failed after 2 attempts")
+		assert.Equal(t, int32(2), requests.Load())
+	})
+	t.Run("4xx -> not retried", func(t *testing.T) {
+		var requests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			requests.Add(1)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		client, err := NewClient(Options{URL: server.URL, Retries: 3, Backoff: time.Millisecond})
+		require.NoError(t, err)
+
+		err = client.Get(context.Background(), testLog, "/", nil, readBody(new(string)))
+		require.ErrorContains(t, err, "unexpected status 401")
+		require.ErrorContains(t, err, "invalid token")
+		assert.Equal(t, int32(1), requests.Load())
+	})
+	t.Run("stalled response -> timed out and retried", func(t *testing.T) {
+		var requests atomic.Int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) == 1 {
+				// the response never arrives
+				<-r.Context().Done()
+
+				return
+			}
+
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		client, err := NewClient(Options{URL: server.URL, Retries: 1, Backoff: time.Millisecond, Timeout: 100 * time.Millisecond})
+		require.NoError(t, err)
+
+		var content string
+		err = client.Get(context.Background(), testLog, "/", nil, readBody(&content))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", content)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+	t.Run("tls + trusted CA -> success", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		client, err := NewClient(Options{URL: server.URL})
+		require.NoError(t, err)
+
+		err = client.Get(context.Background(), testLog, "/", nil, readBody(new(string)))
+		require.Error(t, err)
+
+		trustedCAs := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		client, err = NewClient(Options{URL: server.URL, TrustedCAs: string(trustedCAs)})
+		require.NoError(t, err)
+
+		var content string
+		err = client.Get(context.Background(), testLog, "/", nil, readBody(&content))
+		require.NoError(t, err)
+		assert.Equal(t, "ok", content)
+	})
+}
+
+func TestOptionsFromInputDir(t *testing.T) {
+	inputDir := "/input"
+
+	t.Run("token and trusted.pem -> read", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile("/input/token", []byte("secret\n"), 0600))
+		require.NoError(t, fs.WriteFile("/input/trusted.pem", []byte("certs"), 0600))
+
+		opts, err := OptionsFromInputDir(fs, inputDir, TokenInputFile, "https://test/api")
+		require.NoError(t, err)
+		assert.Equal(t, "secret", opts.Token)
+		assert.Equal(t, "certs", opts.TrustedCAs)
+		assert.Equal(t, "https://test/api", opts.URL)
+		assert.Equal(t, DefaultRetries, opts.Retries)
+		assert.Equal(t, DefaultTimeout, opts.Timeout)
+	})
+	t.Run("no trusted.pem -> no error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile("/input/token", []byte("secret"), 0600))
+
+		opts, err := OptionsFromInputDir(fs, inputDir, TokenInputFile, "https://test/api")
+		require.NoError(t, err)
+		assert.Empty(t, opts.TrustedCAs)
+	})
+	t.Run("no token -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		_, err := OptionsFromInputDir(fs, inputDir, TokenInputFile, "https://test/api")
+		require.Error(t, err)
+	})
+}
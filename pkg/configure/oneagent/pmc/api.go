@@ -0,0 +1,188 @@
+package pmc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/api"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/pmc/ruxit"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	APIPath = "/v1/deployment/installer/agent/processmoduleconfig"
+
+	// CacheFileName is the default name of the file, where the last response of the API is cached.
+	CacheFileName = ".ruxitagentproc.json"
+
+	// apiTimeout and apiRetries are way lower than the api defaults (which are meant for downloading a CodeModule zip),
+	// as the response is small and an unavailable API should fall back to the input file quickly, instead of blocking the startup of the pod.
+	apiTimeout = 15 * time.Second
+	apiRetries = 1
+)
+
+// FromAPIWithFallback fetches the ruxitagentproc config from the Dynatrace API, using the URL and token of the input directory.
+// In case fetching fails, the ruxitagentproc.json of the input directory is used instead, the returned bool is false in case neither is available.
+func FromAPIWithFallback(ctx context.Context, log logr.Logger, fs afero.Afero, inputDir, cachePath string) (ruxit.ProcConf, bool, error) {
+	conf, apiErr := FromAPI(ctx, log, fs, inputDir, cachePath)
+	if apiErr == nil {
+		return conf, true, nil
+	}
+
+	log.Info("failed to fetch the ruxitagentproc config from the API, falling back to the input file", "error", apiErr.Error())
+
+	conf, isPresent, err := FromInputFile(log, fs, inputDir)
+	if err != nil {
+		return ruxit.ProcConf{}, false, err
+	}
+
+	if !isPresent {
+		return ruxit.ProcConf{}, false, apiErr
+	}
+
+	return conf, true, nil
+}
+
+// FromAPI fetches the ruxitagentproc config from the Dynatrace API, using the URL and token of the input directory.
+func FromAPI(ctx context.Context, log logr.Logger, fs afero.Afero, inputDir, cachePath string) (ruxit.ProcConf, error) {
+	apiURL, err := api.URLFromInputDir(fs, inputDir)
+	if err != nil {
+		return ruxit.ProcConf{}, err
+	}
+
+	opts, err := api.OptionsFromInputDir(fs, inputDir, api.TokenInputFile, apiURL)
+	if err != nil {
+		return ruxit.ProcConf{}, err
+	}
+
+	opts.Timeout = apiTimeout
+	opts.Retries = apiRetries
+
+	client, err := api.NewClient(opts)
+	if err != nil {
+		return ruxit.ProcConf{}, err
+	}
+
+	return Fetch(ctx, log, fs, client, cachePath)
+}
+
+// Fetch requests the ruxitagentproc config from the API.
+// In case there is a cached response (at the cachePath), its revision is sent along, and if the API responds with the same revision (or 304 not modified) the cached response is used.
+func Fetch(ctx context.Context, log logr.Logger, fs afero.Afero, client *api.Client, cachePath string) (ruxit.ProcConf, error) {
+	cached, isCached := readCache(log, fs, cachePath)
+
+	query := url.Values{}
+	if isCached {
+		query.Set("revision", strconv.FormatUint(uint64(cached.Revision), 10))
+	}
+
+	var conf ruxit.ProcConf
+
+	err := client.Get(ctx, log, APIPath, query, func(response *http.Response) error {
+		if response.StatusCode == http.StatusNotModified {
+			if !isCached {
+				return errors.New("the API responded with 304 not modified, but there is no cached ruxitagentproc config")
+			}
+
+			conf = cached
+
+			return nil
+		}
+
+		var err error
+
+		conf, err = ruxit.FromJSON(response.Body)
+
+		return err
+	})
+	if err != nil {
+		return ruxit.ProcConf{}, err
+	}
+
+	if isCached && conf.Revision == cached.Revision {
+		log.Info("ruxitagentproc config is up to date, using the cached one", "revision", cached.Revision, "path", cachePath)
+
+		return cached, nil
+	}
+
+	log.Info("fetched ruxitagentproc config", "revision", conf.Revision)
+
+	err = writeCache(fs, cachePath, conf)
+	if err != nil {
+		// the cache is only an optimization, so it is fine if it can not be written (for example read-only folder)
+		log.Info("failed to cache the ruxitagentproc config", "path", cachePath, "error", err.Error())
+	}
+
+	return conf, nil
+}
+
+func readCache(log logr.Logger, fs afero.Afero, cachePath string) (ruxit.ProcConf, bool) {
+	if cachePath == "" {
+		return ruxit.ProcConf{}, false
+	}
+
+	cacheFile, err := fs.Open(cachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Info("failed to open the cached ruxitagentproc config, ignoring it", "path", cachePath, "error", err.Error())
+		}
+
+		return ruxit.ProcConf{}, false
+	}
+
+	defer func() { _ = cacheFile.Close() }()
+
+	cached, err := ruxit.FromJSON(cacheFile)
+	if err != nil {
+		log.Info("failed to parse the cached ruxitagentproc config, ignoring it", "path", cachePath, "error", err.Error())
+
+		return ruxit.ProcConf{}, false
+	}
+
+	return cached, true
+}
+
+// writeCache writes into a tmp file first, so concurrent bootstrappers never read a partial cache.
+func writeCache(fs afero.Afero, cachePath string, conf ruxit.ProcConf) error {
+	if cachePath == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(conf)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.MkdirAll(filepath.Dir(cachePath), os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tmpFile, err := fs.TempFile(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = tmpFile.Write(content)
+	_ = tmpFile.Close()
+
+	if err == nil {
+		err = fs.Rename(tmpFile.Name(), cachePath)
+	}
+
+	if err != nil {
+		_ = fs.Remove(tmpFile.Name())
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package pmc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/api"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/configure/oneagent/pmc/ruxit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetch(t *testing.T) {
+	cachePath := "/cache/" + CacheFileName
+
+	latest := ruxit.ProcConf{
+		Properties: []ruxit.Property{{Section: "general", Key: "key", Value: "latest"}},
+		Revision:   2,
+	}
+
+	// the API responds without properties, in case the requested revision is the latest one
+	testServer := func(t *testing.T, expectedRevision string) *api.Client {
+		t.Helper()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, APIPath, r.URL.Path)
+			assert.Equal(t, expectedRevision, r.URL.Query().Get("revision"))
+
+			response := latest
+			if r.URL.Query().Get("revision") == "2" {
+				response = ruxit.ProcConf{Revision: 2}
+			}
+
+			_ = json.NewEncoder(w).Encode(response)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := api.NewClient(api.Options{URL: server.URL, Backoff: time.Millisecond})
+		require.NoError(t, err)
+
+		return client
+	}
+
+	t.Run("no cache -> fetched and cached", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		conf, err := Fetch(context.Background(), testLog, fs, testServer(t, ""), cachePath)
+		require.NoError(t, err)
+		assert.Equal(t, latest, conf)
+
+		cached, isCached := readCache(testLog, fs, cachePath)
+		require.True(t, isCached)
+		assert.Equal(t, latest, cached)
+	})
+	t.Run("cache up to date -> cache used", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, writeCache(fs, cachePath, latest))
+
+		conf, err := Fetch(context.Background(), testLog, fs, testServer(t, "2"), cachePath)
+		require.NoError(t, err)
+		assert.Equal(t, latest, conf)
+	})
+	t.Run("cache outdated -> fetched and cache updated", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, writeCache(fs, cachePath, ruxit.ProcConf{Revision: 1}))
+
+		conf, err := Fetch(context.Background(), testLog, fs, testServer(t, "1"), cachePath)
+		require.NoError(t, err)
+		assert.Equal(t, latest, conf)
+
+		cached, isCached := readCache(testLog, fs, cachePath)
+		require.True(t, isCached)
+		assert.Equal(t, latest, cached)
+	})
+	t.Run("corrupt cache -> ignored", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile(cachePath, []byte("{"), 0644))
+
+		conf, err := Fetch(context.Background(), testLog, fs, testServer(t, ""), cachePath)
+		require.NoError(t, err)
+		assert.Equal(t, latest, conf)
+	})
+	t.Run("not modified -> cache used", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		}))
+		t.Cleanup(server.Close)
+
+		client, err := api.NewClient(api.Options{URL: server.URL, Backoff: time.Millisecond})
+		require.NoError(t, err)
+
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		_, err = Fetch(context.Background(), testLog, fs, client, cachePath)
+		require.ErrorContains(t, err, "no cached ruxitagentproc config")
+
+		require.NoError(t, writeCache(fs, cachePath, latest))
+
+		conf, err := Fetch(context.Background(), testLog, fs, client, cachePath)
+		require.NoError(t, err)
+		assert.Equal(t, latest, conf)
+	})
+}
+
+func TestFromAPIWithFallback(t *testing.T) {
+	inputDir := "/path/input"
+	cachePath := "/cache/" + CacheFileName
+
+	fromFile := ruxit.ProcConf{
+		Properties: []ruxit.Property{{Section: "general", Key: "key", Value: "file"}},
+		Revision:   1,
+	}
+
+	var requests atomic.Int32
+
+	setupAPIInput := func(t *testing.T, fs afero.Afero, status int) {
+		t.Helper()
+
+		requests.Store(0)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+
+			assert.Equal(t, "Api-Token secret", r.Header.Get("Authorization"))
+
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(ruxit.ProcConf{Revision: 2})
+		}))
+		t.Cleanup(server.Close)
+
+		require.NoError(t, fs.WriteFile(filepath.Join(inputDir, api.URLInputFile), []byte(server.URL+"\n"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(inputDir, api.TokenInputFile), []byte("secret"), 0644))
+	}
+
+	t.Run("api available -> api used", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupAPIInput(t, fs, http.StatusOK)
+		setupInputFs(t, fs, inputDir, fromFile)
+
+		conf, isPresent, err := FromAPIWithFallback(context.Background(), testLog, fs, inputDir, cachePath)
+		require.NoError(t, err)
+		require.True(t, isPresent)
+		assert.Equal(t, uint(2), conf.Revision)
+	})
+	t.Run("api fails -> input file used", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupAPIInput(t, fs, http.StatusUnauthorized)
+		setupInputFs(t, fs, inputDir, fromFile)
+
+		conf, isPresent, err := FromAPIWithFallback(context.Background(), testLog, fs, inputDir, cachePath)
+		require.NoError(t, err)
+		require.True(t, isPresent)
+		assert.Equal(t, fromFile, conf)
+	})
+	t.Run("api fails + no input file -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupAPIInput(t, fs, http.StatusUnauthorized)
+
+		_, isPresent, err := FromAPIWithFallback(context.Background(), testLog, fs, inputDir, cachePath)
+		require.ErrorContains(t, err, "unexpected status 401")
+		assert.False(t, isPresent)
+	})
+	t.Run("api unavailable -> only retried once", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupAPIInput(t, fs, http.StatusServiceUnavailable)
+		setupInputFs(t, fs, inputDir, fromFile)
+
+		conf, isPresent, err := FromAPIWithFallback(context.Background(), testLog, fs, inputDir, cachePath)
+		require.NoError(t, err)
+		require.True(t, isPresent)
+		assert.Equal(t, fromFile, conf)
+		assert.Equal(t, int32(apiRetries+1), requests.Load())
+	})
+	t.Run("no api-url + input file -> input file used", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupInputFs(t, fs, inputDir, fromFile)
+
+		conf, isPresent, err := FromAPIWithFallback(context.Background(), testLog, fs, inputDir, cachePath)
+		require.NoError(t, err)
+		require.True(t, isPresent)
+		assert.Equal(t, fromFile, conf)
+	})
+}
@@ -52,7 +52,7 @@ func Create(log logr.Logger, fs afero.Fs, srcPath, dstPath string, conf ruxit.Pr
 
 	defer func() { _ = dstFile.Close() }()
 
-	_, err = dstFile.WriteString(mergedConf.ToString())
+	_, err = dstFile.WriteString(mergedConf.String())
 	if err != nil {
 		log.Info("failed to write merged config into destination file", "path", dstPath)
 
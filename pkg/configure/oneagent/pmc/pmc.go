@@ -25,6 +25,16 @@ func GetDestinationRuxitAgentProcFilePath(configDir string) string {
 }
 
 func Configure(log logr.Logger, fs afero.Afero, inputDir, targetDir, configDir, installPath string) error {
+	conf, isPresent, err := FromInputFile(log, fs, inputDir)
+	if err != nil || !isPresent {
+		return err
+	}
+
+	return ConfigureWithConf(log, fs, conf, targetDir, configDir, installPath)
+}
+
+// FromInputFile reads the ruxitagentproc.json from the input directory, the returned bool is false in case the file is not present.
+func FromInputFile(log logr.Logger, fs afero.Afero, inputDir string) (ruxit.ProcConf, bool, error) {
 	inputFilePath := filepath.Join(inputDir, InputFileName)
 
 	inputFile, err := fs.Open(inputFilePath)
@@ -32,12 +42,12 @@ func Configure(log logr.Logger, fs afero.Afero, inputDir, targetDir, configDir,
 		if os.IsNotExist(err) {
 			log.Info("Input file not present, skipping ruxitagentproc.conf configuration", "path", inputFilePath)
 
-			return nil
+			return ruxit.ProcConf{}, false, nil
 		}
 
 		log.Info("failed to input file", "path", inputFilePath)
 
-		return err
+		return ruxit.ProcConf{}, false, err
 	}
 
 	defer func() { _ = inputFile.Close() }()
@@ -46,9 +56,14 @@ func Configure(log logr.Logger, fs afero.Afero, inputDir, targetDir, configDir,
 	if err != nil {
 		log.Info("failed to unmarshal the input file", "path", inputFilePath)
 
-		return err
+		return ruxit.ProcConf{}, false, err
 	}
 
+	return conf, true, nil
+}
+
+// ConfigureWithConf creates the ruxitagentproc.conf in the config directory, by merging the conf into the one of the CodeModule in the target directory.
+func ConfigureWithConf(log logr.Logger, fs afero.Afero, conf ruxit.ProcConf, targetDir, configDir, installPath string) error {
 	conf.InstallPath = &installPath
 
 	srcPath := GetSourceRuxitAgentProcFilePath(targetDir)
@@ -68,7 +68,9 @@ func TestConfigure(t *testing.T) {
 
 		content, err = fs.ReadFile(GetDestinationRuxitAgentProcFilePath(configDir))
 		require.NoError(t, err)
-		assert.Equal(t, source.Merge(override).ToString(), string(content))
+		// the order of the source is kept, new properties and sections are added to the end
+		expected := "[test]\nkey override\nsource source\nadd add\n\n[general]\nstorage \"/var/lib/dynatrace/oneagent\"\n\n"
+		assert.Equal(t, expected, string(content))
 	})
 
 	t.Run("missing file == skip", func(t *testing.T) {
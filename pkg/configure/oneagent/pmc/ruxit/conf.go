@@ -0,0 +1,263 @@
+package ruxit
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	whiteSpace    = "\t\n\v\f\r "
+	commentPrefix = "#"
+	defaultEnding = "\n"
+)
+
+type lineKind int
+
+const (
+	// otherLine is a blank line or a comment.
+	otherLine lineKind = iota
+	sectionLine
+	propertyLine
+)
+
+// confLine is a single line of a ruxitagentproc.conf file.
+// The line is written as prefix + value + suffix, so it stays byte-for-byte the same, unless the value is changed.
+type confLine struct {
+	kind    lineKind
+	section string
+	key     string
+	// prefix is everything before the value of a property (indentation, key and separator), or the whole content of any other line.
+	prefix string
+	value  string
+	// suffix is everything after the value (trailing whitespace and the line ending).
+	suffix string
+}
+
+func (line confLine) String() string {
+	return line.prefix + line.value + line.suffix
+}
+
+func (line confLine) isProperty(section, key string) bool {
+	return line.kind == propertyLine && line.section == section && line.key == key
+}
+
+func (line *confLine) setValue(value string) {
+	if line.value == "" && value != "" && line.prefix != "" && !strings.ContainsAny(line.prefix[len(line.prefix)-1:], whiteSpace) {
+		line.prefix += " "
+	}
+
+	line.value = value
+}
+
+// Conf is the content of a ruxitagentproc.conf file, that keeps the comments, blank lines, ordering and formatting of the original,
+// so only the actually changed properties differ from it when it is written.
+type Conf struct {
+	lines []confLine
+}
+
+func parseConfLine(rawLine, currentSection string) confLine {
+	content := strings.TrimRight(rawLine, "\r\n")
+	ending := rawLine[len(content):]
+	trimmed := strings.Trim(content, whiteSpace)
+
+	switch {
+	case trimmed == "" || strings.HasPrefix(trimmed, commentPrefix):
+		return confLine{kind: otherLine, section: currentSection, prefix: content, suffix: ending}
+	case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+		section := strings.Trim(trimmed[1:len(trimmed)-1], whiteSpace)
+
+		return confLine{kind: sectionLine, section: section, prefix: content, suffix: ending}
+	}
+
+	keyStart := len(content) - len(strings.TrimLeft(content, whiteSpace))
+
+	keyEnd := strings.IndexAny(content[keyStart:], whiteSpace)
+	if keyEnd < 0 {
+		keyEnd = len(content)
+	} else {
+		keyEnd += keyStart
+	}
+
+	line := confLine{kind: propertyLine, section: currentSection, key: content[keyStart:keyEnd]}
+
+	valueStart := len(content) - len(strings.TrimLeft(content[keyEnd:], whiteSpace))
+	valueEnd := len(strings.TrimRight(content, whiteSpace))
+
+	if valueStart >= valueEnd {
+		line.prefix, line.suffix = content[:keyEnd], content[keyEnd:]+ending
+
+		return line
+	}
+
+	line.prefix, line.value, line.suffix = content[:valueStart], content[valueStart:valueEnd], content[valueEnd:]+ending
+
+	return line
+}
+
+// String creates the content of the configuration file.
+func (conf Conf) String() string {
+	var content strings.Builder
+
+	for _, line := range conf.lines {
+		content.WriteString(line.String())
+	}
+
+	return content.String()
+}
+
+// ProcConf returns the properties of the file, in their original order.
+func (conf Conf) ProcConf() ProcConf {
+	var result ProcConf
+
+	for _, line := range conf.lines {
+		if line.kind == propertyLine {
+			result.Properties = append(result.Properties, Property{Section: line.section, Key: line.key, Value: line.value})
+		}
+	}
+
+	return result
+}
+
+// Merge returns the Conf with the properties of the input applied, does not mutate the original.
+// Existing properties are updated in place, new ones are added to the end of their section (or a new section at the end of the file).
+// The input is applied sorted by section and key, so the result is the same regardless of the order of the input.
+// In case of an InstallPath the Conf is also adjusted for a readonly CodeModule.
+func (conf Conf) Merge(input ProcConf) Conf {
+	merged := Conf{lines: slices.Clone(conf.lines)}
+
+	properties := slices.Clone(input.Properties)
+	slices.SortStableFunc(properties, func(a, b Property) int {
+		if a.Section != b.Section {
+			return strings.Compare(a.Section, b.Section)
+		}
+
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	for _, prop := range properties {
+		merged.set(prop)
+	}
+
+	if input.InstallPath != nil {
+		merged.setupReadonly(*input.InstallPath)
+	}
+
+	return merged
+}
+
+// set updates every occurrence of the property, or adds it in case it is missing.
+// A property without a key can not be written as a line, so it is ignored.
+func (conf *Conf) set(prop Property) {
+	if prop.Key == "" {
+		return
+	}
+
+	isFound := false
+
+	for i := range conf.lines {
+		if conf.lines[i].isProperty(prop.Section, prop.Key) {
+			conf.lines[i].setValue(prop.Value)
+
+			isFound = true
+		}
+	}
+
+	if isFound {
+		return
+	}
+
+	line := confLine{kind: propertyLine, section: prop.Section, key: prop.Key, prefix: prop.Key}
+	line.setValue(prop.Value)
+
+	index, isSectionFound := conf.sectionEnd(prop.Section)
+	if isSectionFound {
+		conf.insert(index, line)
+
+		return
+	}
+
+	conf.addSection(prop.Section, line)
+}
+
+// sectionEnd returns the index after the last header or property of the section.
+func (conf Conf) sectionEnd(section string) (int, bool) {
+	index := -1
+
+	for i, line := range conf.lines {
+		if line.section == section && line.kind != otherLine {
+			index = i + 1
+		}
+	}
+
+	if index < 0 && section == "" {
+		// the properties without a section are at the start of the file, before the first header
+		return 0, true
+	}
+
+	return index, index >= 0
+}
+
+func (conf *Conf) insert(index int, line confLine) {
+	ending := conf.lineEnding()
+	line.suffix = ending
+
+	if index > 0 && !strings.HasSuffix(conf.lines[index-1].suffix, "\n") {
+		conf.lines[index-1].suffix += ending
+	}
+
+	conf.lines = slices.Insert(conf.lines, index, line)
+}
+
+// addSection adds the section with its first property to the end of the file, separated by blank lines, like the other sections.
+func (conf *Conf) addSection(section string, line confLine) {
+	ending := conf.lineEnding()
+
+	if len(conf.lines) > 0 {
+		last := &conf.lines[len(conf.lines)-1]
+		if !strings.HasSuffix(last.suffix, "\n") {
+			last.suffix += ending
+		}
+
+		if last.kind != otherLine || strings.Trim(last.prefix, whiteSpace) != "" {
+			conf.lines = append(conf.lines, confLine{kind: otherLine, section: last.section, suffix: ending})
+		}
+	}
+
+	line.suffix = ending
+
+	conf.lines = append(conf.lines,
+		confLine{kind: sectionLine, section: section, prefix: "[" + section + "]", suffix: ending},
+		line,
+		confLine{kind: otherLine, section: section, suffix: ending},
+	)
+}
+
+// lineEnding returns the line ending used by the file, so added lines match it.
+func (conf Conf) lineEnding() string {
+	for _, line := range conf.lines {
+		if strings.HasSuffix(line.suffix, "\r\n") {
+			return "\r\n"
+		} else if strings.HasSuffix(line.suffix, "\n") {
+			return defaultEnding
+		}
+	}
+
+	return defaultEnding
+}
+
+// setupReadonly removes the properties that are not needed for a readonly CodeModule, makes the library paths absolute (relative to the installPath) and adds the storage dir.
+func (conf *Conf) setupReadonly(installPath string) {
+	conf.lines = slices.DeleteFunc(conf.lines, func(line confLine) bool {
+		return line.kind == propertyLine && slices.Contains(redundantEntries[line.section], line.key)
+	})
+
+	for i, line := range conf.lines {
+		if line.kind == propertyLine && strings.HasPrefix(line.key, "libraryPath") {
+			conf.lines[i].setValue(absoluteLibraryPath(installPath, line.value))
+		}
+	}
+
+	for _, prop := range additionalEntries {
+		conf.set(prop)
+	}
+}
@@ -0,0 +1,144 @@
+package ruxit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const imageConf = `# this file is generated, do not edit
+[general]
+tenant zib50933
+# the server addresses, separated by ;
+serverAddress	{https://example1.dev.dynatracelabs.com/communication}
+logDir ../log
+libraryPath "../lib64"
+attributes key=value other key=other value
+emptyKey
+
+[agentType]
+java on
+# the [brackets] in a comment are not a section
+php off
+`
+
+func TestFromConf(t *testing.T) {
+	t.Run("round-trip -> unchanged", func(t *testing.T) {
+		for _, content := range []string{imageConf, "", "[general]\r\nkey value\r\n", "[general]\nkey value", "key before section\n\n[general]\n"} {
+			conf, err := FromConf(strings.NewReader(content))
+			require.NoError(t, err)
+			assert.Equal(t, content, conf.String())
+		}
+	})
+	t.Run("properties -> full values in order", func(t *testing.T) {
+		conf, err := FromConf(strings.NewReader(imageConf))
+		require.NoError(t, err)
+
+		expected := []Property{
+			{Section: "general", Key: "tenant", Value: "zib50933"},
+			{Section: "general", Key: "serverAddress", Value: "{https://example1.dev.dynatracelabs.com/communication}"},
+			{Section: "general", Key: "logDir", Value: "../log"},
+			{Section: "general", Key: "libraryPath", Value: "\"../lib64\""},
+			{Section: "general", Key: "attributes", Value: "key=value other key=other value"},
+			{Section: "general", Key: "emptyKey", Value: ""},
+			{Section: "agentType", Key: "java", Value: "on"},
+			{Section: "agentType", Key: "php", Value: "off"},
+		}
+		assert.Equal(t, expected, conf.ProcConf().Properties)
+	})
+}
+
+func TestConfMerge(t *testing.T) {
+	override := ProcConf{
+		Properties: []Property{
+			{Section: "newSection", Key: "b", Value: "2"},
+			{Section: "agentType", Key: "php", Value: "on"},
+			{Section: "general", Key: "emptyKey", Value: "now set"},
+			{Section: "newSection", Key: "a", Value: "1"},
+			{Section: "general", Key: "added", Value: "value with spaces"},
+		},
+	}
+
+	t.Run("override -> only changed lines differ", func(t *testing.T) {
+		conf, err := FromConf(strings.NewReader(imageConf))
+		require.NoError(t, err)
+
+		merged := conf.Merge(override)
+
+		expected := `# this file is generated, do not edit
+[general]
+tenant zib50933
+# the server addresses, separated by ;
+serverAddress	{https://example1.dev.dynatracelabs.com/communication}
+logDir ../log
+libraryPath "../lib64"
+attributes key=value other key=other value
+emptyKey now set
+added value with spaces
+
+[agentType]
+java on
+# the [brackets] in a comment are not a section
+php on
+
+[newSection]
+a 1
+b 2
+
+`
+		assert.Equal(t, expected, merged.String())
+		assert.Equal(t, imageConf, conf.String(), "the original is not mutated")
+	})
+	t.Run("override in different order -> same result", func(t *testing.T) {
+		conf, err := FromConf(strings.NewReader(imageConf))
+		require.NoError(t, err)
+
+		reversed := ProcConf{Properties: slices.Clone(override.Properties)}
+		slices.Reverse(reversed.Properties)
+
+		assert.Equal(t, conf.Merge(override).String(), conf.Merge(reversed).String())
+	})
+	t.Run("installPath -> setup for readonly", func(t *testing.T) {
+		conf, err := FromConf(strings.NewReader(imageConf))
+		require.NoError(t, err)
+
+		installPath := "/opt/dynatrace/oneagent"
+		merged := conf.Merge(ProcConf{InstallPath: &installPath})
+
+		expected := `# this file is generated, do not edit
+[general]
+tenant zib50933
+# the server addresses, separated by ;
+serverAddress	{https://example1.dev.dynatracelabs.com/communication}
+libraryPath "/opt/dynatrace/oneagent/agent/lib64"
+attributes key=value other key=other value
+emptyKey
+storage "/var/lib/dynatrace/oneagent"
+
+[agentType]
+java on
+# the [brackets] in a comment are not a section
+php off
+`
+		assert.Equal(t, expected, merged.String())
+	})
+	t.Run("missing trailing newline and CRLF -> kept for added lines", func(t *testing.T) {
+		conf, err := FromConf(strings.NewReader("[general]\r\nkey value"))
+		require.NoError(t, err)
+
+		merged := conf.Merge(ProcConf{Properties: []Property{{Section: "general", Key: "added", Value: "value"}}})
+
+		assert.Equal(t, "[general]\r\nkey value\r\nadded value\r\n", merged.String())
+	})
+	t.Run("property without key -> ignored", func(t *testing.T) {
+		conf, err := FromConf(strings.NewReader("[general]\nkey value\n"))
+		require.NoError(t, err)
+
+		merged := conf.Merge(ProcConf{Properties: []Property{{Section: "general", Key: "", Value: "value"}, {Section: "other", Value: ""}}})
+
+		assert.Equal(t, "[general]\nkey value\n", merged.String())
+	})
+}
@@ -4,35 +4,10 @@ import (
 	"bufio"
 	"encoding/json"
 	"io"
-	"regexp"
-	"strings"
 
 	"github.com/pkg/errors"
 )
 
-const (
-	twoSectionParts = 2
-	twoConfigParts  = 2
-)
-
-var sectionRegexp = regexp.MustCompile(`\[(.*)\]`)
-
-func FromMap(procMap ProcMap) ProcConf {
-	var result ProcConf
-
-	for section, props := range procMap {
-		for key, value := range props {
-			result.Properties = append(result.Properties, Property{
-				Section: section,
-				Key:     key,
-				Value:   value,
-			})
-		}
-	}
-
-	return result
-}
-
 func FromJSON(reader io.Reader) (ProcConf, error) {
 	var result ProcConf
 
@@ -49,52 +24,26 @@ func FromJSON(reader io.Reader) (ProcConf, error) {
 	return result, nil
 }
 
-func FromConf(reader io.Reader) (ProcConf, error) {
-	var result []Property
-
-	const whiteSpace = "\t\n\v\f\r "
+// FromConf parses the content of a ruxitagentproc.conf file.
+// A property is split at the first whitespace, everything after it (without the surrounding whitespace) is the value.
+func FromConf(reader io.Reader) (Conf, error) {
+	var conf Conf
 
-	scanner := bufio.NewScanner(reader)
+	bufReader := bufio.NewReader(reader)
 	currentSection := ""
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		header := confSectionHeader(line)
-
-		switch {
-		case header != "":
-			currentSection = strings.Trim(header, whiteSpace)
-		case line != "" && !strings.HasPrefix(line, "#"):
-			splitLine := strings.Split(line, " ")
-			prop := Property{
-				Section: currentSection,
-				Key:     strings.Trim(splitLine[0], whiteSpace),
-			}
-
-			if len(splitLine) == twoConfigParts {
-				prop.Value = strings.Trim(splitLine[1], whiteSpace)
-			}
-
-			result = append(result, prop)
+	for {
+		rawLine, err := bufReader.ReadString('\n')
+		if rawLine != "" {
+			line := parseConfLine(rawLine, currentSection)
+			currentSection = line.section
+			conf.lines = append(conf.lines, line)
 		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return ProcConf{}, errors.WithStack(err)
-	}
 
-	return ProcConf{
-		Properties: result,
-		Revision:   0,
-	}, nil
-}
-
-func confSectionHeader(line string) string {
-	matches := sectionRegexp.FindStringSubmatch(line)
-
-	if len(matches) == twoSectionParts {
-		return matches[1]
+		if errors.Is(err, io.EOF) {
+			return conf, nil
+		} else if err != nil {
+			return Conf{}, errors.WithStack(err)
+		}
 	}
-
-	return ""
 }
@@ -1,9 +1,7 @@
 package ruxit
 
 import (
-	"fmt"
 	"path/filepath"
-	"sort"
 	"strings"
 )
 
@@ -21,135 +19,28 @@ type Property struct {
 }
 
 // ToString creates the content of the configuration file, the sections and properties are printed in a sorted order, so it can be tested.
+// To keep the content of an existing file, use Conf.Merge instead.
 func (pc ProcConf) ToString() string {
-	if pc.InstallPath != nil {
-		pm := pc.ToMap()
-		pm = pm.SetupReadonly(*pc.InstallPath)
-
-		return pm.ToString()
-	}
-
-	return pc.ToMap().ToString()
+	return Conf{}.Merge(pc).String()
 }
 
-// Merge returns the merged ProcConf, the values in the input will take precedent, does not mutate the original.
-func (pc ProcConf) Merge(input ProcConf) ProcConf {
-	source := pc.ToMap()
-	override := input.ToMap()
-
-	updated := FromMap(source.Merge(override))
-	updated.Revision = input.Revision
-	updated.InstallPath = input.InstallPath
-
-	return updated
-}
-
-func (pc ProcConf) ToMap() ProcMap {
-	sections := map[string]map[string]string{}
-	for _, prop := range pc.Properties {
-		section := sections[prop.Section]
-		if section == nil {
-			section = map[string]string{}
-		}
-
-		section[prop.Key] = prop.Value
-		sections[prop.Section] = section
-	}
-
-	return sections
-}
-
-// ProcMap presents the content in a more easy to work with format. (a map of maps).
-type ProcMap map[string]map[string]string
-
 var (
 	redundantEntries = map[string][]string{
 		"general": {"logDir", "dataStorageDir"},
 	}
-	additionalEntries = ProcMap{
-		"general": map[string]string{
-			"storage": "\"/var/lib/dynatrace/oneagent\"", // TODO: Make configurable?
-		},
+	additionalEntries = []Property{
+		{Section: "general", Key: "storage", Value: "\"/var/lib/dynatrace/oneagent\""}, // TODO: Make configurable?
 	}
 )
 
-func (pm ProcMap) SetupReadonly(installPath string) ProcMap {
-	for key, values := range redundantEntries {
-		_, ok := pm[key]
-		if !ok {
-			continue
-		}
-
-		for _, value := range values {
-			delete(pm[key], value)
-		}
-	}
-
-	for section, entries := range pm {
-		for entry, value := range entries {
-			volume := filepath.VolumeName(value)
-			fmt.Printf("%s", volume) //nolint:forbidigo
-
-			if strings.HasPrefix(entry, "libraryPath") {
-				sanitizedEntry := strings.ReplaceAll(value, "../", "")
-				sanitizedEntry, found := strings.CutPrefix(sanitizedEntry, "\"")
-
-				if found {
-					pm[section][entry] = "\"" + filepath.Join(installPath, "agent", sanitizedEntry)
-				} else {
-					pm[section][entry] = filepath.Join(installPath, "agent", sanitizedEntry)
-				}
-			}
-		}
-	}
-
-	return pm.Merge(additionalEntries)
-}
-
-func (pm ProcMap) ToString() string {
-	sections := make([]string, 0, len(pm))
-	for section := range pm {
-		sections = append(sections, section)
-	}
-
-	sort.Strings(sections)
-
-	var content strings.Builder
-	for _, section := range sections {
-		content.WriteString("[" + section + "]")
-		content.WriteString("\n")
-
-		var props []string
-		for prop := range pm[section] {
-			props = append(props, prop)
-		}
-
-		sort.Strings(props)
-
-		for _, prop := range props {
-			content.WriteString(prop)
-			content.WriteString(" ")
-			content.WriteString(pm[section][prop])
-			content.WriteString("\n")
-		}
-
-		content.WriteString("\n")
-	}
-
-	return content.String()
-}
-
-func (pm ProcMap) Merge(override ProcMap) ProcMap {
-	for section, props := range override {
-		_, ok := pm[section]
-		if !ok {
-			pm[section] = map[string]string{}
-		}
+// absoluteLibraryPath makes the (relative, possibly quoted) library path absolute, so it points into the agent dir of the installPath.
+func absoluteLibraryPath(installPath, value string) string {
+	sanitizedEntry := strings.ReplaceAll(value, "../", "")
 
-		for key, value := range props {
-			pm[section][key] = value
-		}
+	sanitizedEntry, found := strings.CutPrefix(sanitizedEntry, "\"")
+	if found {
+		return "\"" + filepath.Join(installPath, "agent", sanitizedEntry)
 	}
 
-	return pm
+	return filepath.Join(installPath, "agent", sanitizedEntry)
 }
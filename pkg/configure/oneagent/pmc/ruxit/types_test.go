@@ -92,15 +92,16 @@ func TestConversions(t *testing.T) {
 	rawString := ruxit.ToString()
 	require.Equal(t, expectedConf, rawString)
 
-	ruxit2, err := FromConf(strings.NewReader(rawString))
+	conf, err := FromConf(strings.NewReader(rawString))
 	require.NoError(t, err)
+	require.Equal(t, rawString, conf.String())
+
+	ruxit2 := conf.ProcConf()
 	require.NotEmpty(t, ruxit2)
 	require.ElementsMatch(t, ruxit.Properties, ruxit2.Properties)
 
 	rawString2 := ruxit2.ToString()
 	require.Equal(t, expectedConf, rawString2)
-	require.Equal(t, ruxit.ToMap(), ruxit2.ToMap())
-	require.ElementsMatch(t, FromMap(ruxit.ToMap()).Properties, FromMap(ruxit2.ToMap()).Properties)
 }
 
 func TestMerge(t *testing.T) {
@@ -117,9 +118,9 @@ func TestMerge(t *testing.T) {
 			Revision: 1,
 		}
 
-		merged := source.Merge(override)
+		merged := Conf{}.Merge(source).Merge(override).ProcConf()
 
-		assert.Equal(t, override, merged)
+		assert.Equal(t, override.Properties, merged.Properties)
 	})
 	t.Run("add", func(t *testing.T) {
 		expectedProps := []Property{
@@ -148,9 +149,8 @@ func TestMerge(t *testing.T) {
 			Revision: 1,
 		}
 
-		merged := source.Merge(override)
+		merged := Conf{}.Merge(source).Merge(override).ProcConf()
 
-		assert.Equal(t, override.Revision, merged.Revision)
 		assert.ElementsMatch(t, expectedProps, merged.Properties)
 	})
 
@@ -183,9 +183,8 @@ func TestMerge(t *testing.T) {
 			Revision:   1,
 		}
 
-		merged := source.Merge(override)
+		merged := Conf{}.Merge(source).Merge(override).ProcConf()
 
-		assert.Equal(t, override.Revision, merged.Revision)
 		assert.ElementsMatch(t, expectedProps, merged.Properties)
 	})
 }
@@ -278,12 +277,8 @@ func TestSetupReadonly(t *testing.T) {
 			InstallPath: &installPath,
 		}
 
-		merged := source.Merge(override)
-
-		assert.Equal(t, override.Revision, merged.Revision)
-		assert.Equal(t, *override.InstallPath, *merged.InstallPath)
+		merged := Conf{}.Merge(source).Merge(override).ProcConf()
 
-		expected := ProcConf{Properties: expectedProps}.ToString()
-		assert.Equal(t, expected, merged.ToString())
+		assert.ElementsMatch(t, expectedProps, merged.Properties)
 	})
 }
@@ -0,0 +1,121 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/api"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	DefaultFlavor = "default"
+
+	latestPath  = "/v1/deployment/installer/agent/unix/paas/latest"
+	versionPath = "/v1/deployment/installer/agent/unix/paas/version/"
+
+	includeAll = "all"
+	bitness    = "64"
+)
+
+// Options defines which CodeModule is downloaded.
+type Options struct {
+	Flavor string
+	Arch   string
+	// Version of the CodeModule, empty means the latest version.
+	Version string
+	// SHA256 is the expected checksum of the downloaded zip, empty means it is not verified.
+	SHA256 string
+	// Technologies to include in the zip, empty means all technologies.
+	Technologies []string
+}
+
+// IsURL checks if the source is a URL of a Dynatrace API, instead of a path.
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// CodeModule downloads the PaaS CodeModule zip from the Dynatrace API into the destination file.
+// The content is verified against the Content-Length of the response and, in case it is set, the expected SHA256 of the Options.
+func CodeModule(ctx context.Context, log logr.Logger, fs afero.Afero, client *api.Client, opts Options, destination string) error {
+	path := latestPath
+	if opts.Version != "" {
+		path = versionPath + url.PathEscape(opts.Version)
+	}
+
+	log.Info("downloading CodeModule", "path", path, "flavor", opts.Flavor, "arch", opts.Arch, "technologies", opts.Technologies, "destination", destination)
+
+	err := client.Get(ctx, log, path, query(opts), func(response *http.Response) error {
+		return writeZip(fs, response, destination, opts.SHA256)
+	})
+	if err != nil {
+		_ = fs.Remove(destination)
+
+		return err
+	}
+
+	log.Info("downloaded CodeModule", "destination", destination)
+
+	return nil
+}
+
+func query(opts Options) url.Values {
+	flavor := opts.Flavor
+	if flavor == "" {
+		flavor = DefaultFlavor
+	}
+
+	values := url.Values{
+		"flavor":  {flavor},
+		"bitness": {bitness},
+	}
+
+	if opts.Arch != "" {
+		values.Set("arch", opts.Arch)
+	}
+
+	if len(opts.Technologies) == 0 {
+		values.Set("include", includeAll)
+	}
+
+	for _, tech := range opts.Technologies {
+		values.Add("include", tech)
+	}
+
+	return values
+}
+
+func writeZip(fs afero.Afero, response *http.Response, destination, expectedSHA256 string) error {
+	file, err := fs.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	hasher := sha256.New()
+
+	written, err := io.Copy(io.MultiWriter(file, hasher), response.Body)
+	if err != nil {
+		return errors.WithMessage(err, "failed to download the CodeModule")
+	}
+
+	if response.ContentLength >= 0 && written != response.ContentLength {
+		return errors.Errorf("incomplete download of the CodeModule: expected %d bytes, got %d bytes", response.ContentLength, written)
+	}
+
+	actualSHA256 := hex.EncodeToString(hasher.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(actualSHA256, expectedSHA256) {
+		return errors.Errorf("checksum mismatch for the downloaded CodeModule: expected sha256 %s, got %s", expectedSHA256, actualSHA256)
+	}
+
+	return errors.WithStack(file.Sync())
+}
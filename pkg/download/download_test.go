@@ -0,0 +1,113 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/api"
+	"github.com/go-logr/zapr"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var testLog = zapr.NewLogger(zap.NewExample())
+
+const (
+	testZip         = "zip content"
+	testDestination = "/tmp/codemodule.zip"
+)
+
+func testClient(t *testing.T, handler http.HandlerFunc) *api.Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient(api.Options{URL: server.URL + "/api", Token: "secret", Retries: 1, Backoff: time.Millisecond})
+	require.NoError(t, err)
+
+	return client
+}
+
+func TestCodeModule(t *testing.T) {
+	hash := sha256.Sum256([]byte(testZip))
+	checksum := hex.EncodeToString(hash[:])
+
+	t.Run("latest + technologies -> downloaded", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api"+latestPath, r.URL.Path)
+			assert.Equal(t, "musl", r.URL.Query().Get("flavor"))
+			assert.Equal(t, "x86", r.URL.Query().Get("arch"))
+			assert.Equal(t, "64", r.URL.Query().Get("bitness"))
+			assert.Equal(t, []string{"java", "php"}, r.URL.Query()["include"])
+			_, _ = w.Write([]byte(testZip))
+		})
+
+		opts := Options{Flavor: "musl", Arch: "x86", Technologies: []string{"java", "php"}, SHA256: checksum}
+		require.NoError(t, CodeModule(context.Background(), testLog, fs, client, opts, testDestination))
+
+		content, err := fs.ReadFile(testDestination)
+		require.NoError(t, err)
+		assert.Equal(t, testZip, string(content))
+	})
+	t.Run("version + no technologies -> everything included", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		client := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api"+versionPath+"1.2.3", r.URL.Path)
+			assert.Equal(t, DefaultFlavor, r.URL.Query().Get("flavor"))
+			assert.Equal(t, []string{includeAll}, r.URL.Query()["include"])
+			_, _ = w.Write([]byte(testZip))
+		})
+
+		require.NoError(t, CodeModule(context.Background(), testLog, fs, client, Options{Version: "1.2.3"}, testDestination))
+	})
+	t.Run("checksum mismatch -> error and nothing left behind", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		client := testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("corrupted"))
+		})
+
+		err := CodeModule(context.Background(), testLog, fs, client, Options{SHA256: checksum}, testDestination)
+		require.ErrorContains(t, err, "checksum mismatch")
+
+		exists, err := fs.Exists(testDestination)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("interrupted download -> retried", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		requests := 0
+		client := testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			requests++
+			if requests == 1 {
+				// announce more than is sent, so the client sees an unexpected EOF
+				w.Header().Set("Content-Length", strconv.Itoa(len(testZip)+10))
+			}
+
+			_, _ = w.Write([]byte(testZip))
+		})
+
+		require.NoError(t, CodeModule(context.Background(), testLog, fs, client, Options{SHA256: checksum}, testDestination))
+		assert.Equal(t, 2, requests)
+
+		content, err := fs.ReadFile(testDestination)
+		require.NoError(t, err)
+		assert.Equal(t, testZip, string(content))
+	})
+}
+
+func TestIsURL(t *testing.T) {
+	assert.True(t, IsURL("https://test.live.dynatrace.com/api"))
+	assert.True(t, IsURL("http://activegate:9999/e/test/api"))
+	assert.False(t, IsURL("/opt/dynatrace/oneagent"))
+	assert.False(t, IsURL("codemodule.zip"))
+}
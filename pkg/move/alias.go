@@ -0,0 +1,236 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/lock"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	// parentAliasPrefix marks an alias that is put next to the target, instead of into its agent/bin folder.
+	parentAliasPrefix = "../"
+
+	versionPlaceholder = "version"
+	majorPlaceholder   = "major"
+	minorPlaceholder   = "minor"
+	patchPlaceholder   = "patch"
+)
+
+var (
+	aliasPlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+	// versionPartPlaceholders are the placeholders for the dot-separated parts of a version, in order.
+	versionPartPlaceholders = []string{majorPlaceholder, minorPlaceholder, patchPlaceholder}
+)
+
+// VersionAlias is an additional symlink to the version of the target, that stays the same across (patch) upgrades, for example for web server module configs that are baked into application images.
+// The alias is either put into the agent/bin folder of the target (next to the "current" symlink) pointing to the agent/bin/<version> dir,
+// or in case of IsParent next to the target itself, pointing to the target.
+type VersionAlias struct {
+	// Name of the symlink, it can contain the placeholders {version}, {major}, {minor} and {patch}, for example "{major}.{minor}".
+	Name     string
+	IsParent bool
+}
+
+// ParseVersionAlias parses an alias, a "../" prefix means that the alias is put next to the target, for example "../latest".
+func ParseVersionAlias(alias string) (VersionAlias, error) {
+	name, isParent := strings.CutPrefix(alias, parentAliasPrefix)
+	versionAlias := VersionAlias{Name: name, IsParent: isParent}
+
+	for _, match := range aliasPlaceholderPattern.FindAllStringSubmatch(name, -1) {
+		if match[1] != versionPlaceholder && !slices.Contains(versionPartPlaceholders, match[1]) {
+			return VersionAlias{}, errors.Errorf("unknown placeholder %s in version alias %q, must be one of: {%s}, {%s}", match[0], alias, versionPlaceholder, strings.Join(versionPartPlaceholders, "}, {"))
+		}
+	}
+
+	// the placeholders are replaced by valid parts of a version, so an invalid name stays invalid for every version
+	_, err := versionAlias.Resolve("1.2.3")
+	if err != nil {
+		return VersionAlias{}, err
+	}
+
+	return versionAlias, nil
+}
+
+// Resolve returns the name of the symlink for the version, by replacing the placeholders of the Name.
+func (alias VersionAlias) Resolve(version string) (string, error) {
+	values := map[string]string{versionPlaceholder: version}
+
+	for i, part := range strings.SplitN(version, ".", len(versionPartPlaceholders)+1) {
+		if i < len(versionPartPlaceholders) {
+			values[versionPartPlaceholders[i]] = part
+		}
+	}
+
+	var missing []string
+
+	name := aliasPlaceholderPattern.ReplaceAllStringFunc(alias.Name, func(placeholder string) string {
+		value, ok := values[strings.Trim(placeholder, "{}")]
+		if !ok {
+			missing = append(missing, placeholder)
+		}
+
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", errors.Errorf("version %s has no value for %s of the version alias %q", version, strings.Join(missing, ", "), alias.Name)
+	}
+
+	if !versionPattern.MatchString(name) || name == filepath.Base(currentDir) {
+		return "", errors.Errorf("invalid version alias %q, it has to be a valid dir name (other than %s)", alias.Name, filepath.Base(currentDir))
+	}
+
+	return name, nil
+}
+
+// aliasSymlink is where the symlink of an alias is put, what it points to (relative to the symlink) and the resulting version dir.
+type aliasSymlink struct {
+	path       string
+	target     string
+	versionDir string
+}
+
+func (alias VersionAlias) symlink(targetDir, version string) (aliasSymlink, error) {
+	name, err := alias.Resolve(version)
+	if err != nil {
+		return aliasSymlink{}, err
+	}
+
+	if alias.IsParent {
+		targetDir = filepath.Clean(targetDir)
+
+		if name == filepath.Base(targetDir) {
+			return aliasSymlink{}, errors.Errorf("version alias %q has the same name as the target %s", alias.Name, targetDir)
+		}
+
+		return aliasSymlink{path: filepath.Join(filepath.Dir(targetDir), name), target: filepath.Base(targetDir), versionDir: targetDir}, nil
+	}
+
+	if name == version {
+		return aliasSymlink{}, errors.Errorf("version alias %q has the same name as the version %s", alias.Name, version)
+	}
+
+	return aliasSymlink{path: filepath.Join(targetDir, binDir, name), target: version, versionDir: filepath.Join(targetDir, binDir, version)}, nil
+}
+
+// CreateVersionAliases creates (or replaces, in case they point to a different version) the symlinks of the aliases for the version of the `targetDir`.
+// An alias fails in case something else than a symlink is already present at its path.
+// An alias next to the target only moves forward, it is kept in case it already points to a newer version (for example when an older version is bootstrapped again).
+// As the alias next to the target is shared with the bootstrappers of other versions, it is locked (waiting until the timeout) while it is compared and replaced.
+// An alias in the agent/bin folder is skipped in case the agent/bin/<version> dir is missing, the same way as the "current" symlink.
+func CreateVersionAliases(log logr.Logger, fs afero.Afero, targetDir string, aliases []VersionAlias, timeout time.Duration) error {
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	version, err := ReadInstallerVersion(fs, targetDir)
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range aliases {
+		link, err := alias.symlink(targetDir, version)
+		if err != nil {
+			return err
+		}
+
+		err = createVersionAlias(log, fs, link, version, alias.IsParent, timeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createVersionAlias(log logr.Logger, fs afero.Afero, link aliasSymlink, version string, isParent bool, timeout time.Duration) error {
+	if isParent {
+		aliasLock, _, err := lock.Acquire(log, fs.Fs, link.path, timeout)
+		if err != nil {
+			log.Info("failed to lock the version alias", "alias", link.path)
+
+			return err
+		}
+
+		defer func() {
+			if releaseErr := aliasLock.Release(); releaseErr != nil {
+				log.Error(releaseErr, "failed to release the lock", "alias", link.path)
+			}
+		}()
+	}
+
+	isSymlink, err := isSymlinkOrMissing(fs, link.path)
+	if err != nil {
+		return err
+	} else if !isSymlink {
+		return errors.Errorf("can't create the version alias %s, as it already exists and is not a symlink", link.path)
+	}
+
+	info, err := fs.Stat(link.versionDir)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("the dir of the version is missing, skipping the version alias", "alias", link.path, "version dir", link.versionDir)
+
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	} else if !info.IsDir() {
+		return errors.Errorf("the version alias %s can't point to %s, as it is not a dir", link.path, link.versionDir)
+	}
+
+	if isParent && isLinkedVersionNewer(fs, link.path, version) {
+		log.Info("the version alias already points to a newer version, keeping it", "alias", link.path, "version", version)
+
+		return nil
+	}
+
+	return replaceVersionSymlink(log, fs, link.path, link.target, link.versionDir)
+}
+
+// isLinkedVersionNewer checks if the symlink points to a target with a newer version (according to CompareVersions) than the version.
+// A dangling symlink, or one that points to something without a (valid) installer.version, is never considered newer.
+func isLinkedVersionNewer(fs afero.Afero, symlinkPath, version string) bool {
+	linkedVersion, err := ReadInstallerVersion(fs, symlinkPath)
+	if err != nil {
+		return false
+	}
+
+	return CompareVersions(linkedVersion, version) > 0
+}
+
+// PlanVersionAliases returns the symlinks that CreateVersionAliases would create (or replace) for the version, after the files are copied.
+// The aliases in the agent/bin folder are only considered to already exist, in case the target is reused.
+func PlanVersionAliases(fs afero.Afero, targetDir, version string, aliases []VersionAlias, isTargetReused bool) ([]PlannedSymlink, error) {
+	planned := make([]PlannedSymlink, 0, len(aliases))
+
+	for _, alias := range aliases {
+		link, err := alias.symlink(targetDir, version)
+		if err != nil {
+			return nil, err
+		}
+
+		if alias.IsParent || isTargetReused {
+			isUpToDate, err := isSymlinkUpToDate(fs, link.path, link.versionDir)
+			if err != nil {
+				return nil, err
+			} else if isUpToDate {
+				continue
+			}
+		}
+
+		if alias.IsParent && isLinkedVersionNewer(fs, link.path, version) {
+			continue
+		}
+
+		planned = append(planned, PlannedSymlink{Path: link.path, Target: link.target})
+	}
+
+	return planned, nil
+}
@@ -0,0 +1,231 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/lock"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersionAlias(t *testing.T) {
+	version := "1.311.70.20250416-143244"
+
+	testCases := []struct {
+		alias    string
+		resolved string
+		isParent bool
+	}{
+		{alias: "{major}.{minor}", resolved: "1.311"},
+		{alias: "{major}.{minor}.{patch}", resolved: "1.311.70"},
+		{alias: "v{major}", resolved: "v1"},
+		{alias: "stable", resolved: "stable"},
+		{alias: "../latest", resolved: "latest", isParent: true},
+		{alias: "../{major}.{minor}", resolved: "1.311", isParent: true},
+		{alias: "../{version}", resolved: version, isParent: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.alias+" -> "+testCase.resolved, func(t *testing.T) {
+			alias, err := ParseVersionAlias(testCase.alias)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.isParent, alias.IsParent)
+
+			resolved, err := alias.Resolve(version)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.resolved, resolved)
+		})
+	}
+
+	t.Run("invalid alias -> error", func(t *testing.T) {
+		for _, alias := range []string{"", "../", "{build}", "current", "a/b", "../../latest", "..", "{major} {minor}"} {
+			_, err := ParseVersionAlias(alias)
+			require.Error(t, err, alias)
+		}
+	})
+	t.Run("version without patch -> error", func(t *testing.T) {
+		alias, err := ParseVersionAlias("{major}.{minor}.{patch}")
+		require.NoError(t, err)
+
+		_, err = alias.Resolve("1.311")
+		require.Error(t, err)
+	})
+}
+
+func TestCreateVersionAliases(t *testing.T) {
+	setupTarget := func(t *testing.T, version string) (afero.Afero, string) {
+		t.Helper()
+
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := filepath.Join(t.TempDir(), version)
+
+		require.NoError(t, fs.MkdirAll(filepath.Join(target, binDir, version), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, InstallerVersionFilePath), []byte(version+"\n"), 0644))
+
+		return fs, target
+	}
+
+	parseAliases := func(t *testing.T, aliases ...string) []VersionAlias {
+		t.Helper()
+
+		parsed := make([]VersionAlias, 0, len(aliases))
+
+		for _, alias := range aliases {
+			versionAlias, err := ParseVersionAlias(alias)
+			require.NoError(t, err)
+
+			parsed = append(parsed, versionAlias)
+		}
+
+		return parsed
+	}
+
+	assertLink := func(t *testing.T, path, expected string) {
+		t.Helper()
+
+		linkTarget, err := os.Readlink(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, linkTarget)
+	}
+
+	t.Run("aliases -> created in agent/bin and next to the target", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.311.70")
+
+		err := CreateVersionAliases(testLog, fs, target, parseAliases(t, "{major}.{minor}", "../latest"), 0)
+		require.NoError(t, err)
+
+		assertLink(t, filepath.Join(target, binDir, "1.311"), "1.311.70")
+		assertLink(t, filepath.Join(filepath.Dir(target), "latest"), "1.311.70")
+	})
+	t.Run("patch upgrade -> aliases point to the new version", func(t *testing.T) {
+		fs, oldTarget := setupTarget(t, "1.311.70")
+		aliases := parseAliases(t, "../{major}.{minor}")
+
+		require.NoError(t, CreateVersionAliases(testLog, fs, oldTarget, aliases, 0))
+
+		newTarget := filepath.Join(filepath.Dir(oldTarget), "1.311.72")
+		require.NoError(t, fs.MkdirAll(filepath.Join(newTarget, binDir, "1.311.72"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(newTarget, InstallerVersionFilePath), []byte("1.311.72"), 0644))
+
+		require.NoError(t, CreateVersionAliases(testLog, fs, newTarget, aliases, 0))
+
+		assertLink(t, filepath.Join(filepath.Dir(oldTarget), "1.311"), "1.311.72")
+	})
+	t.Run("older version -> alias next to the target kept", func(t *testing.T) {
+		fs, newTarget := setupTarget(t, "1.311.72")
+		aliases := parseAliases(t, "../latest")
+
+		require.NoError(t, CreateVersionAliases(testLog, fs, newTarget, aliases, 0))
+
+		oldTarget := filepath.Join(filepath.Dir(newTarget), "1.311.70")
+		require.NoError(t, fs.MkdirAll(filepath.Join(oldTarget, binDir, "1.311.70"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(oldTarget, InstallerVersionFilePath), []byte("1.311.70"), 0644))
+
+		require.NoError(t, CreateVersionAliases(testLog, fs, oldTarget, aliases, 0))
+		assertLink(t, filepath.Join(filepath.Dir(newTarget), "latest"), "1.311.72")
+
+		planned, err := PlanVersionAliases(fs, oldTarget, "1.311.70", aliases, false)
+		require.NoError(t, err)
+		assert.Empty(t, planned)
+	})
+	t.Run("version dir missing -> alias in agent/bin skipped", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.311.70")
+		require.NoError(t, fs.RemoveAll(filepath.Join(target, binDir)))
+
+		err := CreateVersionAliases(testLog, fs, target, parseAliases(t, "{major}.{minor}", "../latest"), 0)
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(target, binDir, "1.311"))
+		assertLink(t, filepath.Join(filepath.Dir(target), "latest"), "1.311.70")
+	})
+	t.Run("alias path is a dir -> error", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.311.70")
+		require.NoError(t, fs.MkdirAll(filepath.Join(target, binDir, "stable"), 0755))
+
+		err := CreateVersionAliases(testLog, fs, target, parseAliases(t, "stable"), 0)
+		require.ErrorContains(t, err, "not a symlink")
+	})
+	t.Run("alias same as version -> error", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.311.70")
+
+		err := CreateVersionAliases(testLog, fs, target, parseAliases(t, "{version}"), 0)
+		require.Error(t, err)
+
+		err = CreateVersionAliases(testLog, fs, target, parseAliases(t, "../{version}"), 0)
+		require.Error(t, err)
+	})
+	t.Run("concurrent versions -> alias next to the target points to the newest", func(t *testing.T) {
+		fs, firstTarget := setupTarget(t, "1.311.70")
+		aliases := parseAliases(t, "../latest")
+		versions := []string{"1.311.70", "1.311.72", "1.311.71", "1.311.74", "1.311.73"}
+
+		for _, version := range versions[1:] {
+			target := filepath.Join(filepath.Dir(firstTarget), version)
+			require.NoError(t, fs.MkdirAll(filepath.Join(target, binDir, version), 0755))
+			require.NoError(t, fs.WriteFile(filepath.Join(target, InstallerVersionFilePath), []byte(version), 0644))
+		}
+
+		var wg sync.WaitGroup
+
+		errs := make([]error, len(versions))
+
+		for i, version := range versions {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				errs[i] = CreateVersionAliases(testLog, fs, filepath.Join(filepath.Dir(firstTarget), version), aliases, time.Minute)
+			}()
+		}
+
+		wg.Wait()
+
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		assertLink(t, filepath.Join(filepath.Dir(firstTarget), "latest"), "1.311.74")
+
+		tmpLinks, err := filepath.Glob(filepath.Join(filepath.Dir(firstTarget), ".latest.*.tmp"))
+		require.NoError(t, err)
+		assert.Empty(t, tmpLinks)
+	})
+	t.Run("alias next to the target locked -> times out", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.311.70")
+		aliasPath := filepath.Join(filepath.Dir(target), "latest")
+
+		aliasLock, _, err := lock.Acquire(testLog, fs.Fs, aliasPath, 0)
+		require.NoError(t, err)
+
+		defer func() { _ = aliasLock.Release() }()
+
+		err = CreateVersionAliases(testLog, fs, target, parseAliases(t, "../latest"), 0)
+		require.ErrorIs(t, err, lock.ErrTimeout)
+
+		_, err = os.Lstat(aliasPath)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("planned -> only missing or stale aliases", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.311.70")
+		aliases := parseAliases(t, "{major}.{minor}", "../latest")
+
+		planned, err := PlanVersionAliases(fs, target, "1.311.70", aliases, true)
+		require.NoError(t, err)
+		assert.Equal(t, []PlannedSymlink{
+			{Path: filepath.Join(target, binDir, "1.311"), Target: "1.311.70"},
+			{Path: filepath.Join(filepath.Dir(target), "latest"), Target: "1.311.70"},
+		}, planned)
+
+		require.NoError(t, CreateVersionAliases(testLog, fs, target, aliases, 0))
+
+		planned, err = PlanVersionAliases(fs, target, "1.311.70", aliases, true)
+		require.NoError(t, err)
+		assert.Empty(t, planned)
+	})
+}
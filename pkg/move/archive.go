@@ -0,0 +1,798 @@
+package move
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"golang.org/x/sys/unix"
+)
+
+const defaultArchiveDirMode os.FileMode = 0755
+
+var (
+	archiveExtensions = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+	errStopWalk = errors.New("stop walking the archive")
+)
+
+// IsArchive checks if the path points to a CodeModule archive (.tar, .tar.gz, .tgz or .zip), based on its extension.
+func IsArchive(path string) bool {
+	return archiveExtension(path) != ""
+}
+
+func archiveExtension(path string) string {
+	lowerPath := strings.ToLower(path)
+
+	for _, extension := range archiveExtensions {
+		if strings.HasSuffix(lowerPath, extension) {
+			return extension
+		}
+	}
+
+	return ""
+}
+
+// archiveEntry is a single entry of an archive, independent of the format of the archive.
+type archiveEntry struct {
+	modTime time.Time
+	// path is relative to the root of the archive.
+	path string
+	// linkname is the target of a symlink, or the path (relative to the root of the archive) of the original file of a hardlink.
+	linkname string
+	size     int64
+	// offset is where the content starts in the archive, it is only known for uncompressed tar archives (otherwise 0).
+	offset     int64
+	mode       os.FileMode
+	isHardlink bool
+}
+
+func (entry archiveEntry) isRegular() bool {
+	return entry.mode.IsRegular() && !entry.isHardlink
+}
+
+// archiveWalkFunc is called for every entry of the archive, the content is only readable during the call.
+// Returning errStopWalk stops the walk without an error.
+type archiveWalkFunc func(entry archiveEntry, content io.Reader) error
+
+func ArchiveCopyWrapper(filter Filter, opts fsutils.CopyOptions, cache *SourceCache) CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		return CopyFromArchive(log, fs, from, to, filter, opts, cache)
+	}
+}
+
+// CopyFromArchive extracts the CodeModule archive `from` into the `to` folder, the entries are streamed from the archive directly into the target.
+// In case the Filter has a Technology, the manifest.json is read from the archive and only the selected files are extracted (and their md5 checksum verified).
+// Only the PreserveMetadata, Store and Resumable of the CopyOptions are considered, the archive is always extracted sequentially.
+func CopyFromArchive(log logr.Logger, fs afero.Afero, from, to string, filter Filter, opts fsutils.CopyOptions, cache *SourceCache) error {
+	log.Info("starting to extract archive", "from", from, "to", to, "technology", filter.Technology, "arch", filter.Arch)
+
+	oldUmask := unix.Umask(noPermissionsMask)
+	defer unix.Umask(oldUmask)
+
+	selected, err := selectArchiveFiles(log, fs, from, filter, cache)
+	if err != nil {
+		return err
+	}
+
+	opts = withThrottle(opts)
+
+	err = copyWithJournal(log, fs, to, opts, func(opts fsutils.CopyOptions) error {
+		extractor, err := newArchiveExtractor(log, fs, to, selected, opts)
+		if err != nil {
+			return err
+		}
+
+		err = walkArchive(fs, from, extractor.extract)
+		if err != nil {
+			return err
+		}
+
+		return extractor.finish(from)
+	})
+	if err != nil {
+		log.Error(err, "error extracting archive", "archive", from)
+
+		return err
+	}
+
+	logCopied(log, "successfully extracted archive", opts.Throttle, "from", from, "to", to)
+
+	return nil
+}
+
+// selectArchiveFiles returns the files (by their path in the archive) that the Filter selects from the manifest.json inside the archive.
+// In case the Filter has no Technology, nil is returned, meaning every entry is selected.
+func selectArchiveFiles(log logr.Logger, fs afero.Afero, from string, filter Filter, cache *SourceCache) (map[string]FileEntry, error) {
+	if filter.Technology == "" {
+		return nil, nil
+	}
+
+	index, err := cache.archiveIndex(fs, from)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestFile, err := index.readFile(manifestFileName)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to open manifest.json")
+	}
+
+	return selectManifestFiles(log, manifestFile, filter)
+}
+
+// selectManifestFiles returns the files (by their cleaned path) that the Filter selects from the content of the manifest.json.
+func selectManifestFiles(log logr.Logger, manifestFile []byte, filter Filter) (map[string]FileEntry, error) {
+	manifest, err := parseManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := selectFiles(log, manifest, strings.Split(filter.Technology, ","), splitArchs(filter.Arch), filter.IsStrict)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]FileEntry, len(files))
+
+	for _, file := range uniqueFiles(files) {
+		path, err := cleanArchivePath(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		selected[path] = file
+	}
+
+	return selected, nil
+}
+
+type archiveExtractor struct {
+	log      logr.Logger
+	fs       afero.Afero
+	selected map[string]FileEntry
+	// dirs are the dir entries of the archive, so the parent dirs of the extracted files get the same mode.
+	dirs map[string]archiveEntry
+	// symlinks are the extracted symlinks, entries are never extracted through them.
+	symlinks map[string]bool
+	// written are the extracted entries.
+	written map[string]bool
+	to      string
+	created []string
+	opts    fsutils.CopyOptions
+}
+
+func newArchiveExtractor(log logr.Logger, fs afero.Afero, to string, selected map[string]FileEntry, opts fsutils.CopyOptions) (*archiveExtractor, error) {
+	err := fs.MkdirAll(to, defaultArchiveDirMode)
+	if err != nil {
+		log.Error(err, "error creating target folder")
+
+		return nil, errors.WithStack(err)
+	}
+
+	return &archiveExtractor{
+		log:      log,
+		fs:       fs,
+		to:       to,
+		selected: selected,
+		opts:     opts,
+		dirs:     map[string]archiveEntry{},
+		symlinks: map[string]bool{},
+		written:  map[string]bool{},
+	}, nil
+}
+
+// finish makes sure that every selected file was extracted from the source, and restores the modification times of the dirs (in case of PreserveMetadata).
+func (e *archiveExtractor) finish(source string) error {
+	for _, path := range slices.Sorted(maps.Keys(e.selected)) {
+		if !e.written[path] {
+			return errors.Errorf("file %s of the manifest.json is missing from %s", path, source)
+		}
+	}
+
+	if e.opts.PreserveMetadata {
+		return e.restoreDirTimes()
+	}
+
+	return nil
+}
+
+func (e *archiveExtractor) extract(entry archiveEntry, content io.Reader) error {
+	if entry.mode.IsDir() {
+		e.dirs[entry.path] = entry
+
+		if _, isSelected := e.selected[entry.path]; e.selected != nil && !isSelected {
+			return nil
+		}
+
+		err := e.mkdirAll(entry.path)
+		if err != nil {
+			return err
+		}
+
+		e.written[entry.path] = true
+
+		// the dir could have been created already, as the parent of a previous entry
+		return errors.WithStack(e.fs.Chmod(filepath.Join(e.to, entry.path), entry.mode.Perm()))
+	}
+
+	file, isSelected := e.selected[entry.path]
+	if e.selected != nil && !isSelected {
+		e.log.V(1).Info("skipping entry of archive", "path", entry.path)
+
+		return nil
+	}
+
+	err := e.mkdirAll(filepath.Dir(entry.path))
+	if err != nil {
+		return err
+	}
+
+	targetPath := filepath.Join(e.to, entry.path)
+
+	if entry.mode&os.ModeSymlink == 0 {
+		err = e.removeSymlink(entry, targetPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case entry.isHardlink:
+		err = e.extractHardlink(entry, targetPath)
+	case entry.mode&os.ModeSymlink != 0:
+		err = e.extractSymlink(entry, targetPath)
+	case entry.isRegular():
+		err = e.extractFile(entry, content, targetPath, file.MD5)
+	default:
+		e.log.Info("skipping unsupported entry of archive", "path", entry.path, "mode", entry.mode)
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	e.written[entry.path] = true
+
+	return nil
+}
+
+// removeSymlink makes sure that the entry is never written through a symlink.
+// A symlink extracted from the archive must not be replaced by a later entry, an already existing one in the target (from a previous run) is removed.
+func (e *archiveExtractor) removeSymlink(entry archiveEntry, targetPath string) error {
+	if e.symlinks[entry.path] {
+		return errors.Errorf("entry %s of the archive would overwrite the extracted symlink", entry.path)
+	}
+
+	isSymlink, err := fsutils.IsSymlink(e.fs, targetPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !isSymlink {
+		return nil
+	}
+
+	e.log.Info("removing existing symlink in the target", "path", entry.path)
+
+	return errors.WithStack(e.fs.Remove(targetPath))
+}
+
+// extractFile writes the content of the entry to the targetPath, in case of a Journal it is skipped if a previous run already extracted it.
+func (e *archiveExtractor) extractFile(entry archiveEntry, content io.Reader, targetPath, expectedMD5 string) error {
+	if e.opts.Journal.IsDone(targetPath, entry.size, entry.modTime) {
+		e.log.V(1).Info("skipping already extracted file", "path", entry.path, "to", targetPath)
+
+		return nil
+	}
+
+	e.log.V(1).Info("extracting file", "path", entry.path, "to", targetPath, "mode", entry.mode)
+
+	content = e.opts.Throttle.Reader(content)
+
+	if e.opts.Store != "" {
+		checksum, err := fsutils.WriteFileToStore(e.fs, e.opts.Store, content, targetPath, entry.mode.Perm(), expectedMD5)
+		if err != nil {
+			return err
+		}
+
+		return e.opts.Journal.Done(targetPath, checksum, entry.size, entry.modTime)
+	}
+
+	if e.opts.Journal == nil {
+		err := fsutils.WriteFileWithMD5(e.fs, content, targetPath, entry.mode.Perm(), expectedMD5)
+		if err != nil {
+			return err
+		}
+
+		return e.keepModTime(entry, targetPath)
+	}
+
+	checksum, err := fsutils.WriteFileWithChecksum(e.fs, content, targetPath, entry.mode.Perm(), expectedMD5)
+	if err != nil {
+		return err
+	}
+
+	err = e.keepModTime(entry, targetPath)
+	if err != nil {
+		return err
+	}
+
+	return e.opts.Journal.Done(targetPath, checksum, entry.size, entry.modTime)
+}
+
+// keepModTime sets the modification time of the extracted file to the one of the entry, in case of PreserveMetadata.
+func (e *archiveExtractor) keepModTime(entry archiveEntry, targetPath string) error {
+	if !e.opts.PreserveMetadata {
+		return nil
+	}
+
+	return errors.WithStack(e.fs.Chtimes(targetPath, entry.modTime, entry.modTime))
+}
+
+// extractHardlink copies the already extracted original file, as the target might not support hardlinks.
+func (e *archiveExtractor) extractHardlink(entry archiveEntry, targetPath string) error {
+	if !e.written[entry.linkname] {
+		return errors.Errorf("original file %s of the hardlink %s was not extracted", entry.linkname, entry.path)
+	} else if e.symlinks[entry.linkname] {
+		return errors.Errorf("original file %s of the hardlink %s is a symlink", entry.linkname, entry.path)
+	}
+
+	e.log.V(1).Info("extracting hardlink as copy", "path", entry.path, "original", entry.linkname)
+	e.opts.Journal.Touch(targetPath)
+
+	return fsutils.CopyFileWithThrottle(e.fs, filepath.Join(e.to, entry.linkname), targetPath, e.opts.Throttle)
+}
+
+func (e *archiveExtractor) extractSymlink(entry archiveEntry, targetPath string) error {
+	// MemMapFs (used for testing) doesn't comply with the Linker interface
+	linker, ok := e.fs.Fs.(afero.Linker)
+	if !ok {
+		e.log.Info("symlinking not possible, skipping entry of archive", "path", entry.path)
+
+		return nil
+	}
+
+	e.log.V(1).Info("extracting symlink", "path", entry.path, "points-to", entry.linkname)
+
+	err := e.fs.Remove(targetPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	e.symlinks[entry.path] = true
+	e.opts.Journal.Touch(targetPath)
+
+	return errors.WithStack(linker.SymlinkIfPossible(entry.linkname, targetPath))
+}
+
+// mkdirAll creates the dir (relative to the root of the archive) and its parents, with the modes of their entries in the archive.
+func (e *archiveExtractor) mkdirAll(path string) error {
+	if path == "." || path == "" {
+		return nil
+	}
+
+	walkedPath := ""
+
+	for _, subPath := range strings.Split(path, string(filepath.Separator)) {
+		walkedPath = filepath.Join(walkedPath, subPath)
+
+		if e.symlinks[walkedPath] {
+			return errors.Errorf("entry %s of the archive points into the symlink %s", path, walkedPath)
+		}
+
+		mode := defaultArchiveDirMode
+		if dir, ok := e.dirs[walkedPath]; ok {
+			mode = dir.mode.Perm()
+		}
+
+		targetPath := filepath.Join(e.to, walkedPath)
+
+		err := e.fs.Mkdir(targetPath, mode)
+		if os.IsExist(err) {
+			err = e.checkExistingDir(walkedPath, targetPath)
+			if err != nil {
+				return err
+			}
+
+			continue
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		e.created = append(e.created, walkedPath)
+	}
+
+	return nil
+}
+
+// checkExistingDir makes sure that an already existing path in the target is a dir, and not a symlink (from a previous run) that entries would be extracted through.
+func (e *archiveExtractor) checkExistingDir(path, targetPath string) error {
+	info, err := fsutils.Lstat(e.fs, targetPath)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return errors.Errorf("%s already exists in the target, but is not a dir", path)
+	}
+
+	return nil
+}
+
+// restoreDirTimes sets the modification times of the created dirs, children first, so creating the children doesn't change it again.
+func (e *archiveExtractor) restoreDirTimes() error {
+	for i := len(e.created) - 1; i >= 0; i-- {
+		dir, ok := e.dirs[e.created[i]]
+		if !ok {
+			continue
+		}
+
+		err := e.fs.Chtimes(filepath.Join(e.to, dir.path), dir.modTime, dir.modTime)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// ArchiveSize returns the sum of the (uncompressed) sizes of the files that would be extracted from the archive, according to the Filter.
+func ArchiveSize(log logr.Logger, fs afero.Afero, from string, filter Filter, cache *SourceCache) (uint64, error) {
+	entries, _, err := listArchiveFiles(log, fs, from, filter, cache)
+	if err != nil {
+		return 0, err
+	}
+
+	var size uint64
+
+	for _, entry := range entries {
+		if entry.size > 0 {
+			size += uint64(entry.size)
+		}
+	}
+
+	return size, nil
+}
+
+// listArchiveFiles returns the regular files that would be extracted from the archive, according to the Filter, and the selected FileEntries of the manifest.json.
+func listArchiveFiles(log logr.Logger, fs afero.Afero, from string, filter Filter, cache *SourceCache) ([]archiveEntry, map[string]FileEntry, error) {
+	selected, err := selectArchiveFiles(log, fs, from, filter, cache)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index, err := cache.archiveIndex(fs, from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []archiveEntry
+
+	for _, entry := range index.entries {
+		if _, isSelected := selected[entry.path]; (selected == nil || isSelected) && entry.isRegular() {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, selected, nil
+}
+
+// archiveIndex is everything that is needed from an archive before (and after) extracting it, so it is decompressed only once for all of it.
+type archiveIndex struct {
+	path string
+	// files are the contents of the indexedArchiveFiles that are part of the archive.
+	files   map[string][]byte
+	entries []archiveEntry
+}
+
+// indexedArchiveFiles are read into the archiveIndex, as they are needed to select and verify the extracted files.
+var indexedArchiveFiles = []string{manifestFileName, InstallerVersionFilePath}
+
+// SourceCache keeps the archiveIndex of the archive (or image tarball) sources, so an archive is walked only once per run, instead of by every step that needs something from it.
+// The imageTree of an image source is kept as well, so its layers are only applied once.
+// It is created for a single run (see NewSourceCache) and passed down to everything that reads the source, so it goes away with the run. A nil SourceCache indexes the archive (and loads the imageTree) every time.
+type SourceCache struct {
+	indexes map[string]*archiveIndex
+	trees   map[imageTreeKey]*imageTree
+	mutex   sync.Mutex
+	// treesMutex is separate, as loading an imageTree indexes its tarball.
+	treesMutex sync.Mutex
+}
+
+func NewSourceCache() *SourceCache {
+	return &SourceCache{indexes: map[string]*archiveIndex{}, trees: map[imageTreeKey]*imageTree{}}
+}
+
+// archiveIndex returns the archiveIndex of the archive, it is only walked in case it was not indexed yet during this run.
+func (cache *SourceCache) archiveIndex(fs afero.Fs, archivePath string) (*archiveIndex, error) {
+	if cache == nil {
+		return indexArchive(fs, archivePath)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if index, ok := cache.indexes[archivePath]; ok {
+		return index, nil
+	}
+
+	index, err := indexArchive(fs, archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.indexes[archivePath] = index
+
+	return index, nil
+}
+
+// indexArchive walks the archive once, to collect everything that is needed from it before (and after) extracting it.
+func indexArchive(fs afero.Fs, archivePath string) (*archiveIndex, error) {
+	index := &archiveIndex{path: archivePath, files: map[string][]byte{}}
+
+	err := walkArchive(fs, archivePath, func(entry archiveEntry, content io.Reader) error {
+		index.entries = append(index.entries, entry)
+
+		if !entry.isRegular() || !slices.Contains(indexedArchiveFiles, entry.path) {
+			return nil
+		}
+
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		index.files[entry.path] = data
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// entry returns the last entry of the path, as it overwrites the previous ones when the archive is extracted.
+func (index *archiveIndex) entry(path string) (archiveEntry, bool) {
+	for _, entry := range slices.Backward(index.entries) {
+		if entry.path == path {
+			return entry, true
+		}
+	}
+
+	return archiveEntry{}, false
+}
+
+func (index *archiveIndex) readFile(path string) ([]byte, error) {
+	content, ok := index.files[path]
+	if !ok {
+		return nil, errors.Errorf("%s not found in the archive %s", path, index.path)
+	}
+
+	return content, nil
+}
+
+// readArchiveFile returns the content of a single file (by its path in the archive) from the archive.
+func readArchiveFile(fs afero.Fs, archivePath, path string, cache *SourceCache) ([]byte, error) {
+	if slices.Contains(indexedArchiveFiles, path) {
+		index, err := cache.archiveIndex(fs, archivePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return index.readFile(path)
+	}
+
+	var content []byte
+
+	err := walkArchive(fs, archivePath, func(entry archiveEntry, reader io.Reader) error {
+		if entry.path != path || !entry.isRegular() {
+			return nil
+		}
+
+		var err error
+
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errStopWalk
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if content == nil {
+		return nil, errors.Errorf("%s not found in the archive %s", path, archivePath)
+	}
+
+	return content, nil
+}
+
+// walkArchive calls the walk func for every (supported) entry of the archive, in the order they are stored in the archive.
+func walkArchive(fs afero.Fs, archivePath string, walk archiveWalkFunc) error {
+	file, err := fs.Open(archivePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	switch archiveExtension(archivePath) {
+	case ".zip":
+		err = walkZip(file, walk)
+	case ".tar.gz", ".tgz":
+		var gzipReader *gzip.Reader
+
+		gzipReader, err = gzip.NewReader(file)
+		if err != nil {
+			return errors.WithMessagef(err, "failed to open %s", archivePath)
+		}
+
+		defer func() { _ = gzipReader.Close() }()
+
+		err = walkTar(gzipReader, walk)
+	case ".tar":
+		err = walkTar(file, walk)
+	default:
+		return errors.Errorf("unsupported archive: %s", archivePath)
+	}
+
+	if errors.Is(err, errStopWalk) {
+		return nil
+	}
+
+	return err
+}
+
+func walkTar(reader io.Reader, walk archiveWalkFunc) error {
+	tarReader := tar.NewReader(reader)
+	seeker, isSeeker := reader.(io.Seeker)
+
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+
+		path, err := cleanArchivePath(header.Name)
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			continue
+		}
+
+		entry := archiveEntry{
+			path:    path,
+			mode:    header.FileInfo().Mode(),
+			size:    header.Size,
+			modTime: header.ModTime,
+		}
+
+		if isSeeker {
+			// the tar reader doesn't read ahead, so the content of the entry starts right here
+			entry.offset, err = seeker.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeLink:
+			entry.isHardlink = true
+
+			entry.linkname, err = cleanArchivePath(header.Linkname)
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			entry.linkname = header.Linkname
+		}
+
+		err = walk(entry, tarReader)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(file afero.File, walk archiveWalkFunc) error {
+	info, err := file.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	zipReader, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, zipFile := range zipReader.File {
+		path, err := cleanArchivePath(zipFile.Name)
+		if err != nil {
+			return err
+		}
+
+		if path == "" {
+			continue
+		}
+
+		entry := archiveEntry{
+			path:    path,
+			mode:    zipFile.Mode(),
+			size:    int64(zipFile.UncompressedSize64), //nolint:gosec // the size of a single file always fits into an int64
+			modTime: zipFile.Modified,
+		}
+
+		err = walkZipFile(zipFile, entry, walk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkZipFile(zipFile *zip.File, entry archiveEntry, walk archiveWalkFunc) error {
+	if entry.mode.IsDir() {
+		return walk(entry, nil)
+	}
+
+	content, err := zipFile.Open()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = content.Close() }()
+
+	if entry.mode&os.ModeSymlink != 0 {
+		linkname, err := io.ReadAll(content)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		entry.linkname = string(linkname)
+	}
+
+	return walk(entry, content)
+}
+
+// cleanArchivePath makes the path of an archive entry relative to the root of the archive, the root itself becomes "".
+// Paths that would point outside the root are rejected.
+func cleanArchivePath(name string) (string, error) {
+	path := filepath.Clean(filepath.FromSlash(name))
+	path = strings.TrimPrefix(path, string(filepath.Separator))
+
+	if path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("invalid path in archive: %s", name)
+	}
+
+	if path == "." {
+		return "", nil
+	}
+
+	return path, nil
+}
@@ -0,0 +1,388 @@
+package move
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testArchiveEntry struct {
+	name     string
+	content  string
+	linkname string
+	mode     int64
+	typeflag byte
+}
+
+const testArchiveManifest = `{
+	"version": "1.2.3",
+	"technologies": {
+		"java": {
+			"x86": [
+				{"path": "agent/lib64/java.so", "version": "1.2.3", "md5": "93f725a07423fe1c889f448b33d21f46"},
+				{"path": "agent/installer.version", "version": "1.2.3", "md5": "b0e8daa258acbb6fc4c86f89e0c9183e"}
+			]
+		},
+		"php": {
+			"x86": [
+				{"path": "agent/lib64/php.so", "version": "1.2.3", "md5": ""}
+			]
+		}
+	}
+}`
+
+func testArchiveEntries() []testArchiveEntry {
+	return []testArchiveEntry{
+		{name: "./", typeflag: tar.TypeDir, mode: 0755},
+		{name: "./manifest.json", content: testArchiveManifest, mode: 0644},
+		{name: "./agent/", typeflag: tar.TypeDir, mode: 0750},
+		{name: "./agent/installer.version", content: "1.2.3", mode: 0644},
+		{name: "./agent/lib64/", typeflag: tar.TypeDir, mode: 0700},
+		{name: "./agent/lib64/java.so", content: "java", mode: 0755},
+		{name: "./agent/lib64/php.so", content: "php", mode: 0755},
+	}
+}
+
+func createTestTar(t *testing.T, fs afero.Fs, path string, isGzipped bool, entries []testArchiveEntry) {
+	t.Helper()
+
+	require.NoError(t, afero.WriteFile(fs, path, testTar(t, isGzipped, entries), 0644))
+}
+
+func testTar(t *testing.T, isGzipped bool, entries []testArchiveEntry) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+
+	var gzipWriter *gzip.Writer
+
+	tarWriter := tar.NewWriter(&buffer)
+	if isGzipped {
+		gzipWriter = gzip.NewWriter(&buffer)
+		tarWriter = tar.NewWriter(gzipWriter)
+	}
+
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+
+		header := &tar.Header{
+			Name:     entry.name,
+			Mode:     entry.mode,
+			Size:     int64(len(entry.content)),
+			Typeflag: typeflag,
+			Linkname: entry.linkname,
+		}
+		if typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+
+		require.NoError(t, tarWriter.WriteHeader(header))
+
+		if typeflag == tar.TypeReg {
+			_, err := tarWriter.Write([]byte(entry.content))
+			require.NoError(t, err)
+		}
+	}
+
+	require.NoError(t, tarWriter.Close())
+
+	if gzipWriter != nil {
+		require.NoError(t, gzipWriter.Close())
+	}
+
+	return buffer.Bytes()
+}
+
+func createTestZip(t *testing.T, fs afero.Fs, path string, entries []testArchiveEntry) {
+	t.Helper()
+
+	var buffer bytes.Buffer
+
+	zipWriter := zip.NewWriter(&buffer)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+
+		mode := os.FileMode(entry.mode) //nolint:gosec // test modes are always valid
+		if entry.typeflag == tar.TypeDir {
+			mode |= os.ModeDir
+		}
+
+		header.SetMode(mode)
+
+		writer, err := zipWriter.CreateHeader(header)
+		require.NoError(t, err)
+
+		if entry.typeflag != tar.TypeDir {
+			_, err = writer.Write([]byte(entry.content))
+			require.NoError(t, err)
+		}
+	}
+
+	require.NoError(t, zipWriter.Close())
+	require.NoError(t, afero.WriteFile(fs, path, buffer.Bytes(), 0644))
+}
+
+func TestCopyFromArchive(t *testing.T) {
+	target := "/target"
+
+	assertContent := func(t *testing.T, fs afero.Afero, path, expected string) {
+		t.Helper()
+
+		content, err := fs.ReadFile(filepath.Join(target, path))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+
+	for _, archive := range []string{"/codemodule.tar", "/codemodule.tar.gz", "/codemodule.zip"} {
+		setup := func(t *testing.T) afero.Afero {
+			t.Helper()
+
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+			switch archiveExtension(archive) {
+			case ".zip":
+				createTestZip(t, fs, archive, testArchiveEntries())
+			default:
+				createTestTar(t, fs, archive, archiveExtension(archive) == ".tar.gz", testArchiveEntries())
+			}
+
+			return fs
+		}
+
+		t.Run(archive+" -> everything extracted", func(t *testing.T) {
+			fs := setup(t)
+
+			err := CopyFromArchive(testLog, fs, archive, target, Filter{}, fsutils.CopyOptions{}, nil)
+			require.NoError(t, err)
+
+			assertContent(t, fs, "agent/lib64/java.so", "java")
+			assertContent(t, fs, "agent/lib64/php.so", "php")
+			assertContent(t, fs, "manifest.json", testArchiveManifest)
+
+			info, err := fs.Stat(filepath.Join(target, "agent/lib64"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+			info, err = fs.Stat(filepath.Join(target, "agent/lib64/java.so"))
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+		})
+		t.Run(archive+" + technology -> only selected files extracted", func(t *testing.T) {
+			fs := setup(t)
+
+			err := CopyFromArchive(testLog, fs, archive, target, Filter{Technology: "java"}, fsutils.CopyOptions{}, nil)
+			require.NoError(t, err)
+
+			assertContent(t, fs, "agent/lib64/java.so", "java")
+			assertContent(t, fs, InstallerVersionFilePath, "1.2.3")
+
+			exists, err := fs.Exists(filepath.Join(target, "agent/lib64/php.so"))
+			require.NoError(t, err)
+			assert.False(t, exists)
+
+			exists, err = fs.Exists(filepath.Join(target, "manifest.json"))
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+
+	t.Run("checksum mismatch -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		entries := testArchiveEntries()
+		entries[5].content = "corrupted"
+		createTestTar(t, fs, "/codemodule.tar", false, entries)
+
+		err := CopyFromArchive(testLog, fs, "/codemodule.tar", target, Filter{Technology: "java"}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "checksum mismatch")
+	})
+	t.Run("file of manifest.json missing -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestTar(t, fs, "/codemodule.tar", false, testArchiveEntries()[:6])
+
+		err := CopyFromArchive(testLog, fs, "/codemodule.tar", target, Filter{Technology: "php"}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "is missing from /codemodule.tar")
+	})
+	t.Run("path outside of archive root -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestTar(t, fs, "/codemodule.tar", false, []testArchiveEntry{{name: "../evil.txt", content: "evil", mode: 0644}})
+
+		err := CopyFromArchive(testLog, fs, "/codemodule.tar", target, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "invalid path in archive")
+	})
+	t.Run("symlinks and hardlinks -> recreated", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		archive := filepath.Join(base, "codemodule.tar")
+		osTarget := filepath.Join(base, "target")
+
+		createTestTar(t, fs, archive, false, append(testArchiveEntries(),
+			testArchiveEntry{name: "./agent/lib64/current.so", linkname: "java.so", typeflag: tar.TypeSymlink},
+			testArchiveEntry{name: "./agent/lib64/java-copy.so", linkname: "./agent/lib64/java.so", typeflag: tar.TypeLink},
+		))
+
+		err := CopyFromArchive(testLog, fs, archive, osTarget, Filter{}, fsutils.CopyOptions{}, nil)
+		require.NoError(t, err)
+
+		linkTarget, err := os.Readlink(filepath.Join(osTarget, "agent/lib64/current.so"))
+		require.NoError(t, err)
+		assert.Equal(t, "java.so", linkTarget)
+
+		content, err := fs.ReadFile(filepath.Join(osTarget, "agent/lib64/java-copy.so"))
+		require.NoError(t, err)
+		assert.Equal(t, "java", string(content))
+	})
+	t.Run("entry through extracted symlink -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		archive := filepath.Join(base, "codemodule.tar")
+
+		createTestTar(t, fs, archive, false, []testArchiveEntry{
+			{name: "lib", linkname: "/etc", typeflag: tar.TypeSymlink},
+			{name: "lib/evil.conf", content: "evil", mode: 0644},
+		})
+
+		err := CopyFromArchive(testLog, fs, archive, filepath.Join(base, "target"), Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "points into the symlink")
+	})
+	t.Run("file over extracted symlink -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		archive := filepath.Join(base, "codemodule.tar")
+		outside := filepath.Join(base, "outside.conf")
+		require.NoError(t, fs.WriteFile(outside, []byte("outside"), 0644))
+
+		createTestTar(t, fs, archive, false, []testArchiveEntry{
+			{name: "evil.conf", linkname: outside, typeflag: tar.TypeSymlink},
+			{name: "evil.conf", content: "evil", mode: 0644},
+		})
+
+		err := CopyFromArchive(testLog, fs, archive, filepath.Join(base, "target"), Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "would overwrite the extracted symlink")
+
+		content, err := fs.ReadFile(outside)
+		require.NoError(t, err)
+		assert.Equal(t, "outside", string(content))
+	})
+	t.Run("hardlink to extracted symlink -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		archive := filepath.Join(base, "codemodule.tar")
+
+		createTestTar(t, fs, archive, false, []testArchiveEntry{
+			{name: "passwd", linkname: "/etc/passwd", typeflag: tar.TypeSymlink},
+			{name: "passwd-copy", linkname: "passwd", typeflag: tar.TypeLink},
+		})
+
+		err := CopyFromArchive(testLog, fs, archive, filepath.Join(base, "target"), Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "is a symlink")
+		assert.NoFileExists(t, filepath.Join(base, "target", "passwd-copy"))
+	})
+	t.Run("existing symlink in target -> replaced, not written through", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		archive := filepath.Join(base, "codemodule.tar")
+		osTarget := filepath.Join(base, "target")
+		outside := filepath.Join(base, "outside")
+
+		require.NoError(t, fs.MkdirAll(filepath.Join(outside, "agent"), 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(outside, "manifest.json"), []byte("outside"), 0644))
+		require.NoError(t, fs.MkdirAll(osTarget, 0755))
+		require.NoError(t, os.Symlink(filepath.Join(outside, "manifest.json"), filepath.Join(osTarget, "manifest.json")))
+
+		createTestTar(t, fs, archive, false, testArchiveEntries())
+
+		err := CopyFromArchive(testLog, fs, archive, osTarget, Filter{}, fsutils.CopyOptions{}, nil)
+		require.NoError(t, err)
+
+		isSymlink, err := fsutils.IsSymlink(fs, filepath.Join(osTarget, "manifest.json"))
+		require.NoError(t, err)
+		assert.False(t, isSymlink)
+
+		content, err := fs.ReadFile(filepath.Join(outside, "manifest.json"))
+		require.NoError(t, err)
+		assert.Equal(t, "outside", string(content))
+
+		require.NoError(t, os.Remove(filepath.Join(osTarget, "manifest.json")))
+		require.NoError(t, os.RemoveAll(filepath.Join(osTarget, "agent")))
+		require.NoError(t, os.Symlink(filepath.Join(outside, "agent"), filepath.Join(osTarget, "agent")))
+
+		err = CopyFromArchive(testLog, fs, archive, osTarget, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "is not a dir")
+		assert.NoFileExists(t, filepath.Join(outside, "agent", "installer.version"))
+	})
+}
+
+func TestArchiveSize(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	createTestTar(t, fs, "/codemodule.tar.gz", true, testArchiveEntries())
+
+	size, err := ArchiveSize(testLog, fs, "/codemodule.tar.gz", Filter{Technology: "java"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len("java")+len("1.2.3")), size)
+
+	size, err = ArchiveSize(testLog, fs, "/codemodule.tar.gz", Filter{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len("java")+len("php")+len("1.2.3")+len(testArchiveManifest)), size)
+}
+
+func TestSourceCache(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	createTestTar(t, fs, "/codemodule.tar.gz", true, testArchiveEntries())
+
+	cache := NewSourceCache()
+
+	index, err := cache.archiveIndex(fs, "/codemodule.tar.gz")
+	require.NoError(t, err)
+	assert.Len(t, index.entries, len(testArchiveEntries())-1)
+	assert.Equal(t, "1.2.3", string(index.files[InstallerVersionFilePath]))
+
+	t.Run("same cache -> index reused", func(t *testing.T) {
+		reused, err := cache.archiveIndex(fs, "/codemodule.tar.gz")
+		require.NoError(t, err)
+		assert.Same(t, index, reused)
+	})
+	t.Run("new cache -> indexed again", func(t *testing.T) {
+		createTestTar(t, fs, "/codemodule.tar.gz", true, testArchiveEntries()[:2])
+
+		changed, err := NewSourceCache().archiveIndex(fs, "/codemodule.tar.gz")
+		require.NoError(t, err)
+		assert.NotSame(t, index, changed)
+		assert.Len(t, changed.entries, 1)
+	})
+	t.Run("nil cache -> indexed every time", func(t *testing.T) {
+		var nilCache *SourceCache
+
+		first, err := nilCache.archiveIndex(fs, "/codemodule.tar.gz")
+		require.NoError(t, err)
+
+		second, err := nilCache.archiveIndex(fs, "/codemodule.tar.gz")
+		require.NoError(t, err)
+		assert.NotSame(t, first, second)
+	})
+}
+
+func TestVerifyTargetWrapperArchive(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	createTestZip(t, fs, "/codemodule.zip", testArchiveEntries())
+
+	filter := Filter{Technology: "java"}
+
+	require.NoError(t, CopyFromArchive(testLog, fs, "/codemodule.zip", "/target", filter, fsutils.CopyOptions{}, nil))
+	require.NoError(t, VerifyTargetWrapper(filter, nil)(testLog, fs, "/codemodule.zip", "/target"))
+
+	require.NoError(t, fs.WriteFile("/target/agent/lib64/java.so", []byte("JAVA"), 0755))
+	require.ErrorContains(t, VerifyTargetWrapper(filter, nil)(testLog, fs, "/codemodule.zip", "/target"), "checksum mismatch")
+}
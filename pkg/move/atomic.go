@@ -2,22 +2,88 @@ package move
 
 import (
 	"os"
+	"path/filepath"
 
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
+// ExistingTargetPolicy defines what the Atomic wrapper does, in case the target already exists (and is not empty).
+type ExistingTargetPolicy string
+
+const (
+	// ExistingTargetFail fails before copying anything.
+	ExistingTargetFail ExistingTargetPolicy = "fail"
+	// ExistingTargetSkip keeps the existing target as is, without copying.
+	ExistingTargetSkip ExistingTargetPolicy = "skip"
+	// ExistingTargetReplace copies into the work folder and then swaps it with the existing target.
+	ExistingTargetReplace ExistingTargetPolicy = "replace"
+	// ExistingTargetVerifyThenSkip keeps the existing target in case it passes the VerifyFunc, otherwise replaces it.
+	ExistingTargetVerifyThenSkip ExistingTargetPolicy = "verify-then-skip"
+
+	replacedSuffix = ".replaced"
+)
+
+// ParseExistingTargetPolicy validates the policy, empty means ExistingTargetFail.
+func ParseExistingTargetPolicy(policy string) (ExistingTargetPolicy, error) {
+	switch ExistingTargetPolicy(policy) {
+	case "":
+		return ExistingTargetFail, nil
+	case ExistingTargetFail, ExistingTargetSkip, ExistingTargetReplace, ExistingTargetVerifyThenSkip:
+		return ExistingTargetPolicy(policy), nil
+	default:
+		return "", errors.Errorf("unknown existing target policy: %s, must be one of: %s, %s, %s, %s", policy, ExistingTargetFail, ExistingTargetSkip, ExistingTargetReplace, ExistingTargetVerifyThenSkip)
+	}
+}
+
+// VerifyFunc checks if the already existing target matches the source, an error is returned in case it doesn't.
+type VerifyFunc func(log logr.Logger, fs afero.Afero, from, to string) error
+
 func Atomic(work string, copyFunc CopyFunc) CopyFunc {
+	return AtomicWithPolicy(work, ExistingTargetFail, nil, copyFunc)
+}
+
+// AtomicWithPolicy is the same as Atomic, but the ExistingTargetPolicy defines what happens in case the target already exists.
+// The verify func is only used in case of ExistingTargetVerifyThenSkip.
+func AtomicWithPolicy(work string, policy ExistingTargetPolicy, verify VerifyFunc, copyFunc CopyFunc) CopyFunc {
 	return func(log logr.Logger, fs afero.Afero, from, to string) (err error) {
-		log.Info("setting up atomic operation", "from", from, "to", to, "work", work)
+		log.Info("setting up atomic operation", "from", from, "to", to, "work", work, "on-existing-target", policy)
+
+		isTargetPopulated, err := IsPopulated(fs, to)
+		if err != nil {
+			log.Error(err, "failed to check the target")
+
+			return err
+		}
+
+		if isTargetPopulated {
+			isSkipped, err := handleExistingTarget(log, fs, from, to, policy, verify)
+			if err != nil || isSkipped {
+				return err
+			}
+		}
 
-		err = fs.RemoveAll(work)
+		isResumed, err := fsutils.HasJournal(fs, work)
 		if err != nil {
-			log.Error(err, "failed initial cleanup of workdir")
+			log.Error(err, "failed to check the workdir for a journal")
 
 			return err
 		}
 
+		if isResumed {
+			// a previous run was interrupted, the copy verifies and keeps what it already copied
+			log.Info("resuming the interrupted copy in the workdir", "work", work)
+		} else {
+			err = fs.RemoveAll(work)
+			if err != nil {
+				log.Error(err, "failed initial cleanup of workdir")
+
+				return err
+			}
+		}
+
 		err = fs.MkdirAll(work, os.ModePerm)
 		if err != nil {
 			log.Error(err, "failed to create the base workdir")
@@ -27,9 +93,7 @@ func Atomic(work string, copyFunc CopyFunc) CopyFunc {
 
 		defer func() {
 			if err != nil {
-				if cleanupErr := fs.RemoveAll(work); cleanupErr != nil {
-					log.Error(err, "failed cleanup of workdir after failure")
-				}
+				cleanupWorkAfterFailure(log, fs, work)
 			}
 		}()
 
@@ -40,7 +104,23 @@ func Atomic(work string, copyFunc CopyFunc) CopyFunc {
 			return err
 		}
 
-		err = fs.Rename(work, to)
+		// the copyFunc removes the journal once it succeeded, unless it doesn't support resuming
+		err = fs.Remove(filepath.Join(work, fsutils.JournalFileName))
+		if err != nil && !os.IsNotExist(err) {
+			log.Error(err, "failed to remove the journal")
+
+			return err
+		}
+
+		if isTargetPopulated {
+			err = replaceTarget(log, fs, work, to)
+		} else {
+			// an empty target dir is just in the way of the rename
+			_ = fs.Remove(to)
+
+			err = fs.Rename(work, to)
+		}
+
 		if err != nil {
 			log.Error(err, "error moving folder")
 
@@ -52,3 +132,93 @@ func Atomic(work string, copyFunc CopyFunc) CopyFunc {
 		return nil
 	}
 }
+
+// cleanupWorkAfterFailure removes the workdir, unless it has a journal (see fsutils.CopyOptions.Resumable), in that case it is kept so the next run resumes the copy.
+func cleanupWorkAfterFailure(log logr.Logger, fs afero.Afero, work string) {
+	isResumable, err := fsutils.HasJournal(fs, work)
+	if err == nil && isResumable {
+		log.Info("keeping the workdir after failure, so the next run resumes the copy", "work", work)
+
+		return
+	}
+
+	if cleanupErr := fs.RemoveAll(work); cleanupErr != nil {
+		log.Error(cleanupErr, "failed cleanup of workdir after failure")
+	}
+}
+
+// handleExistingTarget applies the ExistingTargetPolicy to the (not empty) target, returns true in case the copy should be skipped.
+func handleExistingTarget(log logr.Logger, fs afero.Afero, from, to string, policy ExistingTargetPolicy, verify VerifyFunc) (bool, error) {
+	switch policy {
+	case ExistingTargetSkip:
+		log.Info("target already exists, skipping copy", "target", to)
+
+		return true, nil
+	case ExistingTargetReplace:
+		log.Info("target already exists, replacing it", "target", to)
+
+		return false, nil
+	case ExistingTargetVerifyThenSkip:
+		if verify == nil {
+			return false, errors.Errorf("no verification provided for the existing target %s", to)
+		}
+
+		err := verify(log, fs, from, to)
+		if err != nil {
+			log.Info("target already exists, but failed verification, replacing it", "target", to, "reason", err.Error())
+
+			return false, nil
+		}
+
+		log.Info("target already exists and passed verification, skipping copy", "target", to)
+
+		return true, nil
+	default:
+		return false, errors.Errorf("target %s already exists and is not empty", to)
+	}
+}
+
+// replaceTarget swaps the (already populated) work folder with the existing target, so the target is never missing or partial.
+// In case the paths can't be exchanged atomically, the target is moved aside first, and moved back in case the work folder can't take its place.
+func replaceTarget(log logr.Logger, fs afero.Afero, work, to string) error {
+	err := fsutils.Exchange(fs, work, to)
+	if err == nil {
+		// the work folder now contains the old target
+		if err := fs.RemoveAll(work); err != nil {
+			log.Error(err, "failed to remove the replaced target", "path", work)
+		}
+
+		return nil
+	} else if !errors.Is(err, fsutils.ErrExchangeNotSupported) {
+		return err
+	}
+
+	log.V(1).Info("atomic exchange not supported, moving the target aside", "target", to)
+
+	replaced := to + replacedSuffix
+
+	err = fs.RemoveAll(replaced)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.Rename(to, replaced)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.Rename(work, to)
+	if err != nil {
+		if restoreErr := fs.Rename(replaced, to); restoreErr != nil {
+			log.Error(restoreErr, "failed to restore the replaced target", "path", replaced)
+		}
+
+		return errors.WithStack(err)
+	}
+
+	if err := fs.RemoveAll(replaced); err != nil {
+		log.Error(err, "failed to remove the replaced target", "path", replaced)
+	}
+
+	return nil
+}
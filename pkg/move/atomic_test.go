@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	"github.com/spf13/afero"
@@ -89,4 +90,196 @@ func TestAtomic(t *testing.T) {
 		require.NoError(t, err)
 		assert.False(t, exists)
 	})
+	t.Run("resumable copy fails -> work kept for the next run", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		require.NoError(t, fs.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644))
+
+		failingCopy := func(log logr.Logger, fs afero.Afero, from, to string) error {
+			err := SimpleCopyWrapper(fsutils.CopyOptions{Resumable: true})(log, fs, from, to)
+			require.NoError(t, err)
+
+			// the copy of the next file fails, so the journal is not finished yet
+			require.NoError(t, fs.WriteFile(filepath.Join(to, fsutils.JournalFileName), []byte{}, 0644))
+
+			return errors.New("some mock error")
+		}
+
+		err := Atomic(work, failingCopy)(testLog, fs, source, target)
+		require.Error(t, err)
+
+		exists, err := fs.Exists(filepath.Join(work, "a.txt"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = fs.DirExists(target)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("interrupted copy in work -> resumed, leftovers removed", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		require.NoError(t, fs.WriteFile(filepath.Join(source, "a.txt"), []byte("a"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, "b.txt"), []byte("b"), 0644))
+
+		// the previous run copied a.txt, but was killed before it finished
+		journal, err := fsutils.OpenJournal(testLog, fs, work)
+		require.NoError(t, err)
+		require.NoError(t, fsutils.CopyFiles(testLog, fs, []fsutils.FileCopy{{From: filepath.Join(source, "a.txt"), To: filepath.Join(work, "a.txt")}}, fsutils.CopyOptions{Journal: journal}))
+		require.NoError(t, journal.Close())
+		require.NoError(t, fs.WriteFile(filepath.Join(work, "leftover.txt"), []byte("leftover"), 0644))
+
+		atomicCopy := Atomic(work, SimpleCopyWrapper(fsutils.CopyOptions{Resumable: true}))
+
+		err = atomicCopy(testLog, fs, source, target)
+		require.NoError(t, err)
+
+		for _, name := range []string{"a.txt", "b.txt"} {
+			content, err := fs.ReadFile(filepath.Join(target, name))
+			require.NoError(t, err)
+			assert.Equal(t, name[:1], string(content))
+		}
+
+		for _, name := range []string{"leftover.txt", fsutils.JournalFileName} {
+			exists, err := fs.Exists(filepath.Join(target, name))
+			require.NoError(t, err)
+			assert.False(t, exists, name)
+		}
+
+		exists, err := fs.DirExists(work)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestAtomicWithPolicy(t *testing.T) {
+	source := "/source"
+	target := "/target"
+	work := "/work"
+
+	setupExistingTarget := func(t *testing.T, fs afero.Afero) {
+		t.Helper()
+
+		require.NoError(t, fs.MkdirAll(source, 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, "old.txt"), []byte("old"), 0644))
+	}
+
+	verifyFunc := func(err error) VerifyFunc {
+		return func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			return err
+		}
+	}
+
+	t.Run("existing target + fail -> error, target untouched", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupExistingTarget(t, fs)
+
+		err := AtomicWithPolicy(work, ExistingTargetFail, nil, mockCopyFuncWithAtomicCheck(t, work, true))(testLog, fs, source, target)
+		require.Error(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, "old.txt"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+	t.Run("existing target + skip -> no copy", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupExistingTarget(t, fs)
+
+		err := AtomicWithPolicy(work, ExistingTargetSkip, nil, mockCopyFuncWithAtomicCheck(t, work, true))(testLog, fs, source, target)
+		require.NoError(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, "old.txt"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = fs.Exists(filepath.Join(target, "test.txt"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("existing target + replace -> target replaced", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupExistingTarget(t, fs)
+
+		err := AtomicWithPolicy(work, ExistingTargetReplace, nil, mockCopyFuncWithAtomicCheck(t, work, true))(testLog, fs, source, target)
+		require.NoError(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, "old.txt"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		exists, err = fs.Exists(filepath.Join(target, "test.txt"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = fs.DirExists(target + replacedSuffix)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("existing target + replace + failed copy -> target untouched", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupExistingTarget(t, fs)
+
+		err := AtomicWithPolicy(work, ExistingTargetReplace, nil, mockCopyFuncWithAtomicCheck(t, work, false))(testLog, fs, source, target)
+		require.Error(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, "old.txt"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+	t.Run("existing target + verify-then-skip + verified -> no copy", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupExistingTarget(t, fs)
+
+		err := AtomicWithPolicy(work, ExistingTargetVerifyThenSkip, verifyFunc(nil), mockCopyFuncWithAtomicCheck(t, work, true))(testLog, fs, source, target)
+		require.NoError(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, "test.txt"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("existing target + verify-then-skip + not verified -> target replaced", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		setupExistingTarget(t, fs)
+
+		err := AtomicWithPolicy(work, ExistingTargetVerifyThenSkip, verifyFunc(errors.New("mismatch")), mockCopyFuncWithAtomicCheck(t, work, true))(testLog, fs, source, target)
+		require.NoError(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, "old.txt"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		exists, err = fs.Exists(filepath.Join(target, "test.txt"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+	t.Run("existing target + replace on real fs -> target exchanged", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		osTarget := filepath.Join(base, "target")
+		osWork := filepath.Join(base, "work")
+
+		require.NoError(t, fs.WriteFile(filepath.Join(base, "old.txt"), []byte("old"), 0644))
+		require.NoError(t, fs.MkdirAll(osTarget, 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(osTarget, "old.txt"), []byte("old"), 0644))
+
+		err := AtomicWithPolicy(osWork, ExistingTargetReplace, nil, mockCopyFuncWithAtomicCheck(t, osWork, true))(testLog, fs, base, osTarget)
+		require.NoError(t, err)
+
+		assert.NoFileExists(t, filepath.Join(osTarget, "old.txt"))
+		assert.FileExists(t, filepath.Join(osTarget, "test.txt"))
+		assert.NoDirExists(t, osWork)
+	})
+}
+
+func TestParseExistingTargetPolicy(t *testing.T) {
+	policy, err := ParseExistingTargetPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, ExistingTargetFail, policy)
+
+	policy, err = ParseExistingTargetPolicy("verify-then-skip")
+	require.NoError(t, err)
+	assert.Equal(t, ExistingTargetVerifyThenSkip, policy)
+
+	_, err = ParseExistingTargetPolicy("overwrite")
+	require.Error(t, err)
 }
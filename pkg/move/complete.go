@@ -0,0 +1,392 @@
+package move
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	// CompleteMarkerFileName is the name of the marker, it is put into the root of a target once the copy (and the "current" symlink) is done.
+	CompleteMarkerFileName = ".bootstrapper-complete"
+
+	digestPrefix = "sha256:"
+)
+
+// CompleteMarker states that the copy into the target is complete, the Digest is a tree hash of every file, dir and symlink of the target (besides the marker itself).
+// A target without a marker (or with one that fails VerifyCompleteMarker) can't be trusted, it might have been partially copied or changed afterwards.
+type CompleteMarker struct {
+	// Version is the version of the bootstrapper that did the copy.
+	Version string `json:"version"`
+	// Technologies are the technologies that were copied, empty means the whole source.
+	Technologies []string `json:"technologies,omitempty"`
+	Arch         string   `json:"arch,omitempty"`
+	// Files is the number of files (and symlinks) in the target.
+	Files  int    `json:"files"`
+	Digest string `json:"digest"`
+	// Entries are the files, dirs and symlinks of the target, so it can be verified without reading the files (see VerifyCompleteMarker).
+	Entries []CompleteEntry `json:"entries"`
+}
+
+// CompleteEntry is a file, dir or symlink (relative to the target), as it was when the CompleteMarker was written.
+type CompleteEntry struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size,omitempty"`
+	ModTime time.Time   `json:"modTime"`
+	// Link is what a symlink points to.
+	Link string `json:"link,omitempty"`
+}
+
+// WriteCompleteMarker computes the Files, Digest and Entries of the target and writes the marker into it.
+// The marker is written to a tmp file first, so it is never seen partially written.
+func WriteCompleteMarker(log logr.Logger, fs afero.Afero, target string, marker CompleteMarker) error {
+	digest, files, err := TreeDigest(fs, target)
+	if err != nil {
+		return err
+	}
+
+	entries, err := listCompleteEntries(fs, target)
+	if err != nil {
+		return err
+	}
+
+	marker.Digest = digest
+	marker.Files = files
+	marker.Entries = entries
+
+	content, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	markerPath := filepath.Join(target, CompleteMarkerFileName)
+	tmpPath := markerPath + ".tmp"
+
+	err = fs.WriteFile(tmpPath, content, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.Rename(tmpPath, markerPath)
+	if err != nil {
+		_ = fs.Remove(tmpPath)
+
+		return errors.WithStack(err)
+	}
+
+	log.Info("marked target as complete", "target", target, "files", files, "digest", digest)
+
+	return nil
+}
+
+// ReadCompleteMarker reads the marker of the target, without verifying it.
+func ReadCompleteMarker(fs afero.Afero, target string) (CompleteMarker, error) {
+	content, err := fs.ReadFile(filepath.Join(target, CompleteMarkerFileName))
+	if err != nil {
+		return CompleteMarker{}, errors.WithStack(err)
+	}
+
+	var marker CompleteMarker
+
+	err = json.Unmarshal(content, &marker)
+	if err != nil {
+		return CompleteMarker{}, errors.WithMessagef(err, "failed to parse %s", CompleteMarkerFileName)
+	}
+
+	return marker, nil
+}
+
+// VerifyCompleteMarker reads the marker of the target and checks that the files, dirs and symlinks of the target still match its Entries.
+// Only their metadata (mode, size, modification time and symlink target) is compared, so the files are not read, see VerifyCompleteDigest for that.
+func VerifyCompleteMarker(log logr.Logger, fs afero.Afero, target string) (CompleteMarker, error) {
+	marker, err := ReadCompleteMarker(fs, target)
+	if err != nil {
+		return CompleteMarker{}, err
+	}
+
+	entries, err := listCompleteEntries(fs, target)
+	if err != nil {
+		return CompleteMarker{}, err
+	}
+
+	if len(entries) != len(marker.Entries) {
+		return CompleteMarker{}, errors.Errorf("target %s doesn't match its %s: expected %d entries, got %d entries", target, CompleteMarkerFileName, len(marker.Entries), len(entries))
+	}
+
+	for i, entry := range entries {
+		if !entry.equal(marker.Entries[i]) {
+			return CompleteMarker{}, errors.Errorf("target %s doesn't match its %s: %s changed", target, CompleteMarkerFileName, entry.Path)
+		}
+	}
+
+	log.V(1).Info("verified the complete marker of the target", "target", target, "entries", len(entries))
+
+	return marker, nil
+}
+
+// VerifyCompleteDigest is the same as VerifyCompleteMarker, but also checks the Files and Digest of the marker, which reads every file of the target.
+func VerifyCompleteDigest(log logr.Logger, fs afero.Afero, target string) (CompleteMarker, error) {
+	marker, err := VerifyCompleteMarker(log, fs, target)
+	if err != nil {
+		return CompleteMarker{}, err
+	}
+
+	digest, files, err := TreeDigest(fs, target)
+	if err != nil {
+		return CompleteMarker{}, err
+	}
+
+	if files != marker.Files || digest != marker.Digest {
+		return CompleteMarker{}, errors.Errorf("target %s doesn't match its %s: expected %d files with digest %s, got %d files with digest %s", target, CompleteMarkerFileName, marker.Files, marker.Digest, files, digest)
+	}
+
+	log.V(1).Info("verified the digest of the target", "target", target, "digest", digest)
+
+	return marker, nil
+}
+
+func (entry CompleteEntry) equal(other CompleteEntry) bool {
+	return entry.Path == other.Path && entry.Mode == other.Mode && entry.Size == other.Size && entry.ModTime.Equal(other.ModTime) && entry.Link == other.Link
+}
+
+// listCompleteEntries lists the files, dirs and symlinks of the root folder (in order of their paths), the complete marker in the root folder is ignored.
+func listCompleteEntries(fs afero.Afero, root string) ([]CompleteEntry, error) {
+	return appendCompleteEntries(fs, root, "", nil)
+}
+
+func appendCompleteEntries(fs afero.Afero, root, dir string, entries []CompleteEntry) ([]CompleteEntry, error) {
+	infos, err := fs.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, info := range infos {
+		if dir == "" && info.Name() == CompleteMarkerFileName {
+			continue
+		}
+
+		entry := CompleteEntry{Path: filepath.Join(dir, info.Name()), Mode: info.Mode(), ModTime: info.ModTime()}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Link, err = readSymlink(fs, filepath.Join(root, entry.Path))
+			if err != nil {
+				return nil, err
+			}
+		case !info.IsDir():
+			entry.Size = info.Size()
+		}
+
+		entries = append(entries, entry)
+
+		if info.IsDir() {
+			entries, err = appendCompleteEntries(fs, root, entry.Path, entries)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// CompleteVerifyWrapper returns a VerifyFunc for a target that already has a valid complete marker (see IsComplete), so its files don't have to be verified one by one.
+// It checks that the marker has the same Technologies and Arch as the expected one, and that the installer.version of the target matches the one of the source.
+// In case of isDigestVerified, the Digest of the marker is verified as well (see VerifyCompleteDigest), which reads every file of the target.
+func CompleteVerifyWrapper(expected CompleteMarker, image ImageOptions, isDigestVerified bool, cache *SourceCache) VerifyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		sourceVersion, err := ReadSourceFile(log, fs, from, InstallerVersionFilePath, image, cache)
+		if err != nil {
+			return errors.WithMessage(err, "failed to read the installer.version of the source")
+		}
+
+		return CompleteVersionVerifyWrapper(expected, string(sourceVersion), isDigestVerified)(log, fs, from, to)
+	}
+}
+
+// CompleteVersionVerifyWrapper is the same as CompleteVerifyWrapper, but the installer.version of the target is compared with the provided version instead of the source,
+// for example as the source is not downloaded yet. An empty version is not compared.
+func CompleteVersionVerifyWrapper(expected CompleteMarker, version string, isDigestVerified bool) VerifyFunc {
+	return func(log logr.Logger, fs afero.Afero, _, to string) error {
+		var (
+			marker CompleteMarker
+			err    error
+		)
+
+		if isDigestVerified {
+			marker, err = VerifyCompleteDigest(log, fs, to)
+		} else {
+			marker, err = ReadCompleteMarker(fs, to)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !isSameSelection(marker.Technologies, expected.Technologies) || (len(expected.Technologies) > 0 && !isSameSelection(splitArchs(marker.Arch), splitArchs(expected.Arch))) {
+			return errors.Errorf("target %s was copied for the technologies %v and arch %s", to, marker.Technologies, marker.Arch)
+		}
+
+		if version == "" {
+			return nil
+		}
+
+		return verifyInstallerVersion(fs, []byte(version), to)
+	}
+}
+
+// isSameSelection compares the (trimmed) technologies or architectures, regardless of their order.
+func isSameSelection(a, b []string) bool {
+	normalize := func(values []string) []string {
+		normalized := make([]string, 0, len(values))
+		for _, value := range values {
+			normalized = append(normalized, strings.TrimSpace(value))
+		}
+
+		slices.Sort(normalized)
+
+		return slices.Compact(normalized)
+	}
+
+	return slices.Equal(normalize(a), normalize(b))
+}
+
+// UnmarkedCopyWrapper removes the CompleteMarker from the `to` folder before copying into it, as the marker is stale once the copy changed something.
+// The isCopied is set in case the copy happened (it doesn't for example in case of ExistingTargetSkip), so the caller knows that the marker has to be written again.
+func UnmarkedCopyWrapper(isCopied *bool, copyFunc CopyFunc) CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		*isCopied = true
+
+		err := RemoveCompleteMarker(fs, to)
+		if err != nil {
+			return err
+		}
+
+		return copyFunc(log, fs, from, to)
+	}
+}
+
+// RemoveCompleteMarker removes the marker of the target (if present), has to be done before changing an already complete target.
+func RemoveCompleteMarker(fs afero.Afero, target string) error {
+	err := fs.Remove(filepath.Join(target, CompleteMarkerFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// TreeDigest computes a Merkle tree hash of the root folder: the hash of a dir covers the type, permissions, name and hash of each of its children (in order of their names).
+// Files are hashed by their content and symlinks by what they point to, the complete marker in the root folder is ignored.
+// Returns the digest and the number of files (and symlinks).
+func TreeDigest(fs afero.Afero, root string) (string, int, error) {
+	sum, files, err := hashDir(fs, root, true)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return digestPrefix + hex.EncodeToString(sum), files, nil
+}
+
+func hashDir(fs afero.Afero, dir string, isRoot bool) ([]byte, int, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	hasher := sha256.New()
+	files := 0
+
+	for _, entry := range entries {
+		if isRoot && entry.Name() == CompleteMarkerFileName {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		var (
+			entryType byte
+			sum       []byte
+		)
+
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			entryType = 'l'
+			sum, err = hashSymlink(fs, path)
+			files++
+		case entry.IsDir():
+			var dirFiles int
+
+			entryType = 'd'
+			sum, dirFiles, err = hashDir(fs, path, false)
+			files += dirFiles
+		default:
+			entryType = 'f'
+			sum, err = hashFile(fs, path)
+			files++
+		}
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		_, _ = fmt.Fprintf(hasher, "%c %04o %s %x\n", entryType, entry.Mode().Perm(), entry.Name(), sum)
+	}
+
+	return hasher.Sum(nil), files, nil
+}
+
+func hashFile(fs afero.Afero, path string) ([]byte, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	hasher := sha256.New()
+
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+func hashSymlink(fs afero.Afero, path string) ([]byte, error) {
+	linkTarget, err := readSymlink(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(linkTarget))
+
+	return sum[:], nil
+}
+
+func readSymlink(fs afero.Afero, path string) (string, error) {
+	linkReader, ok := fs.Fs.(afero.LinkReader)
+	if !ok {
+		return "", errors.Errorf("can't read the symlink %s", path)
+	}
+
+	linkTarget, err := linkReader.ReadlinkIfPossible(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return linkTarget, nil
+}
@@ -0,0 +1,177 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompleteMarker(t *testing.T) {
+	target := "/target"
+
+	setupTarget := func(t *testing.T) afero.Afero {
+		t.Helper()
+
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile(filepath.Join(target, InstallerVersionFilePath), []byte("1.2.3"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, "agent/lib64/java.so"), []byte("java"), 0755))
+
+		return fs
+	}
+
+	t.Run("written marker -> verified", func(t *testing.T) {
+		fs := setupTarget(t)
+
+		err := WriteCompleteMarker(testLog, fs, target, CompleteMarker{Version: "1.0.0", Technologies: []string{"java"}})
+		require.NoError(t, err)
+
+		marker, err := VerifyCompleteMarker(testLog, fs, target)
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.0", marker.Version)
+		assert.Equal(t, []string{"java"}, marker.Technologies)
+		assert.Equal(t, 2, marker.Files)
+		assert.Contains(t, marker.Digest, digestPrefix)
+		assert.Len(t, marker.Entries, 4)
+
+		_, err = VerifyCompleteDigest(testLog, fs, target)
+		require.NoError(t, err)
+
+		exists, err := fs.Exists(filepath.Join(target, CompleteMarkerFileName+".tmp"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("changed target -> not verified", func(t *testing.T) {
+		changes := map[string]func(fs afero.Afero) error{
+			"content": func(fs afero.Afero) error {
+				return fs.WriteFile(filepath.Join(target, "agent/lib64/java.so"), []byte("JAVA"), 0755)
+			},
+			"mode": func(fs afero.Afero) error {
+				return fs.Chmod(filepath.Join(target, "agent/lib64/java.so"), 0644)
+			},
+			"added file": func(fs afero.Afero) error {
+				return fs.WriteFile(filepath.Join(target, "agent/lib64/php.so"), []byte("php"), 0755)
+			},
+			"removed file": func(fs afero.Afero) error {
+				return fs.Remove(filepath.Join(target, "agent/lib64/java.so"))
+			},
+			"added dir": func(fs afero.Afero) error {
+				return fs.Mkdir(filepath.Join(target, "agent/lib"), 0755)
+			},
+		}
+
+		for name, change := range changes {
+			t.Run(name, func(t *testing.T) {
+				fs := setupTarget(t)
+				require.NoError(t, WriteCompleteMarker(testLog, fs, target, CompleteMarker{}))
+
+				require.NoError(t, change(fs))
+
+				_, err := VerifyCompleteMarker(testLog, fs, target)
+				require.Error(t, err)
+			})
+		}
+	})
+	t.Run("changed content with same size and modification time -> only the digest is not verified", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := t.TempDir()
+		path := filepath.Join(target, "agent/lib64/java.so")
+
+		require.NoError(t, fs.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, fs.WriteFile(path, []byte("java"), 0755))
+		require.NoError(t, WriteCompleteMarker(testLog, fs, target, CompleteMarker{}))
+
+		info, err := fs.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, fs.WriteFile(path, []byte("JAVA"), 0755))
+		require.NoError(t, fs.Chtimes(path, info.ModTime(), info.ModTime()))
+
+		_, err = VerifyCompleteMarker(testLog, fs, target)
+		require.NoError(t, err)
+
+		_, err = VerifyCompleteDigest(testLog, fs, target)
+		require.Error(t, err)
+	})
+	t.Run("missing marker -> not verified", func(t *testing.T) {
+		fs := setupTarget(t)
+
+		_, err := VerifyCompleteMarker(testLog, fs, target)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("same content in another folder -> same digest", func(t *testing.T) {
+		fs := setupTarget(t)
+		require.NoError(t, fs.WriteFile("/other/"+InstallerVersionFilePath, []byte("1.2.3"), 0644))
+		require.NoError(t, fs.WriteFile("/other/agent/lib64/java.so", []byte("java"), 0755))
+		require.NoError(t, WriteCompleteMarker(testLog, fs, target, CompleteMarker{}))
+
+		digest, files, err := TreeDigest(fs, "/other")
+		require.NoError(t, err)
+
+		marker, err := ReadCompleteMarker(fs, target)
+		require.NoError(t, err)
+		assert.Equal(t, marker.Digest, digest)
+		assert.Equal(t, marker.Files, files)
+	})
+}
+
+func TestCompleteVerifyWrapper(t *testing.T) {
+	source := "/source"
+	target := "/target"
+
+	setupTarget := func(t *testing.T, marker CompleteMarker) afero.Afero {
+		t.Helper()
+
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile(filepath.Join(source, InstallerVersionFilePath), []byte("1.2.3"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, InstallerVersionFilePath), []byte("1.2.3\n"), 0644))
+		require.NoError(t, WriteCompleteMarker(testLog, fs, target, marker))
+
+		return fs
+	}
+
+	t.Run("same technologies and version -> verified", func(t *testing.T) {
+		fs := setupTarget(t, CompleteMarker{Technologies: []string{"java", "php"}, Arch: "x86,musl"})
+
+		verifyFunc := CompleteVerifyWrapper(CompleteMarker{Technologies: []string{"php", "java"}, Arch: "musl, x86"}, ImageOptions{}, true, nil)
+		require.NoError(t, verifyFunc(testLog, fs, source, target))
+	})
+	t.Run("other technologies or arch -> not verified", func(t *testing.T) {
+		fs := setupTarget(t, CompleteMarker{Technologies: []string{"java"}, Arch: "x86"})
+
+		verifyFunc := CompleteVerifyWrapper(CompleteMarker{Technologies: []string{"java", "php"}, Arch: "x86"}, ImageOptions{}, false, nil)
+		require.Error(t, verifyFunc(testLog, fs, source, target))
+
+		verifyFunc = CompleteVerifyWrapper(CompleteMarker{Technologies: []string{"java"}, Arch: "arm"}, ImageOptions{}, false, nil)
+		require.Error(t, verifyFunc(testLog, fs, source, target))
+	})
+	t.Run("other version -> not verified", func(t *testing.T) {
+		fs := setupTarget(t, CompleteMarker{})
+		require.NoError(t, fs.WriteFile(filepath.Join(source, InstallerVersionFilePath), []byte("1.2.4"), 0644))
+
+		verifyFunc := CompleteVerifyWrapper(CompleteMarker{}, ImageOptions{}, false, nil)
+		require.ErrorContains(t, verifyFunc(testLog, fs, source, target), "installer.version mismatch")
+	})
+}
+
+func TestUnmarkedCopyWrapper(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	require.NoError(t, fs.WriteFile("/target/file.txt", []byte("content"), 0644))
+	require.NoError(t, WriteCompleteMarker(testLog, fs, "/target", CompleteMarker{}))
+
+	isCopied := false
+	copyFunc := UnmarkedCopyWrapper(&isCopied, func(_ logr.Logger, fs afero.Afero, _, to string) error {
+		exists, err := fs.Exists(filepath.Join(to, CompleteMarkerFileName))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		return nil
+	})
+
+	require.NoError(t, copyFunc(testLog, fs, "/source", "/target"))
+	assert.True(t, isCopied)
+}
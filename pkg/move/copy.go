@@ -1,14 +1,19 @@
 package move
 
 import (
+	"fmt"
+
 	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 	"golang.org/x/sys/unix"
 )
 
 const (
 	noPermissionsMask = 0000
+
+	bytesPerMiB = 1024 * 1024
 )
 
 type CopyFunc func(log logr.Logger, fs afero.Afero, from, to string) error
@@ -16,19 +21,102 @@ type CopyFunc func(log logr.Logger, fs afero.Afero, from, to string) error
 var _ CopyFunc = SimpleCopy
 
 func SimpleCopy(log logr.Logger, fs afero.Afero, from, to string) error {
-	log.Info("starting to copy (simple)", "from", from, "to", to)
+	return simpleCopy(log, fs, from, to, fsutils.CopyOptions{})
+}
+
+// SimpleCopyWrapper creates a CopyFunc that copies the same way as SimpleCopy, but according to the provided CopyOptions.
+func SimpleCopyWrapper(opts fsutils.CopyOptions) CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		return simpleCopy(log, fs, from, to, opts)
+	}
+}
+
+func simpleCopy(log logr.Logger, fs afero.Afero, from, to string, opts fsutils.CopyOptions) error {
+	log.Info("starting to copy (simple)", "from", from, "to", to, "concurrency", opts.Concurrency)
+
+	opts = withThrottle(opts)
 
 	oldUmask := unix.Umask(noPermissionsMask)
 	defer unix.Umask(oldUmask)
 
-	err := fsutils.CopyFolder(log, fs, from, to)
+	err := copyWithJournal(log, fs, to, opts, func(opts fsutils.CopyOptions) error {
+		return fsutils.CopyFolderWithOptions(log, fs, from, to, opts)
+	})
 	if err != nil {
 		log.Error(err, "error moving folder")
 
 		return err
 	}
 
-	log.Info("successfully copied (simple)", "from", from, "to", to)
+	logCopied(log, "successfully copied (simple)", opts.Throttle, "from", from, "to", to)
 
 	return nil
 }
+
+// withThrottle makes sure the CopyOptions have a Throttle (limited according to their BytesPerSecond), so the copied bytes can be logged once the copy is done.
+func withThrottle(opts fsutils.CopyOptions) fsutils.CopyOptions {
+	if opts.Throttle == nil {
+		opts.Throttle = fsutils.NewThrottle(opts.BytesPerSecond)
+	}
+
+	return opts
+}
+
+// logCopied logs the message together with the bytes read through the Throttle and their effective throughput.
+// Links are not read, so in case nothing was read, the throughput is left out instead of logging 0.
+func logCopied(log logr.Logger, msg string, throttle *fsutils.Throttle, keysAndValues ...any) {
+	keysAndValues = append(keysAndValues, "bytes", throttle.Bytes())
+	if throttle.Bytes() > 0 {
+		keysAndValues = append(keysAndValues, "throughput", fmt.Sprintf("%.1f MiB/s", throttle.BytesPerSecond()/bytesPerMiB))
+	}
+
+	log.Info(msg, keysAndValues...)
+}
+
+// copyWithJournal calls the copy with a Journal of the `to` folder, in case the CopyOptions are Resumable, so a copy that was interrupted (for example the process was killed) is resumed by the next run.
+// The journal is kept in case the copy fails, and removed (together with the leftovers of a previous run) once it succeeded.
+// A layer of an image is only verified once it was extracted, in case it doesn't match its digest the journal is discarded, so nothing extracted from it is resumed.
+func copyWithJournal(log logr.Logger, fs afero.Afero, to string, opts fsutils.CopyOptions, copyFunc func(opts fsutils.CopyOptions) error) error {
+	if !opts.Resumable {
+		return copyFunc(opts)
+	}
+
+	journal, err := fsutils.OpenJournal(log, fs, to)
+	if err != nil {
+		return err
+	}
+
+	opts.Journal = journal
+
+	err = copyFunc(opts)
+	if errors.Is(err, errDigestMismatch) {
+		if discardErr := journal.Discard(); discardErr != nil {
+			log.Error(discardErr, "failed to discard the journal", "path", to)
+		}
+
+		return err
+	} else if err != nil {
+		if closeErr := journal.Close(); closeErr != nil {
+			log.Error(closeErr, "failed to close the journal", "path", to)
+		}
+
+		return err
+	}
+
+	if !opts.PreserveMetadata {
+		return journal.Finish()
+	}
+
+	// removing the journal changes the modification time of the (already restored) `to` folder
+	info, err := fs.Stat(to)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = journal.Finish()
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(fs.Chtimes(to, info.ModTime(), info.ModTime()))
+}
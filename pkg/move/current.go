@@ -1,42 +1,133 @@
 package move
 
 import (
+	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
 	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/symlink"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
 const (
 	InstallerVersionFilePath = "agent/installer.version"
 	currentDir               = "agent/bin/current"
+	binDir                   = "agent/bin"
 )
 
+// versionPattern is what a version has to look like, so it can safely be used as the name of the agent/bin/<version> dir.
+var versionPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z._+-]*$`)
+
 // CreateCurrentSymlink finds the version of the CodeModule in the `targetDir` (in the installer.version file) and creates a "current" symlink in the agent/bin folder that points to the agent/bin/<version> subfolder.
 // this is needed for the nginx use-case.
+// An existing "current" symlink is replaced in case it is dangling or points to a different version (for example after an upgrade into the same target), a "current" dir (that is not a symlink) is kept.
+// In case the agent/bin/<version> dir is missing (for example it was left out by the --technology or --exclude), symlinking is skipped.
 func CreateCurrentSymlink(log logr.Logger, fs afero.Afero, targetDir string) error {
 	targetCurrentDir := filepath.Join(targetDir, currentDir)
 
-	exists, err := fs.Exists(targetCurrentDir)
-	if exists {
+	isSymlink, err := isSymlinkOrMissing(fs, targetCurrentDir)
+	if err != nil {
+		log.Info("failed to check the state of the current version dir", "current version dir", targetCurrentDir)
+
+		return err
+	} else if !isSymlink {
 		log.Info("the current version dir already exists, skipping symlinking", "current version dir", targetCurrentDir)
 
+		return nil
+	}
+
+	version, err := ReadInstallerVersion(fs, targetDir)
+	if err != nil {
+		log.Info("failed to get the version from the filesystem", "version-file", filepath.Join(targetDir, InstallerVersionFilePath))
+
+		return err
+	}
+
+	versionDir := filepath.Join(targetDir, binDir, version)
+
+	info, err := fs.Stat(versionDir)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("the dir of the version is missing, skipping symlinking", "version dir", versionDir)
+
 		return nil
 	} else if err != nil {
-		log.Info("failed to check the state of the current version dir", "current version dir", targetCurrentDir)
+		return errors.WithMessagef(err, "the current symlink can't point to the dir of version %s", version)
+	} else if !info.IsDir() {
+		return errors.Errorf("the current symlink can't point to %s, as it is not a dir", versionDir)
+	}
+
+	return replaceVersionSymlink(log, fs, targetCurrentDir, version, versionDir)
+}
 
+// replaceVersionSymlink points the symlink to the linkTarget (relative to the dir of the symlink), which resolves to the versionDir.
+// Nothing is done in case the symlink already points to the versionDir.
+func replaceVersionSymlink(log logr.Logger, fs afero.Afero, symlinkPath, linkTarget, versionDir string) error {
+	isUpToDate, err := isSymlinkUpToDate(fs, symlinkPath, versionDir)
+	if err != nil {
 		return err
+	} else if isUpToDate {
+		log.Info("the symlink already points to the version, skipping symlinking", "symlink", symlinkPath, "points-to", versionDir)
+
+		return nil
 	}
 
-	versionFilePath := filepath.Join(targetDir, InstallerVersionFilePath)
+	return symlink.Replace(log, fs.Fs, linkTarget, symlinkPath)
+}
 
-	version, err := fs.ReadFile(versionFilePath)
+// ReadInstallerVersion reads the version from the installer.version file of the `targetDir`, without the surrounding whitespace (for example a trailing newline).
+// The version is validated, so it can be used as the name of a dir.
+func ReadInstallerVersion(fs afero.Afero, targetDir string) (string, error) {
+	content, err := fs.ReadFile(filepath.Join(targetDir, InstallerVersionFilePath))
 	if err != nil {
-		log.Info("failed to get the version from the filesystem", "version-file", versionFilePath)
+		return "", errors.WithStack(err)
+	}
 
-		return err
+	version := strings.TrimSpace(string(content))
+
+	return version, ValidateVersion(version)
+}
+
+// ValidateVersion makes sure the version is not empty, and only contains characters that are safe to be used as the name of a dir (so it can't point outside of the agent/bin folder).
+func ValidateVersion(version string) error {
+	if !versionPattern.MatchString(version) || version == filepath.Base(currentDir) {
+		return errors.Errorf("invalid version %q in %s", version, InstallerVersionFilePath)
+	}
+
+	return nil
+}
+
+// isSymlinkOrMissing checks if the path (for example the "current" dir) is either missing or a symlink, so it can be (re)created.
+func isSymlinkOrMissing(fs afero.Afero, path string) (bool, error) {
+	info, err := fsutils.Lstat(fs, path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return info.Mode()&os.ModeSymlink != 0, nil
+}
+
+// isSymlinkUpToDate checks if the symlink exists and points to the versionDir.
+func isSymlinkUpToDate(fs afero.Afero, symlinkPath, versionDir string) (bool, error) {
+	exists, err := fs.Exists(symlinkPath)
+	if err != nil || !exists {
+		// a dangling symlink doesn't "exist", as it is followed
+		return false, errors.WithStack(err)
+	}
+
+	linkTarget, err := readLink(fs, symlinkPath)
+	if err != nil {
+		return false, err
+	}
+
+	if !filepath.IsAbs(linkTarget) {
+		linkTarget = filepath.Join(filepath.Dir(symlinkPath), linkTarget)
 	}
 
-	return symlink.Create(log, fs.Fs, string(version), targetCurrentDir)
+	return filepath.Clean(linkTarget) == filepath.Clean(versionDir), nil
 }
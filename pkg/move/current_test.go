@@ -1,11 +1,15 @@
 package move
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestCreateCurrentSymlink(t *testing.T) {
@@ -15,6 +19,7 @@ func TestCreateCurrentSymlink(t *testing.T) {
 	t.Run("no fail if version file exists", func(t *testing.T) {
 		fs := afero.Afero{Fs: afero.NewMemMapFs()}
 		_ = fs.WriteFile(filepath.Join(testPath, InstallerVersionFilePath), []byte(expectedVersion), 0644)
+		_ = fs.MkdirAll(filepath.Join(testPath, binDir, expectedVersion), 0755)
 
 		err := CreateCurrentSymlink(testLog, fs, testPath)
 		require.NoError(t, err)
@@ -34,4 +39,103 @@ func TestCreateCurrentSymlink(t *testing.T) {
 		err := CreateCurrentSymlink(testLog, fs, testPath)
 		require.Error(t, err)
 	})
+
+	t.Run("no fail if version dir is missing", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		_ = fs.WriteFile(filepath.Join(testPath, InstallerVersionFilePath), []byte(expectedVersion), 0644)
+
+		err := CreateCurrentSymlink(testLog, fs, testPath)
+		require.NoError(t, err)
+	})
+
+	t.Run("fail if version is invalid", func(t *testing.T) {
+		for _, version := range []string{"", "\n", "../..", "1.2.3/../../etc", "current", "1.2 3"} {
+			fs := afero.Afero{Fs: afero.NewMemMapFs()}
+			_ = fs.WriteFile(filepath.Join(testPath, InstallerVersionFilePath), []byte(version), 0644)
+
+			err := CreateCurrentSymlink(testLog, fs, testPath)
+			require.Error(t, err, version)
+		}
+	})
+
+	setupTarget := func(t *testing.T, versions ...string) (afero.Afero, string) {
+		t.Helper()
+
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := t.TempDir()
+
+		for _, version := range versions {
+			require.NoError(t, fs.MkdirAll(filepath.Join(target, binDir, version), 0755))
+		}
+
+		// the installer.version usually ends with a newline
+		require.NoError(t, fs.WriteFile(filepath.Join(target, InstallerVersionFilePath), []byte(expectedVersion+"\n"), 0644))
+
+		return fs, target
+	}
+
+	assertCurrent := func(t *testing.T, target string) {
+		t.Helper()
+
+		linkTarget, err := os.Readlink(filepath.Join(target, currentDir))
+		require.NoError(t, err)
+		assert.Equal(t, expectedVersion, linkTarget)
+
+		tmpLinks, err := filepath.Glob(filepath.Join(target, binDir, ".current*"))
+		require.NoError(t, err)
+		assert.Empty(t, tmpLinks)
+	}
+
+	t.Run("missing symlink -> created without trailing newline", func(t *testing.T) {
+		fs, target := setupTarget(t, expectedVersion)
+
+		require.NoError(t, CreateCurrentSymlink(testLog, fs, target))
+
+		assertCurrent(t, target)
+	})
+	t.Run("dangling symlink -> repaired", func(t *testing.T) {
+		fs, target := setupTarget(t, expectedVersion)
+		require.NoError(t, os.Symlink(expectedVersion+"\n", filepath.Join(target, currentDir)))
+
+		require.NoError(t, CreateCurrentSymlink(testLog, fs, target))
+
+		assertCurrent(t, target)
+	})
+	t.Run("symlink to old version -> replaced", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.0.0", expectedVersion)
+		require.NoError(t, os.Symlink("1.0.0", filepath.Join(target, currentDir)))
+		// leftovers of previous runs, that were killed before renaming the tmp symlink
+		stale := time.Now().Add(-time.Hour)
+
+		for _, leftover := range []string{".current.tmp", ".current.0123456789abcdef.tmp"} {
+			leftoverPath := filepath.Join(target, binDir, leftover)
+			require.NoError(t, os.Symlink("1.0.0", leftoverPath))
+			require.NoError(t, unix.Lutimes(leftoverPath, []unix.Timeval{unix.NsecToTimeval(stale.UnixNano()), unix.NsecToTimeval(stale.UnixNano())}))
+		}
+
+		require.NoError(t, CreateCurrentSymlink(testLog, fs, target))
+
+		assertCurrent(t, target)
+	})
+	t.Run("recent tmp symlink -> kept for the concurrent process", func(t *testing.T) {
+		fs, target := setupTarget(t, "1.0.0", expectedVersion)
+		recentPath := filepath.Join(target, binDir, ".current.0123456789abcdef.tmp")
+		require.NoError(t, os.Symlink("1.0.0", recentPath))
+
+		require.NoError(t, CreateCurrentSymlink(testLog, fs, target))
+
+		_, err := os.Lstat(recentPath)
+		require.NoError(t, err)
+	})
+	t.Run("symlink to version -> kept", func(t *testing.T) {
+		fs, target := setupTarget(t, expectedVersion)
+		absoluteVersionDir := filepath.Join(target, binDir, expectedVersion)
+		require.NoError(t, os.Symlink(absoluteVersionDir, filepath.Join(target, currentDir)))
+
+		require.NoError(t, CreateCurrentSymlink(testLog, fs, target))
+
+		linkTarget, err := os.Readlink(filepath.Join(target, currentDir))
+		require.NoError(t, err)
+		assert.Equal(t, absoluteVersionDir, linkTarget)
+	})
 }
@@ -0,0 +1,239 @@
+package move
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/lock"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+var versionSeparators = regexp.MustCompile(`[.\-_]`)
+
+type versionDir struct {
+	path    string
+	version string
+}
+
+// RemoveOldVersions removes the sibling version dirs of the target (dirs next to it, that contain an installer.version), so only the `keep` newest versions remain.
+// The target itself is always kept, the dirs are ordered by their installer.version.
+// A dir is never removed in case it is locked by another bootstrapper, or it is referenced by a symlink next to it (for example a "current" symlink).
+func RemoveOldVersions(log logr.Logger, fs afero.Afero, target string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	target = filepath.Clean(target)
+	parent := filepath.Dir(target)
+
+	versionDirs, symlinkTargets, err := listVersionDirs(fs, parent)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range selectOldVersions(log, versionDirs, symlinkTargets, target, keep) {
+		err := removeVersionDir(log, fs, dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PlanOldVersions returns the sibling version dirs of the target that RemoveOldVersions would remove, once the target (with the targetVersion) is in place.
+// The locks of the dirs are not considered.
+func PlanOldVersions(log logr.Logger, fs afero.Afero, target, targetVersion string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	target = filepath.Clean(target)
+	parent := filepath.Dir(target)
+
+	isParentPresent, err := fs.DirExists(parent)
+	if err != nil || !isParentPresent {
+		return nil, errors.WithStack(err)
+	}
+
+	versionDirs, symlinkTargets, err := listVersionDirs(fs, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	versionDirs = slices.DeleteFunc(versionDirs, func(dir versionDir) bool {
+		return dir.path == target
+	})
+	versionDirs = append(versionDirs, versionDir{path: target, version: targetVersion})
+
+	var removed []string
+	for _, dir := range selectOldVersions(log, versionDirs, symlinkTargets, target, keep) {
+		removed = append(removed, dir.path)
+	}
+
+	return removed, nil
+}
+
+// selectOldVersions returns the version dirs that should be removed, so only the `keep` newest versions (and the target) remain.
+func selectOldVersions(log logr.Logger, versionDirs []versionDir, symlinkTargets []string, target string, keep int) []versionDir {
+	// newest first
+	sort.SliceStable(versionDirs, func(i, j int) bool {
+		return CompareVersions(versionDirs[i].version, versionDirs[j].version) > 0
+	})
+
+	var (
+		kept    int
+		oldDirs []versionDir
+	)
+
+	for _, dir := range versionDirs {
+		switch {
+		case dir.path == target:
+			log.V(1).Info("keeping version of the target", "path", dir.path, "version", dir.version)
+		case kept < keep:
+			log.V(1).Info("keeping version", "path", dir.path, "version", dir.version)
+		case isReferenced(dir.path, symlinkTargets):
+			log.Info("keeping old version, as it is referenced by a symlink", "path", dir.path, "version", dir.version)
+		default:
+			oldDirs = append(oldDirs, dir)
+
+			continue
+		}
+
+		kept++
+	}
+
+	return oldDirs
+}
+
+// listVersionDirs returns the dirs in the parent that contain an installer.version, and the (absolute) paths the symlinks in the parent point to.
+func listVersionDirs(fs afero.Afero, parent string) ([]versionDir, []string, error) {
+	entries, err := fs.ReadDir(parent)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var (
+		versionDirs    []versionDir
+		symlinkTargets []string
+	)
+
+	for _, entry := range entries {
+		path := filepath.Join(parent, entry.Name())
+
+		info, err := fsutils.Lstat(fs, path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			linkTarget, err := readLink(fs, path)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			symlinkTargets = append(symlinkTargets, linkTarget)
+
+			continue
+		}
+
+		if !info.IsDir() || strings.HasPrefix(entry.Name(), ".") || strings.HasSuffix(entry.Name(), replacedSuffix) {
+			continue
+		}
+
+		version, err := fs.ReadFile(filepath.Join(path, InstallerVersionFilePath))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		versionDirs = append(versionDirs, versionDir{path: path, version: strings.TrimSpace(string(version))})
+	}
+
+	return versionDirs, symlinkTargets, nil
+}
+
+func readLink(fs afero.Afero, path string) (string, error) {
+	linkReader, ok := fs.Fs.(afero.LinkReader)
+	if !ok {
+		return "", errors.Errorf("reading symlinks is not supported: %s", path)
+	}
+
+	linkTarget, err := linkReader.ReadlinkIfPossible(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if !filepath.IsAbs(linkTarget) {
+		linkTarget = filepath.Join(filepath.Dir(path), linkTarget)
+	}
+
+	return filepath.Clean(linkTarget), nil
+}
+
+func isReferenced(path string, symlinkTargets []string) bool {
+	for _, linkTarget := range symlinkTargets {
+		if linkTarget == path || strings.HasPrefix(linkTarget, path+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeVersionDir removes the dir (and its lock file) while holding its lock, so a bootstrapper that is (re)copying it is not interrupted.
+func removeVersionDir(log logr.Logger, fs afero.Afero, dir versionDir) error {
+	dirLock, _, err := lock.Acquire(log, fs.Fs, dir.path, 0)
+	if errors.Is(err, lock.ErrTimeout) {
+		log.Info("keeping old version, as it is locked by another process", "path", dir.path, "version", dir.version)
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer func() { _ = dirLock.Release() }()
+
+	log.Info("removing old version", "path", dir.path, "version", dir.version)
+
+	err = fs.RemoveAll(dir.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// the lock file would be left behind otherwise, a process that is waiting for it locks a new one instead
+	return dirLock.Remove()
+}
+
+// CompareVersions compares 2 versions (for example 1.311.70.20250101-123456) segment by segment, numeric segments are compared as numbers.
+// Returns a negative number in case a < b, 0 in case they are equal and a positive number in case a > b.
+func CompareVersions(a, b string) int {
+	aSegments := versionSeparators.Split(a, -1)
+	bSegments := versionSeparators.Split(b, -1)
+
+	for i := 0; i < len(aSegments) && i < len(bSegments); i++ {
+		aNumber, aErr := strconv.ParseUint(aSegments[i], 10, 64)
+		bNumber, bErr := strconv.ParseUint(bSegments[i], 10, 64)
+
+		result := strings.Compare(aSegments[i], bSegments[i])
+		if aErr == nil && bErr == nil {
+			result = cmp.Compare(aNumber, bNumber)
+		}
+
+		if result != 0 {
+			return result
+		}
+	}
+
+	return len(aSegments) - len(bSegments)
+}
@@ -0,0 +1,91 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/lock"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveOldVersions(t *testing.T) {
+	setupVersions := func(t *testing.T, fs afero.Afero, base string, versions ...string) {
+		t.Helper()
+
+		for _, version := range versions {
+			require.NoError(t, fs.MkdirAll(filepath.Join(base, version, "agent"), 0755))
+			require.NoError(t, fs.WriteFile(filepath.Join(base, version, InstallerVersionFilePath), []byte(version+"\n"), 0644))
+		}
+	}
+
+	assertDirs := func(t *testing.T, fs afero.Afero, base string, expected map[string]bool) {
+		t.Helper()
+
+		for dir, isExpected := range expected {
+			exists, err := fs.DirExists(filepath.Join(base, dir))
+			require.NoError(t, err)
+			assert.Equal(t, isExpected, exists, dir)
+		}
+	}
+
+	t.Run("keep 2 -> oldest versions removed", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		base := "/bins"
+		setupVersions(t, fs, base, "1.9.0", "1.10.0", "1.2.3", "1.11.0")
+		require.NoError(t, fs.MkdirAll(filepath.Join(base, "not-a-version"), 0755))
+
+		err := RemoveOldVersions(testLog, fs, filepath.Join(base, "1.11.0"), 2)
+		require.NoError(t, err)
+
+		assertDirs(t, fs, base, map[string]bool{"1.11.0": true, "1.10.0": true, "1.9.0": false, "1.2.3": false, "not-a-version": true})
+	})
+	t.Run("older target -> target is always kept", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		base := "/bins"
+		setupVersions(t, fs, base, "1.2.3", "1.2.4", "1.2.5")
+
+		err := RemoveOldVersions(testLog, fs, filepath.Join(base, "1.2.3"), 1)
+		require.NoError(t, err)
+
+		assertDirs(t, fs, base, map[string]bool{"1.2.5": true, "1.2.4": false, "1.2.3": true})
+	})
+	t.Run("keep 0 -> nothing removed", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		base := "/bins"
+		setupVersions(t, fs, base, "1.2.3", "1.2.4")
+
+		err := RemoveOldVersions(testLog, fs, filepath.Join(base, "1.2.4"), 0)
+		require.NoError(t, err)
+
+		assertDirs(t, fs, base, map[string]bool{"1.2.4": true, "1.2.3": true})
+	})
+	t.Run("referenced by symlink or locked -> kept", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		setupVersions(t, fs, base, "1.2.1", "1.2.2", "1.2.3", "1.2.4")
+		require.NoError(t, os.Symlink("1.2.1", filepath.Join(base, "current")))
+
+		otherLock, _, err := lock.Acquire(testLog, fs.Fs, filepath.Join(base, "1.2.2"), 0)
+		require.NoError(t, err)
+
+		defer func() { _ = otherLock.Release() }()
+
+		err = RemoveOldVersions(testLog, fs, filepath.Join(base, "1.2.4"), 1)
+		require.NoError(t, err)
+
+		assertDirs(t, fs, base, map[string]bool{"1.2.4": true, "1.2.3": false, "1.2.2": true, "1.2.1": true})
+		assert.NoFileExists(t, lock.FilePath(filepath.Join(base, "1.2.3")))
+		assert.FileExists(t, lock.FilePath(filepath.Join(base, "1.2.2")))
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, CompareVersions("1.2.3", "1.2.3"))
+	assert.Negative(t, CompareVersions("1.9.0", "1.10.0"))
+	assert.Positive(t, CompareVersions("1.311.70.20250101-123456", "1.311.70.20241231-235959"))
+	assert.Positive(t, CompareVersions("1.2.3.1", "1.2.3"))
+	assert.Negative(t, CompareVersions("1.2.a", "1.2.b"))
+}
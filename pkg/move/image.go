@@ -0,0 +1,854 @@
+package move
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultImagePath is where the CodeModule is located in the dynatrace-codemodules image.
+	DefaultImagePath = "/opt/dynatrace/oneagent"
+
+	ociLayoutFile      = "oci-layout"
+	ociIndexFile       = "index.json"
+	dockerManifestFile = "manifest.json"
+	dockerReposFile    = "repositories"
+
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerIndex = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	errDigestMismatch = errors.New("digest mismatch")
+)
+
+// ImageOptions defines which part of which image of an OCI image layout (or docker save tarball) is copied.
+type ImageOptions struct {
+	// Platform is the os/architecture[/variant] of the image, for example linux/arm64, empty means the platform the bootstrapper runs on.
+	Platform string
+	// Path is the absolute path of the CodeModule inside the image, empty means DefaultImagePath.
+	Path string
+}
+
+func (opts ImageOptions) platform() platform {
+	if opts.Platform == "" {
+		return platform{OS: "linux", Architecture: runtime.GOARCH}
+	}
+
+	parts := strings.SplitN(opts.Platform, "/", 3)
+
+	result := platform{OS: parts[0]}
+	if len(parts) > 1 {
+		result.Architecture = parts[1]
+	}
+
+	if len(parts) > 2 {
+		result.Variant = parts[2]
+	}
+
+	return result
+}
+
+func (opts ImageOptions) path() string {
+	imagePath := opts.Path
+	if imagePath == "" {
+		imagePath = DefaultImagePath
+	}
+
+	return strings.TrimPrefix(filepath.Clean(imagePath), string(filepath.Separator))
+}
+
+type platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p platform) matches(other platform) bool {
+	return p.OS == other.OS && p.Architecture == other.Architecture && (p.Variant == "" || other.Variant == "" || p.Variant == other.Variant)
+}
+
+type descriptor struct {
+	Platform  *platform `json:"platform,omitempty"`
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+}
+
+type ociIndex struct {
+	Manifests []descriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Config descriptor   `json:"config"`
+	Layers []descriptor `json:"layers"`
+}
+
+type dockerManifest struct {
+	Config string   `json:"Config"`
+	Layers []string `json:"Layers"`
+}
+
+// dockerConfig is the image config of a docker save, the diff ids are the digests of its uncompressed layers.
+type dockerConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	platform
+}
+
+// imageLayer is a layer of the image, by its path relative to the root of the layout, and the digest it is verified against (if known).
+type imageLayer struct {
+	path   string
+	digest string
+	// isDiffID means the digest is the one of the uncompressed layer (docker save), instead of the one of the blob (OCI image layout).
+	isDiffID bool
+}
+
+// imageLayout provides the files of an OCI image layout or docker save tarball, by their path relative to its root.
+type imageLayout interface {
+	withFile(name string, read func(reader io.Reader) error) error
+}
+
+type dirLayout struct {
+	fs   afero.Fs
+	root string
+}
+
+func (layout dirLayout) withFile(name string, read func(reader io.Reader) error) error {
+	file, err := layout.fs.Open(filepath.Join(layout.root, name))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return read(file)
+}
+
+type tarLayout struct {
+	fs    afero.Fs
+	index *archiveIndex
+}
+
+// withFile reads the file directly at its offset in case of an uncompressed tarball, so the tarball is not read again for every file.
+func (layout tarLayout) withFile(name string, read func(reader io.Reader) error) error {
+	name = filepath.Clean(name)
+
+	entry, isFound := layout.index.entry(name)
+	if !isFound || !entry.isRegular() {
+		return errors.Wrapf(os.ErrNotExist, "%s not found in %s", name, layout.index.path)
+	}
+
+	if content, ok := layout.index.files[name]; ok {
+		return read(bytes.NewReader(content))
+	}
+
+	if entry.offset == 0 {
+		return layout.walkToFile(name, read)
+	}
+
+	file, err := layout.fs.Open(layout.index.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return read(io.NewSectionReader(file, entry.offset, entry.size))
+}
+
+// walkToFile reads the file from a compressed tarball, which has to be decompressed up to the file.
+func (layout tarLayout) walkToFile(name string, read func(reader io.Reader) error) error {
+	isFound := false
+
+	err := walkArchive(layout.fs, layout.index.path, func(entry archiveEntry, content io.Reader) error {
+		if entry.path != name || !entry.isRegular() {
+			return nil
+		}
+
+		isFound = true
+
+		err := read(content)
+		if err != nil {
+			return err
+		}
+
+		return errStopWalk
+	})
+	if err != nil {
+		return err
+	}
+
+	if !isFound {
+		return errors.Wrapf(os.ErrNotExist, "%s not found in %s", name, layout.index.path)
+	}
+
+	return nil
+}
+
+// imageEntry is an entry of the final filesystem of the image, and the index of the layer it is taken from.
+type imageEntry struct {
+	entry archiveEntry
+	layer int
+}
+
+// imageTree is the CodeModule subtree of the final filesystem of the image, after applying all its layers.
+type imageTree struct {
+	layout imageLayout
+	// entries are relative to the CodeModule path inside the image.
+	entries map[string]imageEntry
+	// files are the contents of the indexedArchiveFiles of the final filesystem, relative to the CodeModule path inside the image.
+	files  map[string][]byte
+	source string
+	// subtree is the CodeModule path inside the image, without the leading separator.
+	subtree string
+	layers  []imageLayer
+}
+
+// imageTreeKey identifies the imageTree in the SourceCache, the same source can be loaded for another platform or CodeModule path.
+type imageTreeKey struct {
+	image ImageOptions
+	path  string
+}
+
+// IsImage checks if the path points to an OCI image layout directory, or a tarball of one (or of a docker save).
+func IsImage(fs afero.Afero, path string, cache *SourceCache) bool {
+	isDir, err := fs.IsDir(path)
+	if err != nil {
+		return false
+	}
+
+	if isDir {
+		exists, _ := fs.Exists(filepath.Join(path, ociLayoutFile))
+
+		return exists
+	}
+
+	if archiveExtension(path) == ".zip" || !IsArchive(path) {
+		return false
+	}
+
+	index, err := cache.archiveIndex(fs, path)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range index.entries {
+		if entry.path == ociLayoutFile || entry.path == dockerReposFile {
+			return true
+		}
+	}
+
+	// the manifest.json of a docker save is a list, the one of a CodeModule is an object
+	return bytes.HasPrefix(bytes.TrimSpace(index.files[dockerManifestFile]), []byte("["))
+}
+
+func ImageCopyWrapper(image ImageOptions, filter Filter, opts fsutils.CopyOptions, cache *SourceCache) CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		return CopyFromImage(log, fs, from, to, image, filter, opts, cache)
+	}
+}
+
+// CopyFromImage copies the CodeModule from an image (OCI image layout directory, or a tarball of one or of a docker save) into the `to` folder.
+// The image for the platform is resolved from the local files only, its layers are applied in order (including whiteouts), and only the files at the path of the CodeModule are extracted.
+// The Filter is applied the same way as for CopyByTechnology, using the manifest.json of the CodeModule inside the image.
+func CopyFromImage(log logr.Logger, fs afero.Afero, from, to string, image ImageOptions, filter Filter, opts fsutils.CopyOptions, cache *SourceCache) error {
+	log.Info("starting to copy from image", "from", from, "to", to, "platform", image.platform(), "path", image.path(), "technology", filter.Technology)
+
+	oldUmask := unix.Umask(noPermissionsMask)
+	defer unix.Umask(oldUmask)
+
+	tree, err := loadImageTree(log, fs, from, image, cache)
+	if err != nil {
+		return err
+	}
+
+	selected, err := tree.selectFiles(log, filter)
+	if err != nil {
+		return err
+	}
+
+	opts = withThrottle(opts)
+
+	err = copyWithJournal(log, fs, to, opts, func(opts fsutils.CopyOptions) error {
+		extractor, err := newArchiveExtractor(log, fs, to, selected, opts)
+		if err != nil {
+			return err
+		}
+
+		err = tree.extract(extractor)
+		if err != nil {
+			return err
+		}
+
+		return extractor.finish(from)
+	})
+	if err != nil {
+		log.Error(err, "error extracting image", "image", from)
+
+		return err
+	}
+
+	logCopied(log, "successfully copied from image", opts.Throttle, "from", from, "to", to)
+
+	return nil
+}
+
+// ImageSize returns the sum of the sizes of the files that would be copied from the image, according to the Filter.
+func ImageSize(log logr.Logger, fs afero.Afero, from string, image ImageOptions, filter Filter, cache *SourceCache) (uint64, error) {
+	tree, err := loadImageTree(log, fs, from, image, cache)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, _, err := tree.listFiles(log, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	var size uint64
+
+	for _, entry := range entries {
+		if entry.size > 0 {
+			size += uint64(entry.size)
+		}
+	}
+
+	return size, nil
+}
+
+// VerifyImageTargetWrapper returns a VerifyFunc that checks the target against the files the Filter selects from the image.
+func VerifyImageTargetWrapper(image ImageOptions, filter Filter, cache *SourceCache) VerifyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		tree, err := loadImageTree(log, fs, from, image, cache)
+		if err != nil {
+			return err
+		}
+
+		entries, selected, err := tree.listFiles(log, filter)
+		if err != nil {
+			return err
+		}
+
+		sourceVersion, err := tree.readFile(InstallerVersionFilePath)
+		if err != nil {
+			return errors.WithMessage(err, "failed to read the installer.version of the source")
+		}
+
+		return verifyExtractedTarget(log, fs, to, sourceVersion, entries, selected)
+	}
+}
+
+// listFiles returns the regular files that would be copied from the image, according to the Filter, and the selected FileEntries of the manifest.json.
+func (tree *imageTree) listFiles(log logr.Logger, filter Filter) ([]archiveEntry, map[string]FileEntry, error) {
+	selected, err := tree.selectFiles(log, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []archiveEntry
+
+	for _, path := range slices.Sorted(maps.Keys(tree.entries)) {
+		entry := tree.entries[path].entry
+		if _, isSelected := selected[path]; (selected == nil || isSelected) && entry.isRegular() {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, selected, nil
+}
+
+// loadImageTree returns the imageTree of the image, its layers are only applied in case it was not loaded yet during this run.
+func loadImageTree(log logr.Logger, fs afero.Afero, from string, image ImageOptions, cache *SourceCache) (*imageTree, error) {
+	if cache == nil {
+		return newImageTreeFrom(log, fs, from, image, nil)
+	}
+
+	key := imageTreeKey{path: from, image: image}
+
+	cache.treesMutex.Lock()
+	defer cache.treesMutex.Unlock()
+
+	if tree, ok := cache.trees[key]; ok {
+		return tree, nil
+	}
+
+	tree, err := newImageTreeFrom(log, fs, from, image, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.trees[key] = tree
+
+	return tree, nil
+}
+
+// newImageTreeFrom opens the layout of the image (directory or tarball) and applies its layers.
+func newImageTreeFrom(log logr.Logger, fs afero.Afero, from string, image ImageOptions, cache *SourceCache) (*imageTree, error) {
+	info, err := fs.Stat(from)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var layout imageLayout = dirLayout{fs: fs.Fs, root: from}
+
+	if !info.IsDir() {
+		index, err := cache.archiveIndex(fs, from)
+		if err != nil {
+			return nil, err
+		}
+
+		layout = tarLayout{fs: fs.Fs, index: index}
+	}
+
+	return newImageTree(log, layout, from, image)
+}
+
+func newImageTree(log logr.Logger, layout imageLayout, from string, image ImageOptions) (*imageTree, error) {
+	layers, err := resolveLayers(log, layout, image.platform())
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &imageTree{
+		layout:  layout,
+		layers:  layers,
+		entries: map[string]imageEntry{},
+		files:   map[string][]byte{},
+		source:  from,
+		subtree: image.path(),
+	}
+
+	// only the headers (and the indexedArchiveFiles) are read here, the digests are verified while extracting
+	for i, layer := range layers {
+		err := tree.walkLayer(layer, false, func(entry archiveEntry, content io.Reader) error {
+			return tree.apply(i, entry, content)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(tree.entries) == 0 {
+		return nil, errors.Errorf("path %s not found in the image %s", image.path(), from)
+	}
+
+	log.Info("resolved image", "image", from, "layers", len(layers), "entries", len(tree.entries))
+
+	return tree, nil
+}
+
+// apply adds the entry of the layer to the tree, in case it is inside the subtree, or removes the entries it whites out.
+// The content of the indexedArchiveFiles is kept, so they can be read without walking the layer again.
+func (tree *imageTree) apply(layer int, entry archiveEntry, content io.Reader) error {
+	dir, name := filepath.Split(entry.path)
+
+	switch {
+	case name == opaqueWhiteout:
+		tree.remove(filepath.Clean(dir), layer, false)
+
+		return nil
+	case strings.HasPrefix(name, whiteoutPrefix):
+		tree.remove(filepath.Join(dir, strings.TrimPrefix(name, whiteoutPrefix)), layer, true)
+
+		return nil
+	}
+
+	relativePath, ok := relativeToSubtree(entry.path, tree.subtree)
+	if !ok {
+		return nil
+	}
+
+	if !entry.mode.IsDir() {
+		// a file replaces a dir of a lower layer, with all its content
+		tree.remove(entry.path, layer, false)
+	}
+
+	if entry.isHardlink {
+		linkname, ok := relativeToSubtree(entry.linkname, tree.subtree)
+		if !ok {
+			return errors.Errorf("original file %s of the hardlink %s is outside of %s in the image %s", entry.linkname, entry.path, tree.subtree, tree.source)
+		}
+
+		entry.linkname = linkname
+	}
+
+	entry.path = relativePath
+	tree.entries[relativePath] = imageEntry{entry: entry, layer: layer}
+
+	if !entry.isRegular() || !slices.Contains(indexedArchiveFiles, relativePath) {
+		return nil
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tree.files[relativePath] = data
+
+	return nil
+}
+
+// remove deletes the entries (of lower layers) under the path (inside the image), and the path itself in case of includeSelf.
+func (tree *imageTree) remove(imagePath string, layer int, includeSelf bool) {
+	for relativePath, entry := range tree.entries {
+		if entry.layer >= layer {
+			continue
+		}
+
+		fullPath := filepath.Join(tree.subtree, relativePath)
+		if (includeSelf && fullPath == imagePath) || strings.HasPrefix(fullPath, imagePath+string(filepath.Separator)) || imagePath == "." {
+			delete(tree.entries, relativePath)
+		}
+	}
+}
+
+// walkLayer walks the (decompressed) layer. In case of isVerified the whole layer is read and its digest is verified,
+// otherwise the content that is not read by the walk is skipped (for uncompressed layers without reading it at all).
+func (tree *imageTree) walkLayer(layer imageLayer, isVerified bool, walk archiveWalkFunc) error {
+	return tree.layout.withFile(layer.path, func(reader io.Reader) error {
+		if !isVerified {
+			layerReader, closeLayer, err := openLayer(layer, reader)
+			if err != nil {
+				return err
+			}
+
+			defer closeLayer()
+
+			err = walkTar(layerReader, walk)
+			if errors.Is(err, errStopWalk) {
+				return nil
+			}
+
+			return err
+		}
+
+		digest := sha256.New()
+
+		if !layer.isDiffID {
+			reader = io.TeeReader(reader, digest)
+		}
+
+		layerReader, closeLayer, err := openLayer(layer, reader)
+		if err != nil {
+			return err
+		}
+
+		defer closeLayer()
+
+		if layer.isDiffID {
+			layerReader = io.TeeReader(layerReader, digest)
+		}
+
+		err = walkTar(layerReader, walk)
+		if err != nil {
+			return err
+		}
+
+		return layer.verify(layerReader, digest)
+	})
+}
+
+// openLayer decompresses the layer in case it is gzip compressed.
+// A seekable layer is rewound after reading its magic, so walkTar can seek over the content of an uncompressed layer.
+func openLayer(layer imageLayer, reader io.Reader) (io.Reader, func(), error) {
+	var magic []byte
+
+	if seeker, isSeeker := reader.(io.ReadSeeker); isSeeker {
+		magic = make([]byte, len(zstdMagic))
+
+		n, err := io.ReadFull(seeker, magic)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		magic = magic[:n]
+
+		_, err = seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	} else {
+		bufferedReader := bufio.NewReader(reader)
+		magic, _ = bufferedReader.Peek(len(zstdMagic))
+		reader = bufferedReader
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, errors.WithMessagef(err, "failed to open layer %s", layer.path)
+		}
+
+		return gzipReader, func() { _ = gzipReader.Close() }, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, nil, errors.Errorf("zstd compressed layers are not supported: %s", layer.path)
+	}
+
+	return reader, func() {}, nil
+}
+
+// verify reads the rest of the layer (after the end of the tar), and compares the digest of the whole layer, in case it is known.
+func (layer imageLayer) verify(rest io.Reader, digest hash.Hash) error {
+	if layer.digest == "" {
+		return nil
+	}
+
+	algorithm, expected, _ := strings.Cut(layer.digest, ":")
+	if algorithm != "sha256" {
+		return errors.Errorf("unsupported digest %s of layer %s", layer.digest, layer.path)
+	}
+
+	_, err := io.Copy(io.Discard, rest)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	actual := hex.EncodeToString(digest.Sum(nil))
+	if actual != expected {
+		return errors.Wrapf(errDigestMismatch, "failed to verify layer %s, expected sha256:%s, got sha256:%s", layer.path, expected, actual)
+	}
+
+	return nil
+}
+
+// extract passes the entries of the final filesystem to the extractor, layer by layer.
+func (tree *imageTree) extract(extractor *archiveExtractor) error {
+	for i, layer := range tree.layers {
+		err := tree.walkLayer(layer, true, func(entry archiveEntry, content io.Reader) error {
+			relativePath, ok := relativeToSubtree(entry.path, tree.subtree)
+			if !ok {
+				return nil
+			}
+
+			final, ok := tree.entries[relativePath]
+			if !ok || final.layer != i {
+				return nil
+			}
+
+			return extractor.extract(final.entry, content)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readFile returns the content of the file (relative to the CodeModule path inside the image) of the final filesystem.
+func (tree *imageTree) readFile(path string) ([]byte, error) {
+	final, ok := tree.entries[path]
+	if !ok || !final.entry.isRegular() {
+		return nil, errors.Errorf("%s not found in the image %s", path, tree.source)
+	}
+
+	if content, ok := tree.files[path]; ok {
+		return content, nil
+	}
+
+	imagePath := filepath.Join(tree.subtree, path)
+
+	var content []byte
+
+	err := tree.walkLayer(tree.layers[final.layer], false, func(entry archiveEntry, reader io.Reader) error {
+		if entry.path != imagePath || !entry.isRegular() {
+			return nil
+		}
+
+		var err error
+
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errStopWalk
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+func (tree *imageTree) selectFiles(log logr.Logger, filter Filter) (map[string]FileEntry, error) {
+	if filter.Technology == "" {
+		return nil, nil
+	}
+
+	manifestFile, err := tree.readFile(manifestFileName)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to open manifest.json")
+	}
+
+	return selectManifestFiles(log, manifestFile, filter)
+}
+
+// resolveLayers returns the layers of the image for the platform, in the order they are applied.
+func resolveLayers(log logr.Logger, layout imageLayout, target platform) ([]imageLayer, error) {
+	index, err := readJSON[ociIndex](layout, ociIndexFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.V(1).Info("no index.json found, reading the image as docker save", "file", dockerManifestFile)
+
+		return resolveDockerLayers(layout, target)
+	} else if err != nil {
+		return nil, err
+	}
+
+	manifestDescriptor, err := resolveManifest(layout, index.Manifests, target)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("resolved image manifest", "digest", manifestDescriptor.Digest, "platform", target)
+
+	manifest, err := readJSON[ociManifest](layout, blobPath(manifestDescriptor.Digest))
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]imageLayer, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		layers = append(layers, imageLayer{path: blobPath(layer.Digest), digest: layer.Digest})
+	}
+
+	return layers, nil
+}
+
+// resolveManifest finds the image manifest for the platform, nested indexes (multi-platform images) are resolved recursively.
+// In case a manifest has no platform in its descriptor, the platform of its config is used.
+func resolveManifest(layout imageLayout, descriptors []descriptor, target platform) (descriptor, error) {
+	var platforms []string
+
+	for _, desc := range descriptors {
+		if desc.MediaType == mediaTypeOCIIndex || desc.MediaType == mediaTypeDockerIndex {
+			index, err := readJSON[ociIndex](layout, blobPath(desc.Digest))
+			if err != nil {
+				return descriptor{}, err
+			}
+
+			manifest, err := resolveManifest(layout, index.Manifests, target)
+			if err == nil {
+				return manifest, nil
+			}
+
+			continue
+		}
+
+		descPlatform := desc.Platform
+		if descPlatform == nil {
+			manifest, err := readJSON[ociManifest](layout, blobPath(desc.Digest))
+			if err != nil {
+				return descriptor{}, err
+			}
+
+			config, err := readJSON[platform](layout, blobPath(manifest.Config.Digest))
+			if err != nil {
+				return descriptor{}, err
+			}
+
+			descPlatform = &config
+		}
+
+		if descPlatform.matches(target) {
+			return desc, nil
+		}
+
+		platforms = append(platforms, path.Join(descPlatform.OS, descPlatform.Architecture, descPlatform.Variant))
+	}
+
+	return descriptor{}, errors.Errorf("no image found for platform %s, available: %s", path.Join(target.OS, target.Architecture, target.Variant), strings.Join(platforms, ", "))
+}
+
+// resolveDockerLayers returns the layers of a docker save, they are verified against the diff ids of the config (in case it has them).
+func resolveDockerLayers(layout imageLayout, target platform) ([]imageLayer, error) {
+	manifests, err := readJSON[[]dockerManifest](layout, dockerManifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []string
+
+	for _, manifest := range manifests {
+		config, err := readJSON[dockerConfig](layout, manifest.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(manifests) == 1 || config.matches(target) {
+			hasDiffIDs := len(config.RootFS.DiffIDs) == len(manifest.Layers)
+
+			layers := make([]imageLayer, 0, len(manifest.Layers))
+			for i, layerPath := range manifest.Layers {
+				layer := imageLayer{path: layerPath, isDiffID: true}
+				if hasDiffIDs {
+					layer.digest = config.RootFS.DiffIDs[i]
+				}
+
+				layers = append(layers, layer)
+			}
+
+			return layers, nil
+		}
+
+		platforms = append(platforms, path.Join(config.OS, config.Architecture, config.Variant))
+	}
+
+	return nil, errors.Errorf("no image found for platform %s, available: %s", path.Join(target.OS, target.Architecture, target.Variant), strings.Join(platforms, ", "))
+}
+
+func readJSON[T any](layout imageLayout, name string) (T, error) {
+	var result T
+
+	err := layout.withFile(name, func(reader io.Reader) error {
+		return errors.WithMessagef(json.NewDecoder(reader).Decode(&result), "failed to parse %s", name)
+	})
+
+	return result, err
+}
+
+// blobPath returns the path of the blob in the OCI image layout, for example sha256:abc -> blobs/sha256/abc.
+func blobPath(digest string) string {
+	algorithm, hash, _ := strings.Cut(digest, ":")
+
+	return filepath.Join("blobs", algorithm, hash)
+}
+
+// relativeToSubtree returns the path relative to the subtree, in case it is inside of it (or the subtree itself, which becomes "").
+func relativeToSubtree(imagePath, subtree string) (string, bool) {
+	if imagePath == subtree {
+		return "", true
+	}
+
+	relativePath, ok := strings.CutPrefix(imagePath, subtree+string(filepath.Separator))
+
+	return relativePath, ok
+}
@@ -0,0 +1,386 @@
+package move
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testImageLayers are the layers of a test image, the second one replaces and removes files of the first one.
+func testImageLayers(t *testing.T) [][]byte {
+	t.Helper()
+
+	base := []testArchiveEntry{
+		{name: "opt/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/dynatrace/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/dynatrace/oneagent/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/dynatrace/oneagent/manifest.json", content: testArchiveManifest, mode: 0644},
+		{name: "opt/dynatrace/oneagent/agent/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/dynatrace/oneagent/agent/installer.version", content: "1.2.2", mode: 0644},
+		{name: "opt/dynatrace/oneagent/agent/lib64/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/dynatrace/oneagent/agent/lib64/java.so", content: "old java", mode: 0755},
+		{name: "opt/dynatrace/oneagent/agent/lib64/php.so", content: "php", mode: 0755},
+		{name: "opt/dynatrace/oneagent/agent/docs/", typeflag: tar.TypeDir, mode: 0755},
+		{name: "opt/dynatrace/oneagent/agent/docs/old.txt", content: "old docs", mode: 0644},
+		{name: "opt/dynatrace/oneagent/removed.txt", content: "removed", mode: 0644},
+		{name: "etc/other.conf", content: "not part of the CodeModule", mode: 0644},
+	}
+
+	update := []testArchiveEntry{
+		{name: "opt/dynatrace/oneagent/agent/installer.version", content: "1.2.3", mode: 0644},
+		{name: "opt/dynatrace/oneagent/agent/lib64/java.so", content: "java", mode: 0755},
+		{name: "opt/dynatrace/oneagent/.wh.removed.txt", mode: 0644},
+		{name: "opt/dynatrace/oneagent/agent/docs/.wh..wh..opq", mode: 0644},
+		{name: "opt/dynatrace/oneagent/agent/docs/new.txt", content: "new docs", mode: 0644},
+	}
+
+	return [][]byte{testTar(t, true, base), testTar(t, false, update)}
+}
+
+func testDigest(content []byte) string {
+	hash := sha256.Sum256(content)
+
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// testDiffID returns the digest of the uncompressed layer, like the diff ids of the config of a docker save.
+func testDiffID(t *testing.T, layer []byte) string {
+	t.Helper()
+
+	if !bytes.HasPrefix(layer, gzipMagic) {
+		return testDigest(layer)
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(layer))
+	require.NoError(t, err)
+
+	uncompressed, err := io.ReadAll(gzipReader)
+	require.NoError(t, err)
+
+	return testDigest(uncompressed)
+}
+
+func writeTestBlob(t *testing.T, fs afero.Fs, layout string, content []byte) string {
+	t.Helper()
+
+	digest := testDigest(content)
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(layout, blobPath(digest)), content, 0644))
+
+	return digest
+}
+
+func writeTestJSONBlob(t *testing.T, fs afero.Fs, layout string, value any) string {
+	t.Helper()
+
+	content, err := json.Marshal(value)
+	require.NoError(t, err)
+
+	return writeTestBlob(t, fs, layout, content)
+}
+
+// createTestOCILayout creates a multi-platform OCI image layout, the image for linux/amd64 has the testImageLayers, the one for linux/arm64 has no layers.
+func createTestOCILayout(t *testing.T, fs afero.Fs, layout string) {
+	t.Helper()
+
+	var layerDescriptors []descriptor
+	for _, layer := range testImageLayers(t) {
+		layerDescriptors = append(layerDescriptors, descriptor{Digest: writeTestBlob(t, fs, layout, layer)})
+	}
+
+	amd64Config := writeTestJSONBlob(t, fs, layout, platform{OS: "linux", Architecture: "amd64"})
+	amd64Manifest := writeTestJSONBlob(t, fs, layout, ociManifest{Config: descriptor{Digest: amd64Config}, Layers: layerDescriptors})
+
+	arm64Config := writeTestJSONBlob(t, fs, layout, platform{OS: "linux", Architecture: "arm64"})
+	arm64Manifest := writeTestJSONBlob(t, fs, layout, ociManifest{Config: descriptor{Digest: arm64Config}})
+
+	nestedIndex := writeTestJSONBlob(t, fs, layout, ociIndex{Manifests: []descriptor{
+		{Digest: arm64Manifest, Platform: &platform{OS: "linux", Architecture: "arm64"}},
+		// no platform in the descriptor, so it is taken from the config
+		{Digest: amd64Manifest},
+	}})
+
+	index, err := json.Marshal(ociIndex{Manifests: []descriptor{{Digest: nestedIndex, MediaType: mediaTypeOCIIndex}}})
+	require.NoError(t, err)
+
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(layout, ociIndexFile), index, 0644))
+	require.NoError(t, afero.WriteFile(fs, filepath.Join(layout, ociLayoutFile), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644))
+}
+
+// createTestDockerSave creates a tarball in the format of `docker save` (without an index.json) with the testImageLayers.
+func createTestDockerSave(t *testing.T, fs afero.Fs, path string) {
+	t.Helper()
+
+	createTestDockerSaveWithLayers(t, fs, path, testImageLayers(t))
+}
+
+func createTestDockerSaveWithLayers(t *testing.T, fs afero.Fs, path string, layers [][]byte) {
+	t.Helper()
+
+	config := dockerConfig{platform: platform{OS: "linux", Architecture: "amd64"}}
+	for _, layer := range layers {
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, testDiffID(t, layer))
+	}
+
+	rawConfig, err := json.Marshal(config)
+	require.NoError(t, err)
+
+	entries := []testArchiveEntry{{name: "config.json", content: string(rawConfig), mode: 0644}}
+	layerPaths := make([]string, 0, len(layers))
+
+	for i, layer := range layers {
+		layerPath := fmt.Sprintf("layer%d/layer.tar", i+1)
+		layerPaths = append(layerPaths, layerPath)
+		entries = append(entries, testArchiveEntry{name: layerPath, content: string(layer), mode: 0644})
+	}
+
+	manifest, err := json.Marshal([]dockerManifest{{Config: "config.json", Layers: layerPaths}})
+	require.NoError(t, err)
+
+	createTestTar(t, fs, path, false, append(entries, testArchiveEntry{name: "manifest.json", content: string(manifest), mode: 0644}))
+}
+
+func TestCopyFromImage(t *testing.T) {
+	target := "/target"
+	amd64 := ImageOptions{Platform: "linux/amd64"}
+
+	assertTarget := func(t *testing.T, fs afero.Afero, expected map[string]string) {
+		t.Helper()
+
+		for path, content := range expected {
+			actual, err := fs.ReadFile(filepath.Join(target, path))
+			if content == "" {
+				require.Error(t, err, path)
+
+				continue
+			}
+
+			require.NoError(t, err, path)
+			assert.Equal(t, content, string(actual), path)
+		}
+	}
+
+	t.Run("oci layout -> layers and whiteouts applied", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestOCILayout(t, fs, "/image")
+
+		require.True(t, IsImage(fs, "/image", nil))
+
+		err := CopyFromImage(testLog, fs, "/image", target, amd64, Filter{}, fsutils.CopyOptions{}, nil)
+		require.NoError(t, err)
+
+		assertTarget(t, fs, map[string]string{
+			"agent/installer.version": "1.2.3",
+			"agent/lib64/java.so":     "java",
+			"agent/lib64/php.so":      "php",
+			"agent/docs/new.txt":      "new docs",
+			"agent/docs/old.txt":      "",
+			"removed.txt":             "",
+			"etc/other.conf":          "",
+		})
+	})
+	t.Run("oci layout + technology -> only selected files", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestOCILayout(t, fs, "/image")
+
+		err := CopyFromImage(testLog, fs, "/image", target, amd64, Filter{Technology: "java"}, fsutils.CopyOptions{}, nil)
+		require.NoError(t, err)
+
+		assertTarget(t, fs, map[string]string{
+			"agent/installer.version": "1.2.3",
+			"agent/lib64/java.so":     "java",
+			"agent/lib64/php.so":      "",
+			"manifest.json":           "",
+		})
+	})
+	t.Run("oci layout + unknown platform -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestOCILayout(t, fs, "/image")
+
+		err := CopyFromImage(testLog, fs, "/image", target, ImageOptions{Platform: "linux/s390x"}, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "no image found for platform linux/s390x")
+	})
+	t.Run("oci layout + path not in image -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestOCILayout(t, fs, "/image")
+
+		err := CopyFromImage(testLog, fs, "/image", target, ImageOptions{Platform: "linux/arm64"}, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "not found in the image")
+	})
+	t.Run("docker save tarball -> layers and whiteouts applied", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestDockerSave(t, fs, "/image.tar")
+
+		require.True(t, IsImage(fs, "/image.tar", nil))
+
+		err := CopyFromImage(testLog, fs, "/image.tar", target, amd64, Filter{Technology: "all"}, fsutils.CopyOptions{}, nil)
+		require.NoError(t, err)
+
+		assertTarget(t, fs, map[string]string{
+			"agent/installer.version": "1.2.3",
+			"agent/lib64/java.so":     "java",
+			"agent/lib64/php.so":      "php",
+			"removed.txt":             "",
+		})
+	})
+	t.Run("symlinks of a lower layer -> never extracted through", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		image := filepath.Join(base, "image.tar")
+
+		createTestDockerSaveWithLayers(t, fs, image, [][]byte{
+			testTar(t, false, []testArchiveEntry{
+				{name: "opt/dynatrace/oneagent/lib", linkname: "/etc", typeflag: tar.TypeSymlink},
+				{name: "opt/dynatrace/oneagent/passwd", linkname: "/etc/passwd", typeflag: tar.TypeSymlink},
+			}),
+			testTar(t, false, []testArchiveEntry{
+				{name: "opt/dynatrace/oneagent/passwd-copy", linkname: "opt/dynatrace/oneagent/passwd", typeflag: tar.TypeLink},
+			}),
+		})
+
+		err := CopyFromImage(testLog, fs, image, filepath.Join(base, "target"), amd64, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "is a symlink")
+
+		createTestDockerSaveWithLayers(t, fs, image, [][]byte{
+			testTar(t, false, []testArchiveEntry{
+				{name: "opt/dynatrace/oneagent/lib", linkname: "/etc", typeflag: tar.TypeSymlink},
+			}),
+			testTar(t, false, []testArchiveEntry{
+				{name: "opt/dynatrace/oneagent/lib/evil.conf", content: "evil", mode: 0644},
+			}),
+		})
+
+		err = CopyFromImage(testLog, fs, image, filepath.Join(base, "other-target"), amd64, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "points into the symlink")
+	})
+	t.Run("hardlink to file outside of the path -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestDockerSaveWithLayers(t, fs, "/image.tar", [][]byte{
+			testTar(t, false, []testArchiveEntry{
+				{name: "etc/other.conf", content: "not part of the CodeModule", mode: 0644},
+				{name: "opt/dynatrace/oneagent/other.conf", linkname: "etc/other.conf", typeflag: tar.TypeLink},
+			}),
+		})
+
+		err := CopyFromImage(testLog, fs, "/image.tar", target, amd64, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorContains(t, err, "is outside of opt/dynatrace/oneagent")
+	})
+	t.Run("oci layout + corrupted layer -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestOCILayout(t, fs, "/image")
+
+		layers := testImageLayers(t)
+		layer := filepath.Join("/image", blobPath(testDigest(layers[1])))
+		require.NoError(t, fs.WriteFile(layer, testTar(t, false, []testArchiveEntry{{name: "opt/dynatrace/oneagent/evil.so", content: "evil", mode: 0755}}), 0644))
+
+		err := CopyFromImage(testLog, fs, "/image", target, amd64, Filter{}, fsutils.CopyOptions{}, nil)
+		require.ErrorIs(t, err, errDigestMismatch)
+	})
+	t.Run("docker save + corrupted layer -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestDockerSave(t, fs, "/image.tar")
+
+		image, err := fs.ReadFile("/image.tar")
+		require.NoError(t, err)
+
+		// change the content of a file in the (uncompressed) second layer, without changing the size of the tarball
+		corrupted := bytes.Replace(image, []byte("new docs"), []byte("evil doc"), 1)
+		require.NotEqual(t, image, corrupted)
+		require.NoError(t, fs.WriteFile("/image.tar", corrupted, 0644))
+
+		err = CopyFromImage(testLog, fs, "/image.tar", target, amd64, Filter{}, fsutils.CopyOptions{Resumable: true}, nil)
+		require.ErrorIs(t, err, errDigestMismatch)
+		require.ErrorContains(t, err, "layer layer2/layer.tar")
+
+		// the files of the corrupted layer were already extracted, they must not be resumed by the next run
+		exists, err := fsutils.HasJournal(fs, target)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestLoadImageTree(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	createTestDockerSave(t, fs, "/image.tar")
+
+	amd64 := ImageOptions{Platform: "linux/amd64"}
+
+	cache := NewSourceCache()
+
+	tree, err := loadImageTree(testLog, fs, "/image.tar", amd64, cache)
+	require.NoError(t, err)
+
+	content, err := tree.readFile(InstallerVersionFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", string(content))
+
+	t.Run("same image -> tree reused", func(t *testing.T) {
+		reused, err := loadImageTree(testLog, fs, "/image.tar", amd64, cache)
+		require.NoError(t, err)
+		assert.Same(t, tree, reused)
+	})
+	t.Run("other path in image -> loaded again", func(t *testing.T) {
+		other, err := loadImageTree(testLog, fs, "/image.tar", ImageOptions{Platform: "linux/amd64", Path: "/opt/dynatrace/oneagent/agent"}, cache)
+		require.NoError(t, err)
+		assert.NotSame(t, tree, other)
+	})
+	t.Run("other run -> loaded again", func(t *testing.T) {
+		other, err := loadImageTree(testLog, fs, "/image.tar", amd64, NewSourceCache())
+		require.NoError(t, err)
+		assert.NotSame(t, tree, other)
+
+		other, err = loadImageTree(testLog, fs, "/image.tar", amd64, nil)
+		require.NoError(t, err)
+		assert.NotSame(t, tree, other)
+	})
+	t.Run("corrupted layer -> loaded, digest verified while extracting", func(t *testing.T) {
+		image, err := fs.ReadFile("/image.tar")
+		require.NoError(t, err)
+		require.NoError(t, fs.WriteFile("/corrupted.tar", bytes.Replace(image, []byte("new docs"), []byte("evil doc"), 1), 0644))
+
+		corrupted, err := loadImageTree(testLog, fs, "/corrupted.tar", amd64, nil)
+		require.NoError(t, err)
+
+		extractor, err := newArchiveExtractor(testLog, fs, "/corrupted", nil, fsutils.CopyOptions{})
+		require.NoError(t, err)
+		require.ErrorIs(t, corrupted.extract(extractor), errDigestMismatch)
+	})
+	t.Run("uncompressed tarball -> layers read at their offset", func(t *testing.T) {
+		layout, ok := tree.layout.(tarLayout)
+		require.True(t, ok)
+
+		entry, ok := layout.index.entry("layer2/layer.tar")
+		require.True(t, ok)
+		assert.Positive(t, entry.offset)
+	})
+}
+
+func TestIsImage(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	createTestTar(t, fs, "/codemodule.tar", false, testArchiveEntries())
+	require.NoError(t, fs.MkdirAll("/codemodule", 0755))
+
+	assert.False(t, IsImage(fs, "/codemodule.tar", nil))
+	assert.False(t, IsImage(fs, "/codemodule", nil))
+	assert.False(t, IsImage(fs, "/missing", nil))
+}
+
+func TestImageSize(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	createTestOCILayout(t, fs, "/image")
+
+	size, err := ImageSize(testLog, fs, "/image", ImageOptions{Platform: "linux/amd64"}, Filter{Technology: "java"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len("java")+len("1.2.3")), size)
+}
@@ -0,0 +1,91 @@
+package move
+
+import (
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/lock"
+	"github.com/go-logr/logr"
+	"github.com/spf13/afero"
+)
+
+// Locked wraps the CopyFunc with an inter-process lock on the target (and the work folder, if set), so bootstrappers sharing them don't interfere with each other.
+// Once the locks are held, the copy is skipped in case the target is already complete (see IsComplete), for example as another process completed it while waiting for the lock, or before this one even started.
+// The finishFunc (if set) is called after the copy (or in case it was skipped) while still holding the locks, it has to complete the target (for example its symlinks and complete marker),
+// as another process only waits for the locks and would otherwise find an incomplete target.
+func Locked(work string, timeout time.Duration, verifyFunc VerifyFunc, copyFunc, finishFunc CopyFunc) CopyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		paths := []string{to}
+		if work != "" {
+			paths = append(paths, work)
+		}
+
+		// the locks are always acquired in the same order, to avoid deadlocks between processes
+		for _, path := range paths {
+			pathLock, _, err := lock.Acquire(log, fs.Fs, path, timeout)
+			if err != nil {
+				log.Error(err, "failed to acquire lock", "path", path)
+
+				return err
+			}
+
+			defer func() {
+				if err := pathLock.Release(); err != nil {
+					log.Error(err, "failed to release lock", "path", path)
+				}
+			}()
+		}
+
+		if IsComplete(log, fs, from, to, verifyFunc) {
+			log.Info("target is already complete, skipping copy", "target", to)
+		} else {
+			err := copyFunc(log, fs, from, to)
+			if err != nil {
+				return err
+			}
+		}
+
+		if finishFunc == nil {
+			return nil
+		}
+
+		return finishFunc(log, fs, from, to)
+	}
+}
+
+// IsComplete checks if the target has a valid complete marker (see VerifyCompleteMarker), so it was completely copied and not changed afterwards,
+// and in case of a verifyFunc, that the target also matches the source.
+// A populated target without a valid marker is not complete, for example another process might have crashed while copying into it.
+func IsComplete(log logr.Logger, fs afero.Afero, from, to string, verifyFunc VerifyFunc) bool {
+	_, err := VerifyCompleteMarker(log, fs, to)
+	if err != nil {
+		log.V(1).Info("target is not complete", "target", to, "reason", err.Error())
+
+		return false
+	}
+
+	if verifyFunc != nil {
+		err = verifyFunc(log, fs, from, to)
+		if err != nil {
+			log.Info("complete target does not match the source", "target", to, "reason", err.Error())
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsPopulated checks if the path is an existing, non-empty dir.
+func IsPopulated(fs afero.Afero, path string) (bool, error) {
+	exists, err := fs.DirExists(path)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	isEmpty, err := fs.IsEmpty(path)
+	if err != nil {
+		return false, err
+	}
+
+	return !isEmpty, nil
+}
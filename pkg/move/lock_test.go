@@ -0,0 +1,157 @@
+package move
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs/lock"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocked(t *testing.T) {
+	t.Run("free lock -> copies", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := filepath.Join(t.TempDir(), "target")
+		isCopied := false
+
+		err := Locked("", time.Minute, nil, func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			isCopied = true
+
+			return nil
+		}, nil)(testLog, fs, "/source", target)
+		require.NoError(t, err)
+		assert.True(t, isCopied)
+	})
+	t.Run("target completed by other process while waiting -> skips copy", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		target := filepath.Join(base, "target")
+		work := filepath.Join(base, "work")
+		isCopying := make(chan struct{})
+		otherErr := make(chan error)
+
+		// the other process goes through the same steps as a real bootstrapper: it copies, then completes the target (see the finishFunc) before releasing the locks
+		go func() {
+			otherErr <- Locked(work, time.Minute, nil, func(_ logr.Logger, fs afero.Afero, _, to string) error {
+				close(isCopying)
+
+				time.Sleep(200 * time.Millisecond)
+
+				return fs.WriteFile(filepath.Join(to, "file.txt"), []byte("content"), 0644)
+			}, func(log logr.Logger, fs afero.Afero, _, to string) error {
+				time.Sleep(200 * time.Millisecond)
+
+				return WriteCompleteMarker(log, fs, to, CompleteMarker{})
+			})(testLog, fs, "/source", target)
+		}()
+
+		require.NoError(t, fs.MkdirAll(target, 0755))
+		<-isCopying
+
+		isFinished := false
+
+		err := Locked(work, time.Minute, nil, func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			t.Error("copy should have been skipped")
+
+			return nil
+		}, func(log logr.Logger, fs afero.Afero, _, to string) error {
+			isFinished = true
+
+			_, err := VerifyCompleteMarker(log, fs, to)
+
+			return err
+		})(testLog, fs, "/source", target)
+		require.NoError(t, err)
+		require.NoError(t, <-otherErr)
+		assert.True(t, isFinished)
+	})
+	t.Run("target partially copied by other process while waiting -> copies", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := filepath.Join(t.TempDir(), "target")
+		isCopied := false
+
+		otherLock, _, err := lock.Acquire(testLog, fs.Fs, target, 0)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+
+			// the other process crashed halfway, without writing the complete marker
+			_ = fs.MkdirAll(target, 0755)
+			_ = fs.WriteFile(filepath.Join(target, "file.txt"), []byte("content"), 0644)
+			_ = otherLock.Release()
+		}()
+
+		err = Locked("", time.Minute, nil, func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			isCopied = true
+
+			return nil
+		}, nil)(testLog, fs, "/source", target)
+		require.NoError(t, err)
+		assert.True(t, isCopied)
+	})
+	t.Run("target completed before starting -> skips copy", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := filepath.Join(t.TempDir(), "target")
+		isVerified := false
+
+		require.NoError(t, fs.MkdirAll(target, 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, "file.txt"), []byte("content"), 0644))
+		require.NoError(t, WriteCompleteMarker(testLog, fs, target, CompleteMarker{}))
+
+		verifyFunc := func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			isVerified = true
+
+			return nil
+		}
+
+		err := Locked("", time.Minute, verifyFunc, func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			t.Error("copy should have been skipped")
+
+			return nil
+		}, nil)(testLog, fs, "/source", target)
+		require.NoError(t, err)
+		assert.True(t, isVerified)
+	})
+	t.Run("complete target that doesn't match the source -> copies", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := filepath.Join(t.TempDir(), "target")
+		isCopied := false
+
+		require.NoError(t, fs.MkdirAll(target, 0755))
+		require.NoError(t, WriteCompleteMarker(testLog, fs, target, CompleteMarker{}))
+
+		verifyFunc := func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			return errors.New("different version")
+		}
+
+		err := Locked("", time.Minute, verifyFunc, func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			isCopied = true
+
+			return nil
+		}, nil)(testLog, fs, "/source", target)
+		require.NoError(t, err)
+		assert.True(t, isCopied)
+	})
+	t.Run("lock held for too long -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		target := filepath.Join(t.TempDir(), "target")
+
+		otherLock, _, err := lock.Acquire(testLog, fs.Fs, target, 0)
+		require.NoError(t, err)
+
+		defer func() { _ = otherLock.Release() }()
+
+		err = Locked("", 0, nil, func(_ logr.Logger, _ afero.Afero, _, _ string) error {
+			t.Error("copy should not have been called")
+
+			return nil
+		}, nil)(testLog, fs, "/source", target)
+		require.ErrorIs(t, err, lock.ErrTimeout)
+	})
+}
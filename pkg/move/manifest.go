@@ -0,0 +1,123 @@
+package move
+
+import (
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/afero"
+)
+
+// ManifestSummary describes the content of the manifest.json of a CodeModule, so the valid values for the Filter are known without opening it by hand.
+type ManifestSummary struct {
+	Version      string              `json:"version"`
+	Archs        []string            `json:"archs"`
+	Technologies []TechnologySummary `json:"technologies"`
+}
+
+// TechnologySummary counts the files of a technology of the manifest.json, the Files and Size of the technology count files that are part of multiple archs only once.
+type TechnologySummary struct {
+	Name  string        `json:"name"`
+	Archs []ArchSummary `json:"archs"`
+	Files int           `json:"files"`
+	Size  int64         `json:"size"`
+}
+
+type ArchSummary struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// SummarizeManifest reads the manifest.json of the source (folder, archive or image) and sums up the sizes of the files of every technology and arch.
+// The sizes are the ones of the files in the source, files that are listed in the manifest.json but missing from the source don't count towards the Size.
+func SummarizeManifest(log logr.Logger, fs afero.Afero, from string, image ImageOptions) (ManifestSummary, error) {
+	cache := NewSourceCache()
+
+	content, err := ReadSourceFile(log, fs, from, manifestFileName, image, cache)
+	if err != nil {
+		return ManifestSummary{}, err
+	}
+
+	manifest, err := parseManifest(content)
+	if err != nil {
+		return ManifestSummary{}, err
+	}
+
+	files, err := PlanFiles(log, fs, from, image, Filter{}, cache)
+	if err != nil {
+		return ManifestSummary{}, err
+	}
+
+	sizes := make(map[string]int64, len(files))
+	for _, file := range files {
+		sizes[file.Path] = file.Size
+	}
+
+	return summarizeManifest(manifest, sizes), nil
+}
+
+func summarizeManifest(manifest Manifest, sizes map[string]int64) ManifestSummary {
+	summary := ManifestSummary{
+		Version:      manifest.Version,
+		Archs:        []string{},
+		Technologies: make([]TechnologySummary, 0, len(manifest.Technologies)),
+	}
+
+	seenArchs := map[string]bool{}
+
+	for _, tech := range manifest.AvailableTechnologies() {
+		techSummary := TechnologySummary{Name: tech, Archs: []ArchSummary{}}
+		seenPaths := map[string]bool{}
+
+		for _, arch := range sortedArchs(manifest.Technologies[tech]) {
+			archSummary := ArchSummary{Name: arch}
+
+			for _, file := range manifest.Technologies[tech][arch] {
+				size := manifestFileSize(file, sizes)
+
+				archSummary.Files++
+				archSummary.Size += size
+
+				if !seenPaths[file.Path] {
+					seenPaths[file.Path] = true
+					techSummary.Files++
+					techSummary.Size += size
+				}
+			}
+
+			techSummary.Archs = append(techSummary.Archs, archSummary)
+
+			if !seenArchs[arch] {
+				seenArchs[arch] = true
+				summary.Archs = append(summary.Archs, arch)
+			}
+		}
+
+		summary.Technologies = append(summary.Technologies, techSummary)
+	}
+
+	sort.Strings(summary.Archs)
+
+	return summary
+}
+
+func sortedArchs(archs ArchEntries) []string {
+	names := make([]string, 0, len(archs))
+	for arch := range archs {
+		names = append(names, arch)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// manifestFileSize returns the size of the file in the source, the paths of the manifest.json are cleaned the same way as the ones of an archive.
+func manifestFileSize(file FileEntry, sizes map[string]int64) int64 {
+	path, err := cleanArchivePath(file.Path)
+	if err != nil {
+		return 0
+	}
+
+	return sizes[path]
+}
@@ -0,0 +1,61 @@
+package move
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeManifest(t *testing.T) {
+	t.Run("archive -> technologies with file counts and sizes", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestTar(t, fs, "/codemodule.tar", false, testArchiveEntries())
+
+		summary, err := SummarizeManifest(testLog, fs, "/codemodule.tar", ImageOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, ManifestSummary{
+			Version: "1.2.3",
+			Archs:   []string{"x86"},
+			Technologies: []TechnologySummary{
+				{Name: "java", Files: 2, Size: int64(len("java") + len("1.2.3")), Archs: []ArchSummary{{Name: "x86", Files: 2, Size: int64(len("java") + len("1.2.3"))}}},
+				{Name: "php", Files: 1, Size: int64(len("php")), Archs: []ArchSummary{{Name: "x86", Files: 1, Size: int64(len("php"))}}},
+			},
+		}, summary)
+	})
+	t.Run("folder + file in multiple archs -> counted once for the technology", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile("/source/manifest.json", []byte(`{
+			"version": "1.2.3",
+			"technologies": {
+				"java": {
+					"x86": [{"path": "agent/installer.version"}, {"path": "agent/lib64/java.so"}],
+					"musl": [{"path": "agent/installer.version"}, {"path": "agent/lib64/missing.so"}]
+				}
+			}
+		}`), 0644))
+		require.NoError(t, fs.WriteFile("/source/agent/installer.version", []byte("1.2.3"), 0644))
+		require.NoError(t, fs.WriteFile("/source/agent/lib64/java.so", []byte("java"), 0755))
+
+		summary, err := SummarizeManifest(testLog, fs, "/source", ImageOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"musl", "x86"}, summary.Archs)
+		assert.Equal(t, []TechnologySummary{{
+			Name:  "java",
+			Files: 3,
+			Size:  int64(len("1.2.3") + len("java")),
+			Archs: []ArchSummary{
+				{Name: "musl", Files: 2, Size: int64(len("1.2.3"))},
+				{Name: "x86", Files: 2, Size: int64(len("1.2.3") + len("java"))},
+			},
+		}}, summary.Technologies)
+	})
+	t.Run("missing manifest.json -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.MkdirAll("/source", 0755))
+
+		_, err := SummarizeManifest(testLog, fs, "/source", ImageOptions{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,181 @@
+package move
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	SourceTypeDirectory = "directory"
+	SourceTypeArchive   = "archive"
+	SourceTypeImage     = "image"
+	SourceTypeDownload  = "download"
+
+	// ActionCopy means the files are copied into the target, in case it already exists (without a work folder) they are overwritten.
+	ActionCopy        = "copy"
+	ActionIncremental = "incremental"
+	ActionSkip        = "skip"
+	ActionReplace     = "replace"
+	ActionFail        = "fail"
+)
+
+// Plan describes what copying the CodeModule would do, it is computed without writing anything.
+type Plan struct {
+	// Download is only set in case the source is downloaded, the files are not known in that case.
+	Download        *PlannedDownload `json:"download,omitempty"`
+	CurrentSymlink  *PlannedSymlink  `json:"currentSymlink,omitempty"`
+	VersionAliases  []PlannedSymlink `json:"versionAliases,omitempty"`
+	Source          string           `json:"source"`
+	SourceType      string           `json:"sourceType"`
+	Target          string           `json:"target"`
+	Work            string           `json:"work,omitempty"`
+	Action          string           `json:"action"`
+	Version         string           `json:"version,omitempty"`
+	Files           []PlannedFile    `json:"files"`
+	RemovedVersions []string         `json:"removedVersions,omitempty"`
+}
+
+// PlannedFile is a file (relative to the target) that would be copied.
+type PlannedFile struct {
+	Path string `json:"path"`
+	MD5  string `json:"md5,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// PlannedSymlink is a symlink that would be created, the Target is relative to the Path.
+type PlannedSymlink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+type PlannedDownload struct {
+	URL          string   `json:"url"`
+	Flavor       string   `json:"flavor"`
+	Arch         string   `json:"arch"`
+	Version      string   `json:"version,omitempty"`
+	Technologies []string `json:"technologies,omitempty"`
+}
+
+// SourceType returns the type of the source, based on how it would be copied.
+func SourceType(fs afero.Afero, from string, cache *SourceCache) string {
+	switch {
+	case IsImage(fs, from, cache):
+		return SourceTypeImage
+	case IsArchive(from):
+		return SourceTypeArchive
+	default:
+		return SourceTypeDirectory
+	}
+}
+
+// PlanFiles returns the files that would be copied from the source, according to the Filter.
+func PlanFiles(log logr.Logger, fs afero.Afero, from string, image ImageOptions, filter Filter, cache *SourceCache) ([]PlannedFile, error) {
+	switch SourceType(fs, from, cache) {
+	case SourceTypeImage:
+		tree, err := loadImageTree(log, fs, from, image, cache)
+		if err != nil {
+			return nil, err
+		}
+
+		entries, selected, err := tree.listFiles(log, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		return plannedEntries(entries, selected), nil
+	case SourceTypeArchive:
+		entries, selected, err := listArchiveFiles(log, fs, from, filter, cache)
+		if err != nil {
+			return nil, err
+		}
+
+		return plannedEntries(entries, selected), nil
+	default:
+		return planFolderFiles(log, fs, from, filter)
+	}
+}
+
+func plannedEntries(entries []archiveEntry, selected map[string]FileEntry) []PlannedFile {
+	files := make([]PlannedFile, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, PlannedFile{Path: entry.path, Size: entry.size, MD5: selected[entry.path].MD5})
+	}
+
+	return files
+}
+
+func planFolderFiles(log logr.Logger, fs afero.Afero, from string, filter Filter) ([]PlannedFile, error) {
+	entries, err := ListFiles(log, fs, from, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]PlannedFile, 0, len(entries))
+	for _, entry := range entries {
+		info, err := fsutils.Lstat(fs, filepath.Join(from, entry.Path))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, PlannedFile{Path: entry.Path, Size: info.Size(), MD5: entry.MD5})
+	}
+
+	return files, nil
+}
+
+// ReadSourceFile returns the content of a single file (relative to the CodeModule) of the source, without copying it.
+func ReadSourceFile(log logr.Logger, fs afero.Afero, from, path string, image ImageOptions, cache *SourceCache) ([]byte, error) {
+	switch SourceType(fs, from, cache) {
+	case SourceTypeImage:
+		tree, err := loadImageTree(log, fs, from, image, cache)
+		if err != nil {
+			return nil, err
+		}
+
+		return tree.readFile(path)
+	case SourceTypeArchive:
+		return readArchiveFile(fs, from, path, cache)
+	default:
+		content, err := fs.ReadFile(filepath.Join(from, path))
+
+		return content, errors.WithStack(err)
+	}
+}
+
+// PlanCurrentSymlink returns the "current" symlink that CreateCurrentSymlink would create (or replace) for the version, after the files are copied.
+// The returned bool is false in case it would already exist, either copied from the source or (in case the target is reused) already present in the target and pointing to the version.
+func PlanCurrentSymlink(fs afero.Afero, targetDir, version string, files []PlannedFile, isTargetReused bool) (PlannedSymlink, bool, error) {
+	err := ValidateVersion(version)
+	if err != nil {
+		return PlannedSymlink{}, false, err
+	}
+
+	targetCurrentDir := filepath.Join(targetDir, currentDir)
+
+	isCopied := slices.ContainsFunc(files, func(file PlannedFile) bool {
+		return file.Path == currentDir || strings.HasPrefix(file.Path, currentDir+string(filepath.Separator))
+	})
+	if isCopied {
+		return PlannedSymlink{}, false, nil
+	}
+
+	if isTargetReused {
+		isSymlink, err := isSymlinkOrMissing(fs, targetCurrentDir)
+		if err != nil || !isSymlink {
+			return PlannedSymlink{}, false, err
+		}
+
+		isUpToDate, err := isSymlinkUpToDate(fs, targetCurrentDir, filepath.Join(targetDir, binDir, version))
+		if err != nil || isUpToDate {
+			return PlannedSymlink{}, false, err
+		}
+	}
+
+	return PlannedSymlink{Path: targetCurrentDir, Target: version}, true, nil
+}
@@ -0,0 +1,92 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanFiles(t *testing.T) {
+	t.Run("archive + technology -> selected files with md5", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		createTestTar(t, fs, "/codemodule.tar", false, testArchiveEntries())
+
+		files, err := PlanFiles(testLog, fs, "/codemodule.tar", ImageOptions{}, Filter{Technology: "java"}, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []PlannedFile{
+			{Path: InstallerVersionFilePath, Size: int64(len("1.2.3")), MD5: "b0e8daa258acbb6fc4c86f89e0c9183e"},
+			{Path: "agent/lib64/java.so", Size: int64(len("java")), MD5: "93f725a07423fe1c889f448b33d21f46"},
+		}, files)
+	})
+	t.Run("folder -> every file with size", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile("/source/agent/installer.version", []byte("1.2.3"), 0644))
+		require.NoError(t, fs.WriteFile("/source/agent/lib64/php.so", []byte("php"), 0755))
+
+		files, err := PlanFiles(testLog, fs, "/source", ImageOptions{}, Filter{}, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []PlannedFile{
+			{Path: InstallerVersionFilePath, Size: int64(len("1.2.3"))},
+			{Path: "agent/lib64/php.so", Size: int64(len("php"))},
+		}, files)
+	})
+}
+
+func TestPlanCurrentSymlink(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	require.NoError(t, fs.MkdirAll(filepath.Join("/target", currentDir), 0755))
+
+	symlink, isPlanned, err := PlanCurrentSymlink(fs, "/target", "1.2.3", nil, false)
+	require.NoError(t, err)
+	assert.True(t, isPlanned)
+	assert.Equal(t, PlannedSymlink{Path: "/target/agent/bin/current", Target: "1.2.3"}, symlink)
+
+	_, isPlanned, err = PlanCurrentSymlink(fs, "/target", "1.2.3", nil, true)
+	require.NoError(t, err)
+	assert.False(t, isPlanned)
+
+	_, isPlanned, err = PlanCurrentSymlink(fs, "/other", "1.2.3", []PlannedFile{{Path: "agent/bin/current/lib.so"}}, false)
+	require.NoError(t, err)
+	assert.False(t, isPlanned)
+
+	_, _, err = PlanCurrentSymlink(fs, "/target", "../1.2.3", nil, false)
+	require.Error(t, err)
+
+	t.Run("symlink to old version -> replacement planned", func(t *testing.T) {
+		osFs := afero.Afero{Fs: afero.NewOsFs()}
+		target := t.TempDir()
+		require.NoError(t, osFs.MkdirAll(filepath.Join(target, binDir, "1.2.2"), 0755))
+		require.NoError(t, os.Symlink("1.2.2", filepath.Join(target, currentDir)))
+
+		_, isPlanned, err := PlanCurrentSymlink(osFs, target, "1.2.3", nil, true)
+		require.NoError(t, err)
+		assert.True(t, isPlanned)
+
+		_, isPlanned, err = PlanCurrentSymlink(osFs, target, "1.2.2", nil, true)
+		require.NoError(t, err)
+		assert.False(t, isPlanned)
+	})
+}
+
+func TestPlanOldVersions(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	for _, version := range []string{"1.2.3", "1.2.4"} {
+		require.NoError(t, fs.WriteFile(filepath.Join("/bins", version, InstallerVersionFilePath), []byte(version), 0644))
+	}
+
+	removed, err := PlanOldVersions(testLog, fs, "/bins/1.2.5", "1.2.5", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/bins/1.2.3"}, removed)
+
+	removed, err = PlanOldVersions(testLog, fs, "/missing/1.2.5", "1.2.5", 1)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+
+	exists, err := fs.DirExists("/bins/1.2.3")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
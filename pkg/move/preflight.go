@@ -0,0 +1,206 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// ListFiles returns the files (relative to `from`) that would be copied, either every file of the folder or in case the Filter has a Technology, only the ones from the manifest.json.
+// In both cases, only the files that are selected by the Paths of the Filter are returned.
+func ListFiles(log logr.Logger, fs afero.Afero, from string, filter Filter) ([]FileEntry, error) {
+	if filter.Technology != "" {
+		files, err := filterFilesByTechnology(log, fs, from, strings.Split(filter.Technology, ","), splitArchs(filter.Arch), filter.IsStrict)
+		if err != nil {
+			return nil, err
+		}
+
+		return selectPaths(uniqueFiles(files), filter.Paths), nil
+	}
+
+	var files []FileEntry
+
+	err := fs.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(from, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if info.IsDir() {
+			if relativePath != "." && filter.Paths.ExcludesDir(filepath.ToSlash(relativePath)) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if filter.Paths.Selects(filepath.ToSlash(relativePath)) {
+			files = append(files, FileEntry{Path: relativePath})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return files, nil
+}
+
+// selectPaths returns the files that are selected by the PathFilter.
+func selectPaths(files []FileEntry, paths *fsutils.PathFilter) []FileEntry {
+	if paths.IsEmpty() {
+		return files
+	}
+
+	selected := make([]FileEntry, 0, len(files))
+
+	for _, file := range files {
+		if paths.Selects(filepath.ToSlash(file.Path)) {
+			selected = append(selected, file)
+		}
+	}
+
+	return selected
+}
+
+// CheckFreeSpace fails in case the filesystem of the `dir` doesn't have enough free space to copy the files (relative to `from`) into it.
+// The files that are already present in the `dir` are considered, as they are overwritten.
+// In case the free space can't be determined (for example the afero.Fs is not the real filesystem), the check is skipped.
+func CheckFreeSpace(log logr.Logger, fs afero.Afero, from string, files []FileEntry, dir string) error {
+	return checkSpace(log, fs, dir, func() (uint64, error) {
+		return RequiredSpace(fs, from, files, dir)
+	})
+}
+
+// SpaceNeed is the number of bytes that are going to be written into the Dir.
+type SpaceNeed struct {
+	Dir   string
+	Bytes uint64
+}
+
+// CheckSpaceNeeds is the same as CheckRequiredSpace for each of the needs, but the needs of dirs on the same filesystem are added up, as they share its free space.
+func CheckSpaceNeeds(log logr.Logger, fs afero.Afero, needs []SpaceNeed) error {
+	var (
+		combined []SpaceNeed
+		devices  []uint64
+	)
+
+	for _, need := range needs {
+		device, ok, err := fsutils.DeviceID(fs, need.Dir)
+		if err != nil {
+			log.Info("failed to determine the filesystem", "dir", need.Dir)
+
+			return err
+		}
+
+		index := slices.Index(devices, device)
+		if !ok || index < 0 {
+			combined = append(combined, need)
+			devices = append(devices, device)
+
+			continue
+		}
+
+		combined[index].Bytes += need.Bytes
+	}
+
+	for _, need := range combined {
+		err := CheckRequiredSpace(log, fs, need.Dir, need.Bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckRequiredSpace fails in case the filesystem of the `dir` has less free space than required (in bytes).
+// In case the free space can't be determined (for example the afero.Fs is not the real filesystem), the check is skipped.
+func CheckRequiredSpace(log logr.Logger, fs afero.Afero, dir string, required uint64) error {
+	return checkSpace(log, fs, dir, func() (uint64, error) {
+		return required, nil
+	})
+}
+
+// checkSpace only calculates the required space, in case the free space of the `dir` can be determined.
+func checkSpace(log logr.Logger, fs afero.Afero, dir string, requiredFunc func() (uint64, error)) error {
+	available, ok, err := fsutils.FreeSpace(fs, dir)
+	if err != nil {
+		log.Info("failed to determine the free space", "dir", dir)
+
+		return err
+	} else if !ok {
+		log.V(1).Info("free space can't be determined, skipping check", "dir", dir)
+
+		return nil
+	}
+
+	required, err := requiredFunc()
+	if err != nil {
+		return err
+	}
+
+	log.Info("checked free space", "dir", dir, "required-bytes", required, "available-bytes", available)
+
+	if required > available {
+		return errors.Errorf("not enough free space in %s: copying needs %d bytes, but only %d bytes are available", dir, required, available)
+	}
+
+	return nil
+}
+
+// RequiredSpace sums up the sizes of the files, minus the size of the files that already exist in the `dir` and would be overwritten.
+// An empty `dir` means that no file is overwritten.
+func RequiredSpace(fs afero.Afero, from string, files []FileEntry, dir string) (uint64, error) {
+	var required uint64
+
+	for _, file := range files {
+		sourceInfo, err := fs.Stat(filepath.Join(from, file.Path))
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		size := sourceInfo.Size()
+
+		if dir != "" {
+			targetInfo, err := fs.Stat(filepath.Join(dir, file.Path))
+			if err == nil && !targetInfo.IsDir() {
+				size -= targetInfo.Size()
+			}
+		}
+
+		if size > 0 {
+			required += uint64(size)
+		}
+	}
+
+	return required, nil
+}
+
+func uniqueFiles(files []FileEntry) []FileEntry {
+	seenPaths := make(map[string]bool, len(files))
+	unique := make([]FileEntry, 0, len(files))
+
+	for _, file := range files {
+		if seenPaths[file.Path] {
+			continue
+		}
+
+		seenPaths[file.Path] = true
+
+		unique = append(unique, file)
+	}
+
+	return unique
+}
@@ -0,0 +1,148 @@
+package move
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFiles(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+	manifestContent := `{
+        "version": "1.0",
+        "technologies": {
+            "java": {
+                "x86": [
+                    {"path": "agent/fileA1.txt", "version": "1.0", "md5": "abc123"},
+                    {"path": "agent/shared.txt", "version": "1.0", "md5": "def456"}
+                ]
+            },
+            "python": {
+                "x86": [
+                    {"path": "agent/shared.txt", "version": "1.0", "md5": "def456"}
+                ]
+            }
+        }
+    }`
+
+	_ = fs.WriteFile(filepath.Join(testSourceDir, "manifest.json"), []byte(manifestContent), 0644)
+	_ = fs.WriteFile(filepath.Join(testSourceDir, "agent", "fileA1.txt"), []byte("a1"), 0644)
+	_ = fs.WriteFile(filepath.Join(testSourceDir, "agent", "shared.txt"), []byte("shared"), 0644)
+
+	t.Run("no technology -> every file", func(t *testing.T) {
+		files, err := ListFiles(testLog, fs, testSourceDir, Filter{})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "manifest.json"},
+			{Path: "agent/fileA1.txt"},
+			{Path: "agent/shared.txt"},
+		}, files)
+	})
+	t.Run("technology -> filtered and unique files", func(t *testing.T) {
+		files, err := ListFiles(testLog, fs, testSourceDir, Filter{Technology: "java,python"})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "agent/fileA1.txt", Version: "1.0", MD5: "abc123"},
+			{Path: "agent/shared.txt", Version: "1.0", MD5: "def456"},
+		}, files)
+	})
+	t.Run("exclude -> excluded files not listed", func(t *testing.T) {
+		paths, err := fsutils.NewPathFilter(nil, []string{"agent/shared.*"})
+		require.NoError(t, err)
+
+		files, err := ListFiles(testLog, fs, testSourceDir, Filter{Paths: paths})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{{Path: "manifest.json"}, {Path: "agent/fileA1.txt"}}, files)
+
+		files, err = ListFiles(testLog, fs, testSourceDir, Filter{Technology: "java", Paths: paths})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{{Path: "agent/fileA1.txt", Version: "1.0", MD5: "abc123"}}, files)
+	})
+	t.Run("include -> only included files listed", func(t *testing.T) {
+		paths, err := fsutils.NewPathFilter([]string{"agent/**"}, nil)
+		require.NoError(t, err)
+
+		files, err := ListFiles(testLog, fs, testSourceDir, Filter{Paths: paths})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{{Path: "agent/fileA1.txt"}, {Path: "agent/shared.txt"}}, files)
+	})
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	t.Run("memory fs -> skipped", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		err := CheckFreeSpace(testLog, fs, testSourceDir, []FileEntry{{Path: "missing"}}, "/target")
+		require.NoError(t, err)
+	})
+	t.Run("enough space -> no error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		source := t.TempDir()
+
+		require.NoError(t, os.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0644))
+
+		err := CheckFreeSpace(testLog, fs, source, []FileEntry{{Path: "file.txt"}}, filepath.Join(t.TempDir(), "not", "yet", "created"))
+		require.NoError(t, err)
+	})
+	t.Run("not enough space -> error", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		source := t.TempDir()
+
+		// sparse file, so it doesn't actually take up the space, listed multiple times to be bigger than any disk
+		require.NoError(t, os.WriteFile(filepath.Join(source, "huge.bin"), nil, 0644))
+		require.NoError(t, os.Truncate(filepath.Join(source, "huge.bin"), 1<<40))
+
+		files := make([]FileEntry, 1<<12)
+		for i := range files {
+			files[i] = FileEntry{Path: "huge.bin"}
+		}
+
+		err := CheckFreeSpace(testLog, fs, source, files, t.TempDir())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not enough free space")
+	})
+	t.Run("already present files are not counted", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		_ = fs.WriteFile(filepath.Join(testSourceDir, "a.txt"), []byte("12345"), 0644)
+		_ = fs.WriteFile(filepath.Join(testSourceDir, "b.txt"), []byte("12345"), 0644)
+		_ = fs.WriteFile(filepath.Join("/target", "a.txt"), []byte("123"), 0644)
+
+		required, err := RequiredSpace(fs, testSourceDir, []FileEntry{{Path: "a.txt"}, {Path: "b.txt"}}, "/target")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(7), required)
+	})
+}
+
+func TestCheckSpaceNeeds(t *testing.T) {
+	t.Run("memory fs -> skipped", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+
+		err := CheckSpaceNeeds(testLog, fs, []SpaceNeed{{Dir: "/target", Bytes: 1 << 62}, {Dir: "/store", Bytes: 1 << 62}})
+		require.NoError(t, err)
+	})
+	t.Run("needs on the same disk -> added up", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		dir := t.TempDir()
+
+		available, ok, err := fsutils.FreeSpace(fs, dir)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		first := filepath.Join(dir, "first")
+		second := filepath.Join(dir, "second")
+
+		err = CheckSpaceNeeds(testLog, fs, []SpaceNeed{{Dir: first, Bytes: available / 4}, {Dir: second, Bytes: available / 4}})
+		require.NoError(t, err)
+
+		err = CheckSpaceNeeds(testLog, fs, []SpaceNeed{{Dir: first, Bytes: available/2 + 1}, {Dir: second, Bytes: available/2 + 1}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not enough free space")
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
 
 	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
@@ -28,27 +31,98 @@ type FileEntry struct {
 	MD5     string `json:"md5"`
 }
 
-func CopyByTechnologyWrapper(technology string) CopyFunc {
+// AvailableTechnologies returns the sorted list of technologies that are present in the manifest.json.
+func (m Manifest) AvailableTechnologies() []string {
+	technologies := make([]string, 0, len(m.Technologies))
+	for tech := range m.Technologies {
+		technologies = append(technologies, tech)
+	}
+
+	sort.Strings(technologies)
+
+	return technologies
+}
+
+const (
+	// AllArchs can be used as Filter.Arch to select the files of every architecture.
+	AllArchs = "all"
+
+	// AllTechnologies (or its alias, "*") can be used in Filter.Technology to select every technology of the manifest.json.
+	AllTechnologies      = "all"
+	allTechnologiesAlias = "*"
+	// excludePrefix marks a technology in Filter.Technology that should not be copied, for example "all,!php".
+	excludePrefix = "!"
+
+	manifestFileName = "manifest.json"
+
+	archX86 = "x86"
+	archARM = "arm"
+	// archMusl is the flavor of the manifest.json for the x86 musl libc (for example alpine) binaries.
+	archMusl = "musl"
+)
+
+// libcFlavors are the additional architectures/flavors of the manifest.json, that run on the same CPU architecture.
+var libcFlavors = map[string][]string{
+	archX86: {archMusl},
+}
+
+// Filter selects which entries of the manifest.json are copied.
+type Filter struct {
+	// Technology is a comma-separated list of technologies, supports AllTechnologies and exclusions (for example "all,!php").
+	Technology string
+	// Arch is a comma-separated list of architectures/flavors (for example x86, arm, musl), empty or AllArchs means every architecture.
+	Arch string
+	// IsStrict makes unknown technologies fail the copy, instead of just ignoring them.
+	IsStrict bool
+	// Paths further selects the files (relative to the CodeModule) by glob patterns, nil means every file.
+	// It has to match the PathFilter of the CopyOptions, as the copy only knows about the latter.
+	Paths *fsutils.PathFilter
+}
+
+// DefaultArch returns the architectures of the manifest.json that match the CPU architecture the bootstrapper is running on, including every libc flavor of it (for example "x86,musl"),
+// as the libc of the (application) image is not known.
+func DefaultArch() string {
+	return strings.Join(append([]string{CPUArch()}, libcFlavors[CPUArch()]...), ",")
+}
+
+// CPUArch returns the architecture of the manifest.json that matches the CPU architecture the bootstrapper is running on, without its libc flavors.
+func CPUArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return archX86
+	case "arm64":
+		return archARM
+	default:
+		return runtime.GOARCH
+	}
+}
+
+func CopyByTechnologyWrapper(filter Filter, opts fsutils.CopyOptions) CopyFunc {
 	return func(log logr.Logger, fs afero.Afero, from, to string) error {
-		return CopyByTechnology(log, fs, from, to, technology)
+		return CopyByTechnology(log, fs, from, to, filter, opts)
 	}
 }
 
-func CopyByTechnology(log logr.Logger, fs afero.Afero, from string, to string, technology string) error {
-	log.Info("starting to copy (filtered)", "from", from, "to", to)
+func CopyByTechnology(log logr.Logger, fs afero.Afero, from string, to string, filter Filter, opts fsutils.CopyOptions) error {
+	log.Info("starting to copy (filtered)", "from", from, "to", to, "arch", filter.Arch, "concurrency", opts.Concurrency)
 
-	filteredPaths, err := filterFilesByTechnology(log, fs, from, strings.Split(technology, ","))
+	filteredFiles, err := filterFilesByTechnology(log, fs, from, strings.Split(filter.Technology, ","), splitArchs(filter.Arch), filter.IsStrict)
 	if err != nil {
 		return err
 	}
 
-	return copyByList(log, fs, from, to, filteredPaths)
+	return copyByList(log, fs, from, to, filteredFiles, opts)
 }
 
-func copyByList(log logr.Logger, fs afero.Afero, from string, to string, paths []string) error {
+// copyByList copies the provided files (and their parent dirs) from the `from` folder to the `to` folder.
+// The dirs are created one by one, so their modes are set deterministically, the files are copied according to the CopyOptions.
+// In case the FileEntry has an MD5 set, the checksum of the copied file is verified.
+func copyByList(log logr.Logger, fs afero.Afero, from string, to string, files []FileEntry, opts fsutils.CopyOptions) error {
 	oldUmask := unix.Umask(noPermissionsMask)
 	defer unix.Umask(oldUmask)
 
+	opts = withThrottle(opts)
+
 	fromStat, err := fs.Stat(from)
 	if err != nil {
 		log.Error(err, "error checking stat mode from source folder")
@@ -63,82 +137,248 @@ func copyByList(log logr.Logger, fs afero.Afero, from string, to string, paths [
 		return err
 	}
 
-	for _, path := range paths {
-		splitPath := strings.Split(path, string(filepath.Separator))
-		walkedPath := ""
+	fileCopies := make([]fsutils.FileCopy, 0, len(files))
+	dirCopies := []fsutils.FileCopy{{From: from, To: to}}
+	seenDirs := map[string]bool{}
 
-		for _, subPath := range splitPath {
-			walkedPath = filepath.Join(walkedPath, subPath)
-			sourcePath := filepath.Join(from, walkedPath)
-			targetPath := filepath.Join(to, walkedPath)
+	// the same file can be part of multiple technologies, copying it twice (maybe in parallel) is not necessary
+	for _, file := range uniqueFiles(files) {
+		if !opts.PathFilter.Selects(filepath.ToSlash(file.Path)) {
+			log.V(1).Info("excluding file", "path", file.Path)
 
-			sourceStat, err := fs.Stat(sourcePath)
-			if err != nil {
-				log.Error(err, "failed checking stat mode from source", "path", sourcePath)
+			continue
+		}
 
-				return err
-			}
+		fileCopy, walkedDirs, err := createParentDirs(log, fs, from, to, file, opts.PreserveMetadata)
+		if err != nil {
+			return err
+		}
 
-			if sourceStat.IsDir() {
-				err := fs.Mkdir(targetPath, sourceStat.Mode())
-				if err != nil && !os.IsExist(err) {
-					log.Error(err, "failed to create new dir", "path", targetPath)
+		for _, dir := range walkedDirs {
+			if !seenDirs[dir.To] {
+				seenDirs[dir.To] = true
 
-					return err
-				}
+				dirCopies = append(dirCopies, dir)
+			}
+		}
 
-				log.V(1).Info("created new dir", "from", sourcePath, "to", targetPath, "mode", sourceStat.Mode())
+		if fileCopy != nil {
+			fileCopies = append(fileCopies, *fileCopy)
+		}
+	}
 
-				continue
-			}
+	err = copyWithJournal(log, fs, to, opts, func(opts fsutils.CopyOptions) error {
+		return fsutils.CopyFiles(log, fs, fileCopies, opts)
+	})
+	if err != nil {
+		log.Error(err, "error copying file")
 
-			log.V(1).Info("copying file", "from", sourcePath, "to", targetPath, "mode", sourceStat.Mode())
+		return err
+	}
 
-			err = fsutils.CopyFile(fs, sourcePath, targetPath)
-			if err != nil {
-				log.Error(err, "error copying file")
+	if opts.Incremental {
+		err = fsutils.RemoveStale(log, fs, to, fileCopies, dirCopies)
+		if err != nil {
+			return err
+		}
+	}
 
-				return err
-			}
+	if opts.PreserveMetadata {
+		err = fsutils.RestoreDirMetadata(fs, dirCopies)
+		if err != nil {
+			return err
 		}
 	}
 
+	logCopied(log, "successfully copied (filtered)", opts.Throttle, "from", from, "to", to, "files", len(fileCopies))
+
 	return nil
 }
 
-func filterFilesByTechnology(log logr.Logger, fs afero.Afero, source string, technologies []string) ([]string, error) {
-	manifestPath := filepath.Join(source, "manifest.json")
+// createParentDirs walks the path of the FileEntry and creates the missing dirs in the `to` folder with the same mode as in the `from` folder.
+// Returns the FileCopy for the file at the end of the path (or nil if the path points to a dir) and the dirs that were walked.
+// In case of keepSymlinks, a symlink on the path is not followed, but returned as the FileCopy, so it can be recreated as a symlink.
+func createParentDirs(log logr.Logger, fs afero.Afero, from string, to string, file FileEntry, keepSymlinks bool) (*fsutils.FileCopy, []fsutils.FileCopy, error) {
+	splitPath := strings.Split(file.Path, string(filepath.Separator))
+	walkedPath := ""
+
+	var walkedDirs []fsutils.FileCopy
+
+	stat := fs.Stat
+	if keepSymlinks {
+		stat = func(path string) (os.FileInfo, error) { return fsutils.Lstat(fs, path) }
+	}
+
+	for _, subPath := range splitPath {
+		walkedPath = filepath.Join(walkedPath, subPath)
+		sourcePath := filepath.Join(from, walkedPath)
+		targetPath := filepath.Join(to, walkedPath)
+
+		sourceStat, err := stat(sourcePath)
+		if err != nil {
+			log.Error(err, "failed checking stat mode from source", "path", sourcePath)
+
+			return nil, nil, err
+		}
+
+		if sourceStat.IsDir() {
+			err := fs.Mkdir(targetPath, sourceStat.Mode())
+			if err != nil && !os.IsExist(err) {
+				log.Error(err, "failed to create new dir", "path", targetPath)
+
+				return nil, nil, err
+			}
 
-	manifestFile, err := fs.ReadFile(manifestPath)
+			log.V(1).Info("created new dir", "from", sourcePath, "to", targetPath, "mode", sourceStat.Mode())
+
+			walkedDirs = append(walkedDirs, fsutils.FileCopy{From: sourcePath, To: targetPath})
+
+			continue
+		}
+
+		return &fsutils.FileCopy{
+			From: sourcePath,
+			To:   targetPath,
+			MD5:  file.MD5,
+		}, walkedDirs, nil
+	}
+
+	return nil, walkedDirs, nil
+}
+
+// filterFilesByTechnology collects the files of the given technologies from the manifest.json, only considering the given architectures.
+// In case the archs is empty, the files of all architectures are collected.
+// In case isStrict is set, a technology that is not in the manifest.json causes an error.
+func filterFilesByTechnology(log logr.Logger, fs afero.Afero, source string, technologies, archs []string, isStrict bool) ([]FileEntry, error) {
+	manifestFile, err := fs.ReadFile(filepath.Join(source, manifestFileName))
 	if err != nil {
 		return nil, errors.WithMessage(err, "failed to open manifest.json")
 	}
 
+	manifest, err := parseManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectFiles(log, manifest, technologies, archs, isStrict)
+}
+
+func parseManifest(content []byte) (Manifest, error) {
 	var manifest Manifest
-	if err := json.Unmarshal(manifestFile, &manifest); err != nil {
-		return nil, errors.WithMessage(err, "failed to parse manifest.json")
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return Manifest{}, errors.WithMessage(err, "failed to parse manifest.json")
+	}
+
+	return manifest, nil
+}
+
+// selectFiles collects the files of the given technologies from the manifest, the same way as filterFilesByTechnology.
+func selectFiles(log logr.Logger, manifest Manifest, technologies, archs []string, isStrict bool) ([]FileEntry, error) {
+	selectedTechnologies, err := selectTechnologies(log, manifest, technologies, isStrict)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileEntry
+
+	for _, tech := range selectedTechnologies {
+		techData := manifest.Technologies[tech]
+		isArchFound := false
+
+		for arch, archFiles := range techData {
+			if len(archs) != 0 && !slices.Contains(archs, arch) {
+				log.V(1).Info("skipping architecture of technology", "tech", tech, "arch", arch)
+
+				continue
+			}
+
+			isArchFound = true
+
+			log.V(1).Info("collecting files for technology", "tech", tech, "arch", arch)
+
+			files = append(files, archFiles...)
+		}
+
+		if !isArchFound {
+			log.Info("no files found for the selected architectures of the technology", "tech", tech, "archs", archs)
+		}
 	}
 
-	var paths []string
+	return files, nil
+}
+
+// selectTechnologies resolves the requested technologies (including AllTechnologies and exclusions) to the technologies present in the manifest.json.
+// In case only exclusions are requested, every other technology is selected.
+func selectTechnologies(log logr.Logger, manifest Manifest, technologies []string, isStrict bool) ([]string, error) {
+	available := manifest.AvailableTechnologies()
+
+	var (
+		included []string
+		excluded []string
+		unknown  []string
+		isAll    bool
+	)
 
 	for _, tech := range technologies {
-		tech := strings.TrimSpace(tech)
-		techData, exists := manifest.Technologies[tech]
+		tech = strings.TrimSpace(tech)
 
-		if !exists {
+		switch {
+		case tech == "":
+			continue
+		case tech == AllTechnologies || tech == allTechnologiesAlias:
+			isAll = true
+
+			continue
+		case strings.HasPrefix(tech, excludePrefix):
+			tech = strings.TrimSpace(strings.TrimPrefix(tech, excludePrefix))
+			excluded = append(excluded, tech)
+		default:
+			included = append(included, tech)
+		}
+
+		if _, exists := manifest.Technologies[tech]; !exists {
 			log.Info("technology not found", "tech", tech)
 
+			unknown = append(unknown, tech)
+		}
+	}
+
+	if isStrict && len(unknown) > 0 {
+		return nil, errors.Errorf("unknown technologies: %s, the manifest.json provides: %s", strings.Join(unknown, ", "), strings.Join(available, ", "))
+	}
+
+	if isAll || (len(included) == 0 && len(excluded) > 0) {
+		included = available
+	}
+
+	var selected []string
+
+	for _, tech := range included {
+		_, exists := manifest.Technologies[tech]
+		if !exists || slices.Contains(excluded, tech) || slices.Contains(selected, tech) {
 			continue
 		}
 
-		for arch, files := range techData {
-			log.V(1).Info("collecting files for technology", "tech", tech, "arch", arch)
+		selected = append(selected, tech)
+	}
 
-			for _, file := range files {
-				paths = append(paths, file.Path)
-			}
+	return selected, nil
+}
+
+func splitArchs(arch string) []string {
+	var archs []string
+
+	for _, a := range strings.Split(arch, ",") {
+		a = strings.TrimSpace(a)
+		if a == AllArchs {
+			return nil
+		}
+
+		if a != "" {
+			archs = append(archs, a)
 		}
 	}
 
-	return paths, nil
+	return archs
 }
+
@@ -3,9 +3,11 @@ package move
 import (
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"testing"
 
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,13 +29,13 @@ func TestCopyFolderWithTechnologyFiltering(t *testing.T) {
         "technologies": {
             "java": {
                 "x86": [
-                    {"path": "fileA1.txt", "version": "1.0", "md5": "abc123"},
-                    {"path": "fileA2.txt", "version": "1.0", "md5": "def456"}
+                    {"path": "fileA1.txt", "version": "1.0", "md5": "47eee379f1f6bb198148c0be7188fea9"},
+                    {"path": "fileA2.txt", "version": "1.0", "md5": "395eed81862818162f051bf3c388d429"}
                 ]
             },
             "python": {
                 "arm": [
-                    {"path": "fileB1.txt", "version": "1.0", "md5": "ghi789"}
+                    {"path": "fileB1.txt", "version": "1.0", "md5": "73f4ff0d28c5f3fb00b23349009de1e9"}
                 ]
             }
         }
@@ -52,7 +54,7 @@ func TestCopyFolderWithTechnologyFiltering(t *testing.T) {
 		})
 
 		technology := "java"
-		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, technology)
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, Filter{Technology: technology}, fsutils.CopyOptions{})
 		require.NoError(t, err)
 
 		assertFileExists(t, fs, filepath.Join(targetDir, "fileA1.txt"))
@@ -67,7 +69,7 @@ func TestCopyFolderWithTechnologyFiltering(t *testing.T) {
 		})
 
 		technology := "java,python"
-		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, technology)
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, Filter{Technology: technology}, fsutils.CopyOptions{})
 		require.NoError(t, err)
 
 		assertFileExists(t, fs, filepath.Join(targetDir, "fileA1.txt"))
@@ -82,7 +84,7 @@ func TestCopyFolderWithTechnologyFiltering(t *testing.T) {
 		})
 
 		technology := "java, python"
-		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, technology)
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, Filter{Technology: technology}, fsutils.CopyOptions{})
 		require.NoError(t, err)
 
 		assertFileExists(t, fs, filepath.Join(targetDir, "fileA1.txt"))
@@ -97,7 +99,7 @@ func TestCopyFolderWithTechnologyFiltering(t *testing.T) {
 		})
 
 		technology := "php"
-		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, technology)
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, Filter{Technology: technology}, fsutils.CopyOptions{})
 		require.NoError(t, err)
 
 		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileA1.txt"))
@@ -105,6 +107,52 @@ func TestCopyFolderWithTechnologyFiltering(t *testing.T) {
 		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileB1.txt"))
 		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileC1.txt"))
 	})
+	t.Run("copy with checksum mismatch", func(t *testing.T) {
+		t.Cleanup(func() {
+			_ = fs.WriteFile(filepath.Join(sourceDir, "fileA2.txt"), []byte("java a2"), 0644)
+			_ = fs.RemoveAll(targetDir)
+			_ = fs.MkdirAll(targetDir, 0755)
+		})
+
+		_ = fs.WriteFile(filepath.Join(sourceDir, "fileA2.txt"), []byte("corrupted"), 0644)
+
+		technology := "java"
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, Filter{Technology: technology}, fsutils.CopyOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "checksum mismatch")
+
+		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileA2.txt"))
+	})
+	t.Run("copy with concurrency", func(t *testing.T) {
+		t.Cleanup(func() {
+			_ = fs.RemoveAll(targetDir)
+			_ = fs.MkdirAll(targetDir, 0755)
+		})
+
+		technology := "java,python"
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, Filter{Technology: technology}, fsutils.CopyOptions{Concurrency: 4})
+		require.NoError(t, err)
+
+		assertFileExists(t, fs, filepath.Join(targetDir, "fileA1.txt"))
+		assertFileExists(t, fs, filepath.Join(targetDir, "fileA2.txt"))
+		assertFileExists(t, fs, filepath.Join(targetDir, "fileB1.txt"))
+		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileC1.txt"))
+	})
+	t.Run("copy with arch filter", func(t *testing.T) {
+		t.Cleanup(func() {
+			_ = fs.RemoveAll(targetDir)
+			_ = fs.MkdirAll(targetDir, 0755)
+		})
+
+		filter := Filter{Technology: "java,python", Arch: "arm"}
+		err := CopyByTechnology(testLog, fs, sourceDir, targetDir, filter, fsutils.CopyOptions{})
+		require.NoError(t, err)
+
+		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileA1.txt"))
+		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileA2.txt"))
+		assertFileExists(t, fs, filepath.Join(targetDir, "fileB1.txt"))
+		assertFileNotExists(t, fs, filepath.Join(targetDir, "fileC1.txt"))
+	})
 }
 
 func TestCopyByList(t *testing.T) {
@@ -140,14 +188,14 @@ func TestCopyByList(t *testing.T) {
 	}
 
 	// reverse the list, so the longest path is the first
-	fileList := []string{}
+	fileList := []FileEntry{}
 	for i := len(dirs) - 1; i >= 0; i-- {
-		fileList = append(fileList, filepath.Join(dirs[i], filesNames[i]))
+		fileList = append(fileList, FileEntry{Path: filepath.Join(dirs[i], filesNames[i])})
 	}
 
 	targetDir := "./target"
 
-	err := copyByList(testLog, fs, "./", targetDir, fileList)
+	err := copyByList(testLog, fs, "./", targetDir, fileList, fsutils.CopyOptions{Concurrency: 2})
 	require.NoError(t, err)
 
 	for i := range dirs {
@@ -169,6 +217,57 @@ func TestCopyByList(t *testing.T) {
 	}
 }
 
+func TestCopyByListWithPathFilter(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	fileList := []FileEntry{{Path: "agent/bin/oneagent"}, {Path: "agent/bin/oneagent.debug"}, {Path: "docs/readme.md"}}
+
+	for _, file := range fileList {
+		require.NoError(t, fs.WriteFile(filepath.Join("/src", file.Path), []byte(file.Path), 0644))
+	}
+
+	paths, err := fsutils.NewPathFilter(nil, []string{"docs", "**/*.debug"})
+	require.NoError(t, err)
+
+	err = copyByList(testLog, fs, "/src", "/target", fileList, fsutils.CopyOptions{PathFilter: paths})
+	require.NoError(t, err)
+
+	exists, err := fs.Exists("/target/agent/bin/oneagent")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = fs.Exists("/target/agent/bin/oneagent.debug")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = fs.DirExists("/target/docs")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestCopyByListIncremental(t *testing.T) {
+	fs := afero.Afero{Fs: afero.NewMemMapFs()}
+	fileList := []FileEntry{{Path: "agent/bin/java.so"}, {Path: "agent/bin/php/php.so"}}
+
+	for _, file := range fileList {
+		require.NoError(t, fs.WriteFile(filepath.Join("/src", file.Path), []byte(file.Path), 0644))
+	}
+
+	err := copyByList(testLog, fs, "/src", "/target", fileList, fsutils.CopyOptions{Incremental: true})
+	require.NoError(t, err)
+
+	// php is no longer selected (or was removed from the source)
+	err = copyByList(testLog, fs, "/src", "/target", fileList[:1], fsutils.CopyOptions{Incremental: true})
+	require.NoError(t, err)
+
+	exists, err := fs.Exists("/target/agent/bin/java.so")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = fs.DirExists("/target/agent/bin/php")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestFilterFilesByTechnology(t *testing.T) {
 	fs := afero.Afero{Fs: afero.NewMemMapFs()}
 
@@ -193,41 +292,114 @@ func TestFilterFilesByTechnology(t *testing.T) {
 	_ = afero.WriteFile(fs, filepath.Join(sourceDir, "manifest.json"), []byte(manifestContent), 0644)
 
 	t.Run("filter single technology", func(t *testing.T) {
-		paths, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java"})
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java"}, nil, false)
 		require.NoError(t, err)
-		assert.ElementsMatch(t, []string{
-			"fileA1.txt",
-			"fileA2.txt",
-		}, paths)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "fileA1.txt", Version: "1.0", MD5: "abc123"},
+			{Path: "fileA2.txt", Version: "1.0", MD5: "def456"},
+		}, files)
 	})
 	t.Run("filter multiple technologies", func(t *testing.T) {
-		paths, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "python"})
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "python"}, nil, false)
 		require.NoError(t, err)
-		assert.ElementsMatch(t, []string{
-			"fileA1.txt",
-			"fileA2.txt",
-			"fileB1.txt",
-		}, paths)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "fileA1.txt", Version: "1.0", MD5: "abc123"},
+			{Path: "fileA2.txt", Version: "1.0", MD5: "def456"},
+			{Path: "fileB1.txt", Version: "1.0", MD5: "ghi789"},
+		}, files)
 	})
 	t.Run("filter multiple technologies with white spaces", func(t *testing.T) {
-		paths, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java ", " python "})
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java ", " python "}, nil, false)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "fileA1.txt", Version: "1.0", MD5: "abc123"},
+			{Path: "fileA2.txt", Version: "1.0", MD5: "def456"},
+			{Path: "fileB1.txt", Version: "1.0", MD5: "ghi789"},
+		}, files)
+	})
+	t.Run("filter by arch", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "python"}, []string{"arm"}, false)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "fileB1.txt", Version: "1.0", MD5: "ghi789"},
+		}, files)
+	})
+	t.Run("filter by multiple archs", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "python"}, splitArchs("x86, arm"), false)
+		require.NoError(t, err)
+		assert.Len(t, files, 3)
+	})
+	t.Run("filter by all archs", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "python"}, splitArchs(AllArchs), false)
+		require.NoError(t, err)
+		assert.Len(t, files, 3)
+	})
+	t.Run("default arch -> includes the libc flavors of the CPU architecture", func(t *testing.T) {
+		archs := splitArchs(DefaultArch())
+		assert.Equal(t, CPUArch(), archs[0])
+
+		if CPUArch() == archX86 {
+			assert.Contains(t, archs, archMusl)
+		}
+	})
+	t.Run("not filter non-existing arch", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java"}, []string{"musl"}, false)
 		require.NoError(t, err)
-		assert.ElementsMatch(t, []string{
-			"fileA1.txt",
-			"fileA2.txt",
-			"fileB1.txt",
-		}, paths)
+		assert.Empty(t, files)
 	})
 	t.Run("not filter non-existing technology", func(t *testing.T) {
-		paths, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"php"})
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"php"}, nil, false)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+	t.Run("filter all technologies", func(t *testing.T) {
+		for _, all := range []string{"all", "*", " all "} {
+			files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{all}, nil, false)
+			require.NoError(t, err)
+			assert.Len(t, files, 3, all)
+		}
+	})
+	t.Run("filter all technologies with exclusion", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"all", "!python"}, nil, false)
 		require.NoError(t, err)
-		assert.Empty(t, paths)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "fileA1.txt", Version: "1.0", MD5: "abc123"},
+			{Path: "fileA2.txt", Version: "1.0", MD5: "def456"},
+		}, files)
+	})
+	t.Run("filter only exclusions -> all others", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"!java"}, nil, false)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []FileEntry{
+			{Path: "fileB1.txt", Version: "1.0", MD5: "ghi789"},
+		}, files)
+	})
+	t.Run("filter technology and exclude it -> nothing", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "!java"}, nil, false)
+		require.NoError(t, err)
+		assert.Empty(t, files)
+	})
+	t.Run("strict with known technologies -> no error", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"all", "!python"}, nil, true)
+		require.NoError(t, err)
+		assert.Len(t, files, 2)
+	})
+	t.Run("strict with unknown technology -> error with available technologies", func(t *testing.T) {
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java", "pyhton"}, nil, true)
+		require.Error(t, err)
+		assert.Nil(t, files)
+		assert.Contains(t, err.Error(), "pyhton")
+		assert.Contains(t, err.Error(), "java, python")
+	})
+	t.Run("strict with unknown excluded technology -> error", func(t *testing.T) {
+		_, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"all", "!php"}, nil, true)
+		require.Error(t, err)
 	})
 	t.Run("filter with missing manifest", func(t *testing.T) {
 		fs := afero.Afero{Fs: afero.NewMemMapFs()}
-		paths, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java"})
+		files, err := filterFilesByTechnology(testLog, fs, sourceDir, []string{"java"}, nil, false)
 		require.Error(t, err)
-		assert.Nil(t, paths)
+		assert.Nil(t, files)
 	})
 }
 
@@ -245,3 +417,30 @@ func assertFileNotExists(t *testing.T, fs afero.Fs, path string) {
 	require.NoError(t, err)
 	assert.False(t, exists, "file should not exist: "+path)
 }
+
+func TestCopyByListPreserveMetadata(t *testing.T) {
+	base := t.TempDir()
+	source := filepath.Join(base, "source")
+	target := filepath.Join(base, "target")
+	fs := afero.Afero{Fs: afero.NewOsFs()}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "agent", "bin", "1.2.3"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "agent", "bin", "1.2.3", "agent.so"), []byte("agent"), 0644))
+	require.NoError(t, os.Symlink("1.2.3", filepath.Join(source, "agent", "bin", "current")))
+
+	files := []FileEntry{
+		{Path: "agent/bin/1.2.3/agent.so"},
+		{Path: "agent/bin/current"},
+	}
+
+	err := copyByList(testLog, fs, source, target, files, fsutils.CopyOptions{PreserveMetadata: true})
+	require.NoError(t, err)
+
+	linkTarget, err := os.Readlink(filepath.Join(target, "agent", "bin", "current"))
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", linkTarget)
+
+	content, err := os.ReadFile(filepath.Join(target, "agent", "bin", "current", "agent.so"))
+	require.NoError(t, err)
+	assert.Equal(t, "agent", string(content))
+}
@@ -0,0 +1,128 @@
+package move
+
+import (
+	"path/filepath"
+	"strings"
+
+	fsutils "github.com/rkitindi-kr/dynatrace-bootstrapper/pkg/utils/fs"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// VerifyTargetWrapper returns a VerifyFunc that checks the target against the files the Filter selects from the source.
+func VerifyTargetWrapper(filter Filter, cache *SourceCache) VerifyFunc {
+	return func(log logr.Logger, fs afero.Afero, from, to string) error {
+		if IsArchive(from) {
+			return verifyArchiveTarget(log, fs, from, to, filter, cache)
+		}
+
+		files, err := ListFiles(log, fs, from, filter)
+		if err != nil {
+			return err
+		}
+
+		return VerifyTarget(log, fs, from, to, files)
+	}
+}
+
+// VerifyTarget checks that the installer.version of the target matches the one of the source,
+// and that every file (relative to `from`) is present in the target with the same size, and md5 checksum in case the FileEntry has one.
+func VerifyTarget(log logr.Logger, fs afero.Afero, from, to string, files []FileEntry) error {
+	sourceVersion, err := fs.ReadFile(filepath.Join(from, InstallerVersionFilePath))
+	if err != nil {
+		return errors.WithMessage(err, "failed to read the installer.version of the source")
+	}
+
+	err = verifyInstallerVersion(fs, sourceVersion, to)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		sourceInfo, err := fs.Stat(filepath.Join(from, file.Path))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = verifyTargetFile(fs, to, file, sourceInfo.Size())
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("verified target", "target", to, "files", len(files))
+
+	return nil
+}
+
+// verifyArchiveTarget checks the target the same way as VerifyTarget, but against the entries of the archive.
+func verifyArchiveTarget(log logr.Logger, fs afero.Afero, from, to string, filter Filter, cache *SourceCache) error {
+	sourceVersion, err := readArchiveFile(fs, from, InstallerVersionFilePath, cache)
+	if err != nil {
+		return errors.WithMessage(err, "failed to read the installer.version of the source")
+	}
+
+	entries, selected, err := listArchiveFiles(log, fs, from, filter, cache)
+	if err != nil {
+		return err
+	}
+
+	return verifyExtractedTarget(log, fs, to, sourceVersion, entries, selected)
+}
+
+// verifyExtractedTarget checks the target the same way as VerifyTarget, but against the (regular file) entries of an archive or image.
+func verifyExtractedTarget(log logr.Logger, fs afero.Afero, to string, sourceVersion []byte, entries []archiveEntry, selected map[string]FileEntry) error {
+	err := verifyInstallerVersion(fs, sourceVersion, to)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		file, ok := selected[entry.path]
+		if !ok {
+			file = FileEntry{Path: entry.path}
+		}
+
+		err = verifyTargetFile(fs, to, file, entry.size)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("verified target", "target", to, "files", len(entries))
+
+	return nil
+}
+
+func verifyTargetFile(fs afero.Afero, to string, file FileEntry, size int64) error {
+	targetPath := filepath.Join(to, file.Path)
+
+	targetInfo, err := fs.Stat(targetPath)
+	if err != nil {
+		return errors.WithMessagef(err, "file %s is missing from the target", file.Path)
+	}
+
+	if size != targetInfo.Size() {
+		return errors.Errorf("size mismatch for %s: expected %d bytes, got %d bytes", file.Path, size, targetInfo.Size())
+	}
+
+	if file.MD5 != "" {
+		return fsutils.VerifyMD5(fs, targetPath, file.MD5)
+	}
+
+	return nil
+}
+
+func verifyInstallerVersion(fs afero.Afero, sourceVersion []byte, to string) error {
+	targetVersion, err := fs.ReadFile(filepath.Join(to, InstallerVersionFilePath))
+	if err != nil {
+		return errors.WithMessage(err, "failed to read the installer.version of the target")
+	}
+
+	if strings.TrimSpace(string(sourceVersion)) != strings.TrimSpace(string(targetVersion)) {
+		return errors.Errorf("installer.version mismatch: expected %s, got %s", strings.TrimSpace(string(sourceVersion)), strings.TrimSpace(string(targetVersion)))
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package move
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyTarget(t *testing.T) {
+	source := "/source"
+	target := "/target"
+
+	setup := func(t *testing.T, targetVersion, targetContent string) afero.Afero {
+		t.Helper()
+
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		require.NoError(t, fs.WriteFile(filepath.Join(source, InstallerVersionFilePath), []byte("1.2.3\n"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(source, "file.txt"), []byte("content"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, InstallerVersionFilePath), []byte(targetVersion), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(target, "file.txt"), []byte(targetContent), 0644))
+
+		return fs
+	}
+
+	files := []FileEntry{{Path: "file.txt", MD5: "9a0364b9e99bb480dd25e1f0284c8555"}}
+
+	t.Run("same version and files -> verified", func(t *testing.T) {
+		fs := setup(t, "1.2.3", "content")
+
+		require.NoError(t, VerifyTarget(testLog, fs, source, target, files))
+	})
+	t.Run("different version -> error", func(t *testing.T) {
+		fs := setup(t, "1.2.4", "content")
+
+		require.ErrorContains(t, VerifyTarget(testLog, fs, source, target, files), "installer.version mismatch")
+	})
+	t.Run("different size -> error", func(t *testing.T) {
+		fs := setup(t, "1.2.3", "other content")
+
+		require.ErrorContains(t, VerifyTarget(testLog, fs, source, target, files), "size mismatch")
+	})
+	t.Run("different content -> error", func(t *testing.T) {
+		fs := setup(t, "1.2.3", "CONTENT")
+
+		require.ErrorContains(t, VerifyTarget(testLog, fs, source, target, files), "checksum mismatch")
+	})
+	t.Run("missing file -> error", func(t *testing.T) {
+		fs := setup(t, "1.2.3", "content")
+		require.NoError(t, fs.WriteFile(filepath.Join(source, "missing.txt"), []byte("content"), 0644))
+
+		require.ErrorContains(t, VerifyTarget(testLog, fs, source, target, []FileEntry{{Path: "missing.txt"}}), "is missing from the target")
+	})
+}
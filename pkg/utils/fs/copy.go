@@ -1,9 +1,14 @@
 package fs
 
 import (
+	"crypto/md5" //nolint:gosec // the manifest.json of the CodeModule only provides md5 checksums
+	"encoding/hex"
+	"hash"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -11,50 +16,197 @@ import (
 )
 
 func CopyFolder(log logr.Logger, fs afero.Fs, from string, to string) error {
-	fromInfo, err := fs.Stat(from)
+	return CopyFolderWithOptions(log, fs, from, to, CopyOptions{})
+}
+
+// CopyFolderWithOptions copies the folder the same way as CopyFolder, but according to the provided CopyOptions.
+// The directories are created first (sequentially), so their modes are set the same way regardless of the concurrency, only the files are copied concurrently.
+// In case of a PathFilter, only the selected files (and the dirs that lead to them) are copied.
+// In case of Incremental, the files of `to` that are not part of the copy are removed afterwards, see RemoveStale.
+func CopyFolderWithOptions(log logr.Logger, fs afero.Fs, from string, to string, opts CopyOptions) error {
+	var tree folderTree
+
+	err := createFolderTree(log, fs, from, to, opts.PathFilter, &tree)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 
-	if !fromInfo.IsDir() {
-		return errors.Errorf("%s is not a directory", from)
+	err = CopyFiles(log, fs, tree.files, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Incremental {
+		err = RemoveStale(log, fs, to, tree.files, tree.dirs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.PreserveMetadata {
+		return RestoreDirMetadata(fs, tree.dirs)
 	}
 
-	err = fs.MkdirAll(to, fromInfo.Mode())
+	return nil
+}
+
+// folderTree collects the dirs (parents first) and files of a folder, that were found while creating its copy.
+type folderTree struct {
+	dirs []FileCopy
+	// dirModes are the modes of the dirs, in the same order.
+	dirModes []os.FileMode
+	files    []FileCopy
+}
+
+// createFolderTree recreates the directory structure of `from` in `to` and collects the files that need to be copied.
+func createFolderTree(log logr.Logger, fs afero.Fs, from string, to string, filter *PathFilter, tree *folderTree) error {
+	_, err := collectFolderTree(log, fs, from, to, "", filter, tree)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
+	}
+
+	for i, dir := range tree.dirs {
+		err = fs.MkdirAll(dir.To, tree.dirModes[i])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// collectFolderTree walks `from` and collects the dirs and files that the PathFilter selects, the relativePath is the one of `from` inside the root of the copy.
+// Returns false in case nothing inside of the dir is selected (which is only possible in case of Include patterns), the dir is not collected in that case, unless it is the root.
+func collectFolderTree(log logr.Logger, fs afero.Fs, from, to, relativePath string, filter *PathFilter, tree *folderTree) (bool, error) {
+	fromInfo, err := fs.Stat(from)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if !fromInfo.IsDir() {
+		return false, errors.Errorf("%s is not a directory", from)
 	}
 
+	dirIndex := len(tree.dirs)
+	tree.dirs = append(tree.dirs, FileCopy{From: from, To: to})
+	tree.dirModes = append(tree.dirModes, fromInfo.Mode())
+
 	entries, err := afero.ReadDir(fs, from)
 	if err != nil {
-		return errors.WithStack(err)
+		return false, errors.WithStack(err)
 	}
 
+	isSelected := !filter.hasIncludes()
+
 	for _, entry := range entries {
 		fromPath := filepath.Join(from, entry.Name())
 		toPath := filepath.Join(to, entry.Name())
+		entryPath := path.Join(relativePath, entry.Name())
 
-		if entry.IsDir() {
+		switch {
+		case entry.IsDir() && filter.ExcludesDir(entryPath):
+			log.V(1).Info("excluding directory", "from", fromPath)
+		case entry.IsDir():
 			log.V(1).Info("copying directory", "from", fromPath, "to", toPath)
 
-			err = CopyFolder(log, fs, fromPath, toPath)
+			isDirSelected, err := collectFolderTree(log, fs, fromPath, toPath, entryPath, filter, tree)
 			if err != nil {
-				return err
+				return false, err
 			}
-		} else {
-			log.V(1).Info("copying file", "from", fromPath, "to", toPath)
 
-			err = CopyFile(fs, fromPath, toPath)
-			if err != nil {
-				return err
-			}
+			isSelected = isSelected || isDirSelected
+		case filter.Selects(entryPath):
+			tree.files = append(tree.files, FileCopy{From: fromPath, To: toPath})
+			isSelected = true
+		default:
+			log.V(1).Info("excluding file", "from", fromPath)
 		}
 	}
 
-	return nil
+	if !isSelected && relativePath != "" {
+		tree.dirs = tree.dirs[:dirIndex]
+		tree.dirModes = tree.dirModes[:dirIndex]
+	}
+
+	return isSelected, nil
 }
 
 func CopyFile(fs afero.Fs, sourcePath string, destinationPath string) error {
+	return copyFile(fs, sourcePath, destinationPath, nil, nil)
+}
+
+// CopyFileWithThrottle copies the file the same way as CopyFile, but reads it through the Throttle, so it counts towards (and is limited by) it.
+func CopyFileWithThrottle(fs afero.Fs, sourcePath, destinationPath string, throttle *Throttle) error {
+	return copyFile(fs, sourcePath, destinationPath, nil, throttle)
+}
+
+// CopyFileWithMD5 copies the file the same way as CopyFile, but also calculates the md5 checksum of the content while it is copied.
+// In case the checksum doesn't match the expected one, the copied file is removed and an error is returned.
+func CopyFileWithMD5(fs afero.Fs, sourcePath, destinationPath, expectedMD5 string) error {
+	_, err := CopyFileWithChecksum(fs, sourcePath, destinationPath, expectedMD5)
+
+	return err
+}
+
+// CopyFileWithChecksum copies the file the same way as CopyFileWithMD5, but only verifies the checksum in case the expectedMD5 is set.
+// Returns the md5 checksum of the copied content.
+func CopyFileWithChecksum(fs afero.Fs, sourcePath, destinationPath, expectedMD5 string) (string, error) {
+	return copyFileWithChecksum(fs, sourcePath, destinationPath, expectedMD5, nil)
+}
+
+func copyFileWithChecksum(fs afero.Fs, sourcePath, destinationPath, expectedMD5 string, throttle *Throttle) (string, error) {
+	hasher := md5.New() //nolint:gosec // the manifest.json of the CodeModule only provides md5 checksums
+
+	err := copyFile(fs, sourcePath, destinationPath, hasher, throttle)
+	if err != nil {
+		return "", err
+	}
+
+	if expectedMD5 != "" {
+		err = checkMD5(sourcePath, expectedMD5, hasher)
+		if err != nil {
+			_ = fs.Remove(destinationPath)
+
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// VerifyMD5 reads the whole file and compares its md5 checksum with the expected one.
+func VerifyMD5(fs afero.Fs, path, expectedMD5 string) error {
+	return verifyMD5(fs, path, expectedMD5, nil)
+}
+
+func verifyMD5(fs afero.Fs, path, expectedMD5 string, throttle *Throttle) error {
+	file, err := fs.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	hasher := md5.New() //nolint:gosec // the manifest.json of the CodeModule only provides md5 checksums
+
+	_, err = io.Copy(hasher, throttle.Reader(file))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return checkMD5(path, expectedMD5, hasher)
+}
+
+func checkMD5(path, expectedMD5 string, hasher hash.Hash) error {
+	actualMD5 := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(actualMD5, expectedMD5) {
+		return errors.Errorf("checksum mismatch for %s: expected md5 %s, got %s", path, expectedMD5, actualMD5)
+	}
+
+	return nil
+}
+
+func copyFile(fs afero.Fs, sourcePath string, destinationPath string, hasher hash.Hash, throttle *Throttle) error {
 	sourceFile, err := fs.Open(sourcePath)
 	if err != nil {
 		return errors.WithStack(err)
@@ -67,14 +219,55 @@ func CopyFile(fs afero.Fs, sourcePath string, destinationPath string) error {
 		return errors.WithStack(err)
 	}
 
-	destinationFile, err := fs.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode())
+	return writeFile(fs, throttle.Reader(sourceFile), destinationPath, sourceInfo.Mode(), hasher)
+}
+
+// WriteFileWithMD5 writes the content of the reader to the destinationPath with the given mode, and in case the expectedMD5 is set, verifies its checksum.
+// In case the checksum doesn't match the expected one, the written file is removed and an error is returned.
+func WriteFileWithMD5(fs afero.Fs, source io.Reader, destinationPath string, mode os.FileMode, expectedMD5 string) error {
+	if expectedMD5 == "" {
+		return writeFile(fs, source, destinationPath, mode, nil)
+	}
+
+	_, err := WriteFileWithChecksum(fs, source, destinationPath, mode, expectedMD5)
+
+	return err
+}
+
+// WriteFileWithChecksum writes the content the same way as WriteFileWithMD5, but always calculates the md5 checksum of the content and returns it.
+func WriteFileWithChecksum(fs afero.Fs, source io.Reader, destinationPath string, mode os.FileMode, expectedMD5 string) (string, error) {
+	hasher := md5.New() //nolint:gosec // the manifest.json of the CodeModule only provides md5 checksums
+
+	err := writeFile(fs, source, destinationPath, mode, hasher)
+	if err != nil {
+		return "", err
+	}
+
+	if expectedMD5 != "" {
+		err = checkMD5(destinationPath, expectedMD5, hasher)
+		if err != nil {
+			_ = fs.Remove(destinationPath)
+
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func writeFile(fs afero.Fs, source io.Reader, destinationPath string, mode os.FileMode, hasher hash.Hash) error {
+	destinationFile, err := fs.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
 	defer func() { _ = destinationFile.Close() }()
 
-	_, err = io.Copy(destinationFile, sourceFile)
+	if hasher != nil {
+		source = io.TeeReader(source, hasher)
+	}
+
+	_, err = io.Copy(destinationFile, source)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -116,3 +116,42 @@ func checkFolder(t *testing.T, fs afero.Fs, src, dst string) {
 		}
 	}
 }
+
+func TestCopyFileWithMD5(t *testing.T) {
+	source := "/source/file1.txt"
+	target := "/target/file1.txt"
+	contentMD5 := "9893532233caff98cd083a116b013c0b" // md5 of "some content"
+
+	t.Run("matching checksum -> file copied", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := afero.WriteFile(fs, source, []byte("some content"), 0644)
+		require.NoError(t, err)
+
+		err = fs.MkdirAll(filepath.Dir(target), 0755)
+		require.NoError(t, err)
+
+		err = CopyFileWithMD5(fs, source, target, contentMD5)
+		require.NoError(t, err)
+
+		targetContent, err := afero.ReadFile(fs, target)
+		require.NoError(t, err)
+		assert.Equal(t, "some content", string(targetContent))
+	})
+	t.Run("mismatching checksum -> error, file removed", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := afero.WriteFile(fs, source, []byte("corrupted content"), 0644)
+		require.NoError(t, err)
+
+		err = fs.MkdirAll(filepath.Dir(target), 0755)
+		require.NoError(t, err)
+
+		err = CopyFileWithMD5(fs, source, target, contentMD5)
+		require.Error(t, err)
+
+		exists, err := afero.Exists(fs, target)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
@@ -0,0 +1,18 @@
+package fs
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+var ErrExchangeNotSupported = errors.New("exchanging paths is not supported")
+
+// Exchange atomically swaps the 2 (existing) paths, so there is no point in time where neither of them exists.
+// Returns ErrExchangeNotSupported in case the afero.Fs is not the real filesystem, or the platform/filesystem doesn't support it.
+func Exchange(fs afero.Fs, oldPath, newPath string) error {
+	if !isOsFs(fs) {
+		return errors.WithStack(ErrExchangeNotSupported)
+	}
+
+	return exchange(oldPath, newPath)
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package fs
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func exchange(oldPath, newPath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_EXCHANGE)
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		return errors.Wrap(ErrExchangeNotSupported, err.Error())
+	}
+
+	return errors.WithStack(err)
+}
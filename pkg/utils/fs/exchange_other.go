@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fs
+
+import (
+	"github.com/pkg/errors"
+)
+
+func exchange(_, _ string) error {
+	return errors.WithStack(ErrExchangeNotSupported)
+}
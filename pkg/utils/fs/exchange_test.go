@@ -0,0 +1,39 @@
+package fs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchange(t *testing.T) {
+	t.Run("real fs -> paths swapped", func(t *testing.T) {
+		fs := afero.Afero{Fs: afero.NewOsFs()}
+		base := t.TempDir()
+		oldPath := filepath.Join(base, "old")
+		newPath := filepath.Join(base, "new")
+
+		require.NoError(t, fs.MkdirAll(oldPath, 0755))
+		require.NoError(t, fs.MkdirAll(newPath, 0755))
+		require.NoError(t, fs.WriteFile(filepath.Join(oldPath, "old.txt"), []byte("old"), 0644))
+		require.NoError(t, fs.WriteFile(filepath.Join(newPath, "new.txt"), []byte("new"), 0644))
+
+		err := Exchange(fs, oldPath, newPath)
+		if errors.Is(err, ErrExchangeNotSupported) {
+			t.Skip("exchange is not supported by the filesystem of the temp dir")
+		}
+
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(oldPath, "new.txt"))
+		assert.FileExists(t, filepath.Join(newPath, "old.txt"))
+	})
+	t.Run("not the real fs -> not supported", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		require.ErrorIs(t, Exchange(fs, "/old", "/new"), ErrExchangeNotSupported)
+	})
+}
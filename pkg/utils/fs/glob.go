@@ -0,0 +1,267 @@
+package fs
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const doubleStar = "**"
+
+// PathFilter selects the paths of a copy by glob patterns in doublestar syntax, the paths are relative to the root of the copy and use forward slashes.
+// Besides the syntax of path.Match (`*`, `?`, `[...]`) a pattern supports `**` as a whole segment, which matches zero or more dirs, and `{a,b}` alternatives.
+// Exclude patterns win over Include patterns, an excluded dir excludes everything inside of it.
+// Include patterns only apply to files, in case there are none every file is included.
+// The methods can be called on a nil PathFilter, which selects everything.
+type PathFilter struct {
+	include [][]string
+	exclude [][]string
+}
+
+// NewPathFilter parses the patterns, a leading `/` or `./` of a pattern is ignored, as every pattern is relative to the root of the copy.
+func NewPathFilter(include, exclude []string) (*PathFilter, error) {
+	var (
+		filter PathFilter
+		err    error
+	)
+
+	filter.include, err = parseGlobs(include)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.exclude, err = parseGlobs(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filter, nil
+}
+
+// IsEmpty checks if the PathFilter selects everything.
+func (f *PathFilter) IsEmpty() bool {
+	return f == nil || (len(f.include) == 0 && len(f.exclude) == 0)
+}
+
+// Selects checks if the file is copied, meaning neither it nor one of its parent dirs is excluded, and it is included.
+func (f *PathFilter) Selects(filePath string) bool {
+	if f == nil {
+		return true
+	}
+
+	segments := splitGlobPath(filePath)
+
+	for i := 1; i <= len(segments); i++ {
+		if matchAnyGlob(f.exclude, segments[:i]) {
+			return false
+		}
+	}
+
+	return !f.hasIncludes() || matchAnyGlob(f.include, segments)
+}
+
+// ExcludesDir checks if the dir (and so everything inside of it) is excluded, the parent dirs are expected to be checked already.
+func (f *PathFilter) ExcludesDir(dirPath string) bool {
+	if f == nil {
+		return false
+	}
+
+	return matchAnyGlob(f.exclude, splitGlobPath(dirPath))
+}
+
+func (f *PathFilter) hasIncludes() bool {
+	return f != nil && len(f.include) > 0
+}
+
+// MatchGlob checks if the path matches the pattern in doublestar syntax, see PathFilter.
+func MatchGlob(pattern, filePath string) (bool, error) {
+	globs, err := parseGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return matchAnyGlob(globs, splitGlobPath(filePath)), nil
+}
+
+func parseGlobs(patterns []string) ([][]string, error) {
+	globs := make([][]string, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		parsed, err := parseGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		globs = append(globs, parsed...)
+	}
+
+	return globs, nil
+}
+
+// parseGlob expands the alternatives of the pattern and splits each of the results into its segments.
+func parseGlob(pattern string) ([][]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "/")
+	if trimmed == "" {
+		return nil, errors.Errorf("invalid glob pattern %q: empty", pattern)
+	}
+
+	expanded, err := expandBraces(trimmed)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "invalid glob pattern %q", pattern)
+	}
+
+	globs := make([][]string, 0, len(expanded))
+
+	for _, expandedPattern := range expanded {
+		segments := strings.Split(expandedPattern, "/")
+
+		for _, segment := range segments {
+			// path.Match only reports a malformed pattern, if it is compared with something
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, errors.WithMessagef(err, "invalid glob pattern %q", pattern)
+			}
+		}
+
+		globs = append(globs, segments)
+	}
+
+	return globs, nil
+}
+
+// expandBraces returns every alternative of the pattern, for example "a{b,c{d,e}}" results in "ab", "acd" and "ace".
+func expandBraces(pattern string) ([]string, error) {
+	start, end, err := findBraces(pattern)
+	if err != nil {
+		return nil, err
+	} else if start < 0 {
+		return []string{pattern}, nil
+	}
+
+	alternatives := splitAlternatives(pattern[start+1 : end])
+	expanded := make([]string, 0, len(alternatives))
+
+	for _, alternative := range alternatives {
+		rest, err := expandBraces(pattern[:start] + alternative + pattern[end+1:])
+		if err != nil {
+			return nil, err
+		}
+
+		expanded = append(expanded, rest...)
+	}
+
+	return expanded, nil
+}
+
+// findBraces returns the positions of the first `{` and its matching `}`, or -1 in case the pattern has no (unescaped) braces.
+func findBraces(pattern string) (start, end int, err error) {
+	start = -1
+	depth := 0
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+
+			depth++
+		case '}':
+			if depth == 0 {
+				return 0, 0, errors.New("unexpected '}'")
+			}
+
+			depth--
+
+			if depth == 0 {
+				return start, i, nil
+			}
+		}
+	}
+
+	if depth > 0 {
+		return 0, 0, errors.New("missing '}'")
+	}
+
+	return -1, -1, nil
+}
+
+// splitAlternatives splits the content of braces at the commas that are not part of nested braces.
+func splitAlternatives(content string) []string {
+	var alternatives []string
+
+	depth := 0
+	last := 0
+
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, content[last:i])
+				last = i + 1
+			}
+		}
+	}
+
+	return append(alternatives, content[last:])
+}
+
+func splitGlobPath(filePath string) []string {
+	cleaned := path.Clean(strings.TrimPrefix(filePath, "/"))
+	if cleaned == "." {
+		return nil
+	}
+
+	return strings.Split(cleaned, "/")
+}
+
+func matchAnyGlob(globs [][]string, segments []string) bool {
+	for _, glob := range globs {
+		if matchSegments(glob, segments) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchSegments(glob, segments []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == doubleStar {
+			// consecutive `**` match the same as a single one
+			for len(glob) > 0 && glob[0] == doubleStar {
+				glob = glob[1:]
+			}
+
+			for i := range len(segments) + 1 {
+				if matchSegments(glob, segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		// the pattern is validated already, so the error can be ignored
+		if isMatch, _ := path.Match(glob[0], segments[0]); !isMatch {
+			return false
+		}
+
+		glob = glob[1:]
+		segments = segments[1:]
+	}
+
+	return len(segments) == 0
+}
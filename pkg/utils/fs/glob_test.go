@@ -0,0 +1,149 @@
+package fs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		isMatch bool
+	}{
+		{pattern: "agent/conf/*.sample", path: "agent/conf/ruxitagentproc.conf.sample", isMatch: true},
+		{pattern: "agent/conf/*.sample", path: "agent/conf/sub/a.sample", isMatch: false},
+		{pattern: "**/*.log", path: "a.log", isMatch: true},
+		{pattern: "**/*.log", path: "agent/log/a.log", isMatch: true},
+		{pattern: "**/*.log", path: "agent/log/a.txt", isMatch: false},
+		{pattern: "docs/**", path: "docs", isMatch: true},
+		{pattern: "docs/**", path: "docs/a/b.md", isMatch: true},
+		{pattern: "docs/**", path: "other/docs/a.md", isMatch: false},
+		{pattern: "agent/**/debug/**/*.debug", path: "agent/debug/lib.debug", isMatch: true},
+		{pattern: "agent/**/**/*.debug", path: "agent/x/y/lib.debug", isMatch: true},
+		{pattern: "**/*.{so,dll}", path: "agent/lib64/liboneagent.so", isMatch: true},
+		{pattern: "**/*.{so,dll}", path: "agent/lib64/oneagent.dll", isMatch: true},
+		{pattern: "**/*.{so,dll}", path: "agent/lib64/oneagent.dylib", isMatch: false},
+		{pattern: "{agent/{bin,lib},docs}/*", path: "agent/lib/a", isMatch: true},
+		{pattern: "/agent/?in/*", path: "agent/bin/a", isMatch: true},
+		{pattern: "./agent/[bl]*/a", path: "agent/lib/a", isMatch: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.pattern+" + "+testCase.path, func(t *testing.T) {
+			isMatch, err := MatchGlob(testCase.pattern, testCase.path)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.isMatch, isMatch)
+		})
+	}
+
+	t.Run("invalid pattern -> error", func(t *testing.T) {
+		for _, pattern := range []string{"", "/", "a/[b", "a/{b,c", "a/b}"} {
+			_, err := MatchGlob(pattern, "a/b")
+			require.Error(t, err, pattern)
+		}
+	})
+}
+
+func TestPathFilter(t *testing.T) {
+	t.Run("nil filter -> everything selected", func(t *testing.T) {
+		var filter *PathFilter
+
+		assert.True(t, filter.IsEmpty())
+		assert.True(t, filter.Selects("agent/bin/a"))
+		assert.False(t, filter.ExcludesDir("agent"))
+	})
+	t.Run("exclude -> file and files of excluded dirs not selected", func(t *testing.T) {
+		filter, err := NewPathFilter(nil, []string{"docs", "**/*.log"})
+		require.NoError(t, err)
+
+		assert.False(t, filter.Selects("docs/readme.md"))
+		assert.False(t, filter.Selects("agent/log/a.log"))
+		assert.True(t, filter.Selects("agent/bin/a"))
+		assert.True(t, filter.ExcludesDir("docs"))
+	})
+	t.Run("include -> only included files selected", func(t *testing.T) {
+		filter, err := NewPathFilter([]string{"agent/bin/**"}, nil)
+		require.NoError(t, err)
+
+		assert.True(t, filter.Selects("agent/bin/a"))
+		assert.False(t, filter.Selects("agent/lib/a"))
+		assert.False(t, filter.ExcludesDir("agent/lib"))
+	})
+	t.Run("include and exclude -> exclude wins", func(t *testing.T) {
+		filter, err := NewPathFilter([]string{"agent/**"}, []string{"agent/bin/*.debug"})
+		require.NoError(t, err)
+
+		assert.True(t, filter.Selects("agent/bin/a"))
+		assert.False(t, filter.Selects("agent/bin/a.debug"))
+	})
+	t.Run("invalid pattern -> error", func(t *testing.T) {
+		_, err := NewPathFilter([]string{"a/[b"}, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestCopyFolderWithPathFilter(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	src := "/src"
+
+	for _, file := range []string{"agent/bin/oneagent", "agent/bin/oneagent.debug", "agent/conf/a.conf.sample", "docs/readme.md", "installer.version"} {
+		require.NoError(t, afero.WriteFile(fs, filepath.Join(src, file), []byte(file), 0644))
+	}
+
+	t.Run("exclude -> excluded files and dirs not copied", func(t *testing.T) {
+		dst := "/dst-exclude"
+		filter, err := NewPathFilter(nil, []string{"docs/**", "**/*.{debug,sample}"})
+		require.NoError(t, err)
+
+		err = CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{PathFilter: filter})
+		require.NoError(t, err)
+
+		assertExists(t, fs, filepath.Join(dst, "agent/bin/oneagent"), true)
+		assertExists(t, fs, filepath.Join(dst, "installer.version"), true)
+		assertExists(t, fs, filepath.Join(dst, "agent/bin/oneagent.debug"), false)
+		assertExists(t, fs, filepath.Join(dst, "agent/conf/a.conf.sample"), false)
+		assertExists(t, fs, filepath.Join(dst, "docs"), false)
+		// the dir itself is not excluded, only its content
+		assertExists(t, fs, filepath.Join(dst, "agent/conf"), true)
+	})
+	t.Run("include -> only included files and their dirs copied", func(t *testing.T) {
+		dst := "/dst-include"
+		filter, err := NewPathFilter([]string{"agent/bin/*", "installer.version"}, nil)
+		require.NoError(t, err)
+
+		err = CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{PathFilter: filter})
+		require.NoError(t, err)
+
+		assertExists(t, fs, filepath.Join(dst, "agent/bin/oneagent"), true)
+		assertExists(t, fs, filepath.Join(dst, "agent/bin/oneagent.debug"), true)
+		assertExists(t, fs, filepath.Join(dst, "installer.version"), true)
+		assertExists(t, fs, filepath.Join(dst, "agent/conf"), false)
+		assertExists(t, fs, filepath.Join(dst, "docs"), false)
+	})
+	t.Run("include nothing -> only root created", func(t *testing.T) {
+		dst := "/dst-nothing"
+		filter, err := NewPathFilter([]string{"missing/**"}, nil)
+		require.NoError(t, err)
+
+		err = CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{PathFilter: filter})
+		require.NoError(t, err)
+
+		entries, err := afero.ReadDir(fs, dst)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func assertExists(t *testing.T, fs afero.Fs, path string, isExpected bool) {
+	t.Helper()
+
+	exists, err := afero.Exists(fs, path)
+	require.NoError(t, err)
+	assert.Equal(t, isExpected, exists, path)
+}
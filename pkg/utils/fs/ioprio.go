@@ -0,0 +1,63 @@
+package fs
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// IOPriorityIdle only gets disk time when no other process needs it.
+	IOPriorityIdle = "idle"
+	// IOPriorityBestEffort is the default class of the kernel, it can be followed by a level from 0 (highest) to 7 (lowest), for example "best-effort:4".
+	IOPriorityBestEffort = "best-effort"
+
+	ioprioClassShift      = 13
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+	ioprioWhoProcess      = 1
+
+	lowestBestEffortLevel = 7
+)
+
+var ErrIOPriorityNotSupported = errors.New("setting the I/O priority is not supported")
+
+// SetIOPriority sets the I/O priority (ioprio_set) of the whole process, so the copy doesn't slow down other workloads on the same disk.
+// An empty priority keeps the current one, "best-effort" without a level means the lowest level.
+func SetIOPriority(priority string) error {
+	if priority == "" {
+		return nil
+	}
+
+	ioprio, err := parseIOPriority(priority)
+	if err != nil {
+		return err
+	}
+
+	return setIOPriority(ioprio)
+}
+
+func parseIOPriority(priority string) (int, error) {
+	class, level, hasLevel := strings.Cut(priority, ":")
+
+	switch {
+	case class == IOPriorityIdle && !hasLevel:
+		return ioprioClassIdle << ioprioClassShift, nil
+	case class == IOPriorityBestEffort:
+		parsedLevel := lowestBestEffortLevel
+
+		if hasLevel {
+			var err error
+
+			parsedLevel, err = strconv.Atoi(level)
+			if err != nil || parsedLevel < 0 || parsedLevel > lowestBestEffortLevel {
+				return 0, errors.Errorf("invalid best-effort I/O priority level %q, must be between 0 and %d", level, lowestBestEffortLevel)
+			}
+		}
+
+		return ioprioClassBestEffort<<ioprioClassShift | parsedLevel, nil
+	default:
+		return 0, errors.Errorf("unknown I/O priority %q, must be one of: %s, %s[:<0-%d>]", priority, IOPriorityIdle, IOPriorityBestEffort, lowestBestEffortLevel)
+	}
+}
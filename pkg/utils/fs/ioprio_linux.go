@@ -0,0 +1,41 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// setIOPriority sets the priority of every thread of the process, as the kernel keeps it per thread.
+// Threads that are created afterwards inherit it from the thread that creates them.
+func setIOPriority(ioprio int) error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio))
+
+		switch errno {
+		case 0, unix.ESRCH:
+			// ESRCH means the thread exited in the meantime
+			continue
+		case unix.ENOSYS:
+			return errors.Wrap(ErrIOPriorityNotSupported, errno.Error())
+		default:
+			return errors.WithStack(errno)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package fs
+
+import (
+	"github.com/pkg/errors"
+)
+
+func setIOPriority(_ int) error {
+	return errors.WithStack(ErrIOPriorityNotSupported)
+}
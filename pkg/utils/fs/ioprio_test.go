@@ -0,0 +1,38 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIOPriority(t *testing.T) {
+	t.Run("idle -> idle class", func(t *testing.T) {
+		ioprio, err := parseIOPriority(IOPriorityIdle)
+		require.NoError(t, err)
+
+		assert.Equal(t, ioprioClassIdle<<ioprioClassShift, ioprio)
+	})
+	t.Run("best-effort -> lowest level", func(t *testing.T) {
+		ioprio, err := parseIOPriority(IOPriorityBestEffort)
+		require.NoError(t, err)
+
+		assert.Equal(t, ioprioClassBestEffort<<ioprioClassShift|7, ioprio)
+	})
+	t.Run("best-effort with level -> level", func(t *testing.T) {
+		ioprio, err := parseIOPriority("best-effort:2")
+		require.NoError(t, err)
+
+		assert.Equal(t, ioprioClassBestEffort<<ioprioClassShift|2, ioprio)
+	})
+	t.Run("invalid -> error", func(t *testing.T) {
+		for _, priority := range []string{"realtime", "idle:1", "best-effort:8", "best-effort:x"} {
+			_, err := parseIOPriority(priority)
+			require.Error(t, err, priority)
+		}
+	})
+	t.Run("empty -> unchanged", func(t *testing.T) {
+		require.NoError(t, SetIOPriority(""))
+	})
+}
@@ -0,0 +1,255 @@
+package fs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// JournalFileName is the name of the journal, it is put into the root folder of the copy.
+const JournalFileName = ".bootstrapper-journal"
+
+// JournalEntry is a file that was completely copied, the Size and ModTime are the ones of the source.
+type JournalEntry struct {
+	Path    string `json:"path"`
+	MD5     string `json:"md5,omitempty"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+}
+
+// Journal keeps track of the files that were completely copied into a root folder, so an interrupted copy (for example the process was killed) can be resumed.
+// A journaled file is only skipped in case its source did not change and the copied file still has the journaled size and checksum.
+// The methods can be called on a nil Journal, which means nothing is journaled.
+type Journal struct {
+	fs      afero.Fs
+	file    afero.File
+	log     logr.Logger
+	entries map[string]JournalEntry
+	// touched are the files (relative to the root) that were written or verified by the current copy, everything else is removed by Finish.
+	touched map[string]bool
+	root    string
+	mutex   sync.Mutex
+}
+
+// HasJournal checks if the root folder contains a journal of a previous copy.
+func HasJournal(fs afero.Fs, root string) (bool, error) {
+	exists, err := afero.Exists(fs, filepath.Join(root, JournalFileName))
+
+	return exists, errors.WithStack(err)
+}
+
+// OpenJournal loads the entries of the journal in the root folder (if present) and opens it to append the next entries.
+// Entries that can't be parsed (for example the last line was only partially written) are ignored, the file is copied again in that case.
+func OpenJournal(log logr.Logger, fs afero.Fs, root string) (*Journal, error) {
+	err := fs.MkdirAll(root, os.ModePerm)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	journal := &Journal{
+		fs:      fs,
+		log:     log,
+		root:    root,
+		entries: map[string]JournalEntry{},
+		touched: map[string]bool{},
+	}
+
+	journal.file, err = fs.OpenFile(journal.path(), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = journal.load()
+	if err != nil {
+		_ = journal.file.Close()
+
+		return nil, err
+	}
+
+	if len(journal.entries) > 0 {
+		log.Info("resuming copy from journal", "root", root, "journaled files", len(journal.entries))
+	}
+
+	return journal, nil
+}
+
+// IsDone checks if the destination file was already copied by a previous run, from a source with the same size and modification time.
+// The copied file is verified against the journaled size and checksum, so a file that was not completely written to disk is copied again.
+func (j *Journal) IsDone(destinationPath string, size int64, modTime time.Time) bool {
+	if j == nil {
+		return false
+	}
+
+	relativePath, ok := j.relative(destinationPath)
+	if !ok {
+		return false
+	}
+
+	j.mutex.Lock()
+	entry, isJournaled := j.entries[relativePath]
+	j.mutex.Unlock()
+
+	if !isJournaled || entry.Size != size || entry.ModTime != modTime.UnixNano() {
+		return false
+	}
+
+	info, err := j.fs.Stat(destinationPath)
+	if err != nil || info.Size() != size {
+		return false
+	}
+
+	if entry.MD5 != "" && VerifyMD5(j.fs, destinationPath, entry.MD5) != nil {
+		j.log.Info("journaled file is corrupted, copying it again", "path", destinationPath)
+
+		return false
+	}
+
+	j.Touch(destinationPath)
+
+	return true
+}
+
+// Done journals the completely copied destination file, the size and modification time are the ones of the source.
+func (j *Journal) Done(destinationPath, md5 string, size int64, modTime time.Time) error {
+	if j == nil {
+		return nil
+	}
+
+	relativePath, ok := j.relative(destinationPath)
+	if !ok {
+		return nil
+	}
+
+	entry := JournalEntry{Path: relativePath, MD5: md5, Size: size, ModTime: modTime.UnixNano()}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.entries[relativePath] = entry
+	j.touched[relativePath] = true
+
+	_, err = j.file.Write(append(line, '\n'))
+
+	return errors.WithStack(err)
+}
+
+// Touch marks the destination path as part of the current copy, without journaling it (for example symlinks, which are cheap to recreate).
+func (j *Journal) Touch(destinationPath string) {
+	if j == nil {
+		return
+	}
+
+	relativePath, ok := j.relative(destinationPath)
+	if !ok {
+		return
+	}
+
+	j.mutex.Lock()
+	j.touched[relativePath] = true
+	j.mutex.Unlock()
+}
+
+// Close closes the journal, but keeps it, so the next run can resume the copy.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	return errors.WithStack(j.file.Close())
+}
+
+// Discard closes and removes the journal, in case the copied files can't be trusted, so the next run copies everything again.
+func (j *Journal) Discard() error {
+	if j == nil {
+		return nil
+	}
+
+	err := j.Close()
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(j.fs.Remove(j.path()))
+}
+
+// Finish is called once the copy succeeded, it removes the files that are not part of the current copy (for example leftovers of a previous run with a different source) and the journal itself.
+func (j *Journal) Finish() error {
+	if j == nil {
+		return nil
+	}
+
+	err := j.Close()
+	if err != nil {
+		return err
+	}
+
+	err = afero.Walk(j.fs, j.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		relativePath, ok := j.relative(path)
+		if !ok || info.IsDir() || relativePath == JournalFileName || j.touched[relativePath] {
+			return nil
+		}
+
+		j.log.Info("removing leftover of a previous copy", "path", path)
+
+		return errors.WithStack(j.fs.Remove(path))
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(j.fs.Remove(j.path()))
+}
+
+// load reads the entries from the start of the journal, and then moves to its end, as not every afero.Fs appends on its own.
+func (j *Journal) load() error {
+	_, err := j.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	scanner := bufio.NewScanner(j.file)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			j.entries[entry.Path] = entry
+		}
+	}
+
+	if scanner.Err() != nil {
+		return errors.WithStack(scanner.Err())
+	}
+
+	_, err = j.file.Seek(0, io.SeekEnd)
+
+	return errors.WithStack(err)
+}
+
+func (j *Journal) path() string {
+	return filepath.Join(j.root, JournalFileName)
+}
+
+func (j *Journal) relative(path string) (string, bool) {
+	relativePath, err := filepath.Rel(j.root, path)
+	if err != nil || relativePath == "." {
+		return "", false
+	}
+
+	return relativePath, true
+}
@@ -0,0 +1,135 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	root := "/work"
+	source := "/src/file.txt"
+	destination := filepath.Join(root, "file.txt")
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// copyInterrupted copies the file with a journal, but only closes it, same as a run that was killed before it finished
+	copyInterrupted := func(t *testing.T, fs afero.Fs) {
+		t.Helper()
+
+		require.NoError(t, afero.WriteFile(fs, source, []byte("content"), 0644))
+		require.NoError(t, fs.Chtimes(source, modTime, modTime))
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+
+		err = CopyFiles(testLog, fs, []FileCopy{{From: source, To: destination}}, CopyOptions{Journal: journal})
+		require.NoError(t, err)
+		require.NoError(t, journal.Close())
+
+		exists, err := HasJournal(fs, root)
+		require.NoError(t, err)
+		require.True(t, exists)
+	}
+
+	t.Run("copied file -> done", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		copyInterrupted(t, fs)
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+
+		assert.True(t, journal.IsDone(destination, int64(len("content")), modTime))
+		assert.False(t, journal.IsDone(filepath.Join(root, "other.txt"), int64(len("content")), modTime))
+	})
+	t.Run("changed source -> not done", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		copyInterrupted(t, fs)
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+
+		assert.False(t, journal.IsDone(destination, int64(len("content")), modTime.Add(time.Second)))
+		assert.False(t, journal.IsDone(destination, int64(len("changed content")), modTime))
+	})
+	t.Run("corrupted destination -> not done", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		copyInterrupted(t, fs)
+
+		require.NoError(t, afero.WriteFile(fs, destination, []byte("CONTENT"), 0644))
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+
+		assert.False(t, journal.IsDone(destination, int64(len("content")), modTime))
+	})
+	t.Run("partially written entry -> ignored", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		copyInterrupted(t, fs)
+
+		file, err := fs.OpenFile(filepath.Join(root, JournalFileName), os.O_WRONLY|os.O_APPEND, 0600)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"path":"other.txt","md5":"`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+
+		assert.True(t, journal.IsDone(destination, int64(len("content")), modTime))
+	})
+	t.Run("finish -> leftovers and journal removed", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		copyInterrupted(t, fs)
+
+		leftover := filepath.Join(root, "dir", "leftover.txt")
+		require.NoError(t, afero.WriteFile(fs, leftover, []byte("leftover"), 0644))
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+
+		err = CopyFiles(testLog, fs, []FileCopy{{From: source, To: destination}}, CopyOptions{Journal: journal})
+		require.NoError(t, err)
+		require.NoError(t, journal.Finish())
+
+		exists, err := afero.Exists(fs, destination)
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = afero.Exists(fs, leftover)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		exists, err = HasJournal(fs, root)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+	t.Run("discard -> journal removed, copied files kept", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		copyInterrupted(t, fs)
+
+		journal, err := OpenJournal(testLog, fs, root)
+		require.NoError(t, err)
+		require.NoError(t, journal.Discard())
+
+		exists, err := HasJournal(fs, root)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		exists, err = afero.Exists(fs, destination)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+	t.Run("nil journal -> nothing journaled", func(t *testing.T) {
+		var journal *Journal
+
+		assert.False(t, journal.IsDone(destination, 0, modTime))
+		require.NoError(t, journal.Done(destination, "", 0, modTime))
+		require.NoError(t, journal.Finish())
+		require.NoError(t, journal.Discard())
+	})
+}
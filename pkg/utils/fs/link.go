@@ -0,0 +1,129 @@
+package fs
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const (
+	// CopyModeCopy copies the content of the files byte-for-byte.
+	CopyModeCopy = "copy"
+	// CopyModeHardlink creates hardlinks instead of copying, only works if the source and target are on the same filesystem.
+	CopyModeHardlink = "hardlink"
+	// CopyModeReflink creates copy-on-write clones (FICLONE) instead of copying, only works on filesystems that support it.
+	CopyModeReflink = "reflink"
+	// CopyModeAuto tries reflink, then hardlink, then falls back to copying, for each file.
+	CopyModeAuto = "auto"
+)
+
+var ErrLinkNotSupported = errors.New("linking is not supported")
+
+// FileCopyFunc copies a single file from the sourcePath to the destinationPath, keeping its mode.
+type FileCopyFunc func(fs afero.Fs, sourcePath, destinationPath string) error
+
+var (
+	_ FileCopyFunc = CopyFile
+	_ FileCopyFunc = HardlinkFile
+	_ FileCopyFunc = ReflinkFile
+	_ FileCopyFunc = AutoCopyFile
+)
+
+// GetFileCopyFunc returns the FileCopyFunc for the given copy mode, an empty mode means CopyModeCopy.
+func GetFileCopyFunc(mode string) (FileCopyFunc, error) {
+	switch mode {
+	case "", CopyModeCopy:
+		return CopyFile, nil
+	case CopyModeHardlink:
+		return HardlinkFile, nil
+	case CopyModeReflink:
+		return ReflinkFile, nil
+	case CopyModeAuto:
+		return AutoCopyFile, nil
+	default:
+		return nil, errors.Errorf("unknown copy mode %q, must be one of: %s, %s, %s, %s", mode, CopyModeCopy, CopyModeHardlink, CopyModeReflink, CopyModeAuto)
+	}
+}
+
+// HardlinkFile creates a hardlink at the destinationPath that points to the same inode as the sourcePath.
+// An already existing file at the destinationPath is replaced.
+func HardlinkFile(fs afero.Fs, sourcePath, destinationPath string) error {
+	if !isOsFs(fs) {
+		return errors.WithStack(ErrLinkNotSupported)
+	}
+
+	err := removeExisting(destinationPath)
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(os.Link(sourcePath, destinationPath))
+}
+
+// ReflinkFile creates a copy-on-write clone of the sourcePath at the destinationPath.
+// An already existing file at the destinationPath is replaced.
+func ReflinkFile(fs afero.Fs, sourcePath, destinationPath string) error {
+	if !isOsFs(fs) {
+		return errors.WithStack(ErrLinkNotSupported)
+	}
+
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = sourceFile.Close() }()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	destinationFile, err := os.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, sourceInfo.Mode())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = destinationFile.Close() }()
+
+	err = cloneFile(destinationFile, sourceFile)
+	if err != nil {
+		_ = os.Remove(destinationPath)
+
+		return err
+	}
+
+	return nil
+}
+
+// AutoCopyFile tries to reflink the file first, then to hardlink it and if neither works, copies it.
+func AutoCopyFile(fs afero.Fs, sourcePath, destinationPath string) error {
+	err := ReflinkFile(fs, sourcePath, destinationPath)
+	if err == nil {
+		return nil
+	}
+
+	err = HardlinkFile(fs, sourcePath, destinationPath)
+	if err == nil {
+		return nil
+	}
+
+	return CopyFile(fs, sourcePath, destinationPath)
+}
+
+// isOsFs checks if the afero.Fs is backed by the real filesystem, as only then can the files be linked.
+func isOsFs(fs afero.Fs) bool {
+	_, ok := unwrapFs(fs).(*afero.OsFs)
+
+	return ok
+}
+
+func removeExisting(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
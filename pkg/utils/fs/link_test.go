@@ -0,0 +1,143 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFileCopyFunc(t *testing.T) {
+	for _, mode := range []string{"", CopyModeCopy, CopyModeHardlink, CopyModeReflink, CopyModeAuto} {
+		copyFileFunc, err := GetFileCopyFunc(mode)
+		require.NoError(t, err, mode)
+		assert.NotNil(t, copyFileFunc, mode)
+	}
+
+	_, err := GetFileCopyFunc("symlink")
+	require.Error(t, err)
+}
+
+func TestHardlinkFile(t *testing.T) {
+	t.Run("real fs -> same file", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		source, target := setupOsFiles(t)
+
+		err := HardlinkFile(fs, source, target)
+		require.NoError(t, err)
+
+		assertSameFile(t, source, target)
+	})
+	t.Run("real fs, target exists -> replaced", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		source, target := setupOsFiles(t)
+
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0600))
+
+		err := HardlinkFile(fs, source, target)
+		require.NoError(t, err)
+
+		assertSameFile(t, source, target)
+	})
+	t.Run("memory fs -> not supported", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := HardlinkFile(fs, "/source", "/target")
+		require.ErrorIs(t, err, ErrLinkNotSupported)
+	})
+}
+
+func TestReflinkFile(t *testing.T) {
+	t.Run("memory fs -> not supported", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := ReflinkFile(fs, "/source", "/target")
+		require.ErrorIs(t, err, ErrLinkNotSupported)
+	})
+}
+
+func TestAutoCopyFile(t *testing.T) {
+	t.Run("real fs -> content is the same", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		source, target := setupOsFiles(t)
+
+		err := AutoCopyFile(fs, source, target)
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "some content", string(content))
+	})
+	t.Run("memory fs -> falls back to copy", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := afero.WriteFile(fs, "/source", []byte("some content"), 0644)
+		require.NoError(t, err)
+
+		err = AutoCopyFile(fs, "/source", "/target")
+		require.NoError(t, err)
+
+		content, err := afero.ReadFile(fs, "/target")
+		require.NoError(t, err)
+		assert.Equal(t, "some content", string(content))
+	})
+}
+
+func TestCopyFilesWithMode(t *testing.T) {
+	t.Run("hardlink with matching checksum", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		source, target := setupOsFiles(t)
+
+		files := []FileCopy{{From: source, To: target, MD5: "9893532233caff98cd083a116b013c0b"}}
+
+		err := CopyFiles(testLog, fs, files, CopyOptions{Mode: CopyModeHardlink})
+		require.NoError(t, err)
+
+		assertSameFile(t, source, target)
+	})
+	t.Run("hardlink with mismatching checksum -> error, link removed", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		source, target := setupOsFiles(t)
+
+		files := []FileCopy{{From: source, To: target, MD5: "abc123"}}
+
+		err := CopyFiles(testLog, fs, files, CopyOptions{Mode: CopyModeHardlink})
+		require.Error(t, err)
+
+		_, err = os.Stat(target)
+		require.True(t, os.IsNotExist(err))
+	})
+	t.Run("unknown mode -> error", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := CopyFiles(testLog, fs, nil, CopyOptions{Mode: "unknown"})
+		require.Error(t, err)
+	})
+}
+
+func setupOsFiles(t *testing.T) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	target := filepath.Join(dir, "target.txt")
+
+	require.NoError(t, os.WriteFile(source, []byte("some content"), 0640))
+
+	return source, target
+}
+
+func assertSameFile(t *testing.T, source, target string) {
+	t.Helper()
+
+	sourceInfo, err := os.Stat(source)
+	require.NoError(t, err)
+
+	targetInfo, err := os.Stat(target)
+	require.NoError(t, err)
+
+	assert.True(t, os.SameFile(sourceInfo, targetInfo))
+}
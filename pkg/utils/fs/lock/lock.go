@@ -0,0 +1,151 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	pollInterval = 100 * time.Millisecond
+	fileSuffix   = ".lock"
+)
+
+var ErrTimeout = errors.New("timed out waiting for the lock")
+
+// Lock is an exclusive inter-process lock (flock) for a path, the lock file is put next to the path, so the path itself is not touched.
+type Lock struct {
+	file *os.File
+	path string
+}
+
+// Acquire locks the path, in case it is already locked by another process, it waits until the timeout is reached.
+// The returned bool reports if the lock was held by someone else, so the caller had to wait for it.
+// Only the real filesystem can be locked, for any other afero.Fs (for example MemMapFs used for testing) a no-op Lock is returned.
+func Acquire(log logr.Logger, fs afero.Fs, path string, timeout time.Duration) (*Lock, bool, error) {
+	if _, ok := fs.(*afero.OsFs); !ok {
+		log.Info("locking not possible", "path", path, "fs", fs)
+
+		return &Lock{path: path}, false, nil
+	}
+
+	lockPath := FilePath(path)
+
+	err := os.MkdirAll(filepath.Dir(lockPath), os.ModePerm)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	hasWaited := false
+
+	for {
+		file, isLocked, err := tryLock(lockPath)
+		if err != nil {
+			return nil, false, err
+		} else if isLocked {
+			log.Info("acquired lock", "path", path, "lock-file", lockPath)
+
+			return &Lock{file: file, path: path}, hasWaited, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, false, errors.Wrapf(ErrTimeout, "path: %s, timeout: %s", path, timeout)
+		}
+
+		if !hasWaited {
+			log.Info("waiting for lock held by another process", "path", path, "lock-file", lockPath, "timeout", timeout)
+		}
+
+		hasWaited = true
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// tryLock opens (or creates) the lock file and tries to flock it once, the file is only returned in case it is locked.
+// A lock file that was removed (see Remove) while waiting for it doesn't lock anything anymore, so the newly created one is locked instead.
+func tryLock(lockPath string) (*os.File, bool, error) {
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644) //nolint:gosec // the lock file has no content
+		if err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+
+		err = unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB) //nolint:gosec // file descriptors always fit into an int
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			_ = file.Close()
+
+			return nil, false, nil
+		} else if err != nil {
+			_ = file.Close()
+
+			return nil, false, errors.WithStack(err)
+		}
+
+		isSame, err := isSameFile(file, lockPath)
+		if err == nil && isSame {
+			return file, true, nil
+		}
+
+		_ = file.Close()
+
+		if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+func isSameFile(file *os.File, path string) (bool, error) {
+	openInfo, err := file.Stat()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	pathInfo, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return os.SameFile(openInfo, pathInfo), nil
+}
+
+// Release unlocks the path, the lock file is kept, as another process could already wait for it, use Remove to remove it.
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	defer func() { _ = l.file.Close() }()
+
+	return errors.WithStack(unix.Flock(int(l.file.Fd()), unix.LOCK_UN)) //nolint:gosec // file descriptors always fit into an int
+}
+
+// Remove removes the lock file while the lock is still held, for example after the path itself was removed, the lock stays held until Release.
+// A process that is waiting for the removed lock file notices it once it gets the flock, and then locks a newly created lock file instead.
+func (l *Lock) Remove() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	err := os.Remove(FilePath(l.path))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// FilePath returns the path of the lock file that is used to lock the path.
+func FilePath(path string) string {
+	path = filepath.Clean(path)
+
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+fileSuffix)
+}
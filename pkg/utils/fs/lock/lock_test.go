@@ -0,0 +1,99 @@
+package lock
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var testLog = zapr.NewLogger(zap.NewExample())
+
+func TestAcquire(t *testing.T) {
+	t.Run("free lock -> acquired without waiting", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target")
+
+		lock, hasWaited, err := Acquire(testLog, afero.NewOsFs(), path, 0)
+		require.NoError(t, err)
+		assert.False(t, hasWaited)
+		assert.FileExists(t, FilePath(path))
+		assert.NoDirExists(t, path)
+
+		require.NoError(t, lock.Release())
+	})
+	t.Run("held lock -> timeout", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target")
+
+		lock, _, err := Acquire(testLog, afero.NewOsFs(), path, 0)
+		require.NoError(t, err)
+
+		defer func() { _ = lock.Release() }()
+
+		_, _, err = Acquire(testLog, afero.NewOsFs(), path, 2*pollInterval)
+		require.ErrorIs(t, err, ErrTimeout)
+	})
+	t.Run("held lock gets released -> acquired after waiting", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target")
+
+		lock, _, err := Acquire(testLog, afero.NewOsFs(), path, 0)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(2 * pollInterval)
+
+			_ = lock.Release()
+		}()
+
+		otherLock, hasWaited, err := Acquire(testLog, afero.NewOsFs(), path, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, hasWaited)
+
+		require.NoError(t, otherLock.Release())
+	})
+	t.Run("lock file removed while waiting -> new lock file acquired", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target")
+
+		lock, _, err := Acquire(testLog, afero.NewOsFs(), path, 0)
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(2 * pollInterval)
+
+			_ = lock.Remove()
+			_ = lock.Release()
+		}()
+
+		otherLock, hasWaited, err := Acquire(testLog, afero.NewOsFs(), path, time.Minute)
+		require.NoError(t, err)
+		assert.True(t, hasWaited)
+		assert.FileExists(t, FilePath(path))
+
+		// the new lock file is actually locked
+		_, _, err = Acquire(testLog, afero.NewOsFs(), path, 0)
+		require.ErrorIs(t, err, ErrTimeout)
+
+		require.NoError(t, otherLock.Release())
+	})
+	t.Run("not the real fs -> no-op lock", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		lock, hasWaited, err := Acquire(testLog, fs, "/target", 0)
+		require.NoError(t, err)
+		assert.False(t, hasWaited)
+
+		_, _, err = Acquire(testLog, fs, "/target", 0)
+		require.NoError(t, err)
+
+		require.NoError(t, lock.Release())
+	})
+}
+
+func TestFilePath(t *testing.T) {
+	assert.Equal(t, "/example/bins/.1.2.3.lock", FilePath("/example/bins/1.2.3/"))
+	assert.Equal(t, ".target.lock", FilePath("target"))
+}
@@ -0,0 +1,113 @@
+package fs
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// Lstat returns the FileInfo of the path without following symlinks, if the afero.Fs supports it, otherwise it falls back to Stat.
+func Lstat(fs afero.Fs, path string) (os.FileInfo, error) {
+	if lstater, ok := unwrapFs(fs).(afero.Lstater); ok {
+		info, _, err := lstater.LstatIfPossible(path)
+
+		return info, errors.WithStack(err)
+	}
+
+	info, err := fs.Stat(path)
+
+	return info, errors.WithStack(err)
+}
+
+// IsSymlink checks if the path is a symlink (without following it).
+func IsSymlink(fs afero.Fs, path string) (bool, error) {
+	info, err := Lstat(fs, path)
+	if err != nil {
+		return false, err
+	}
+
+	return info.Mode()&os.ModeSymlink != 0, nil
+}
+
+// CopySymlink creates a symlink at the destinationPath that points to the same (unresolved) location as the symlink at the sourcePath.
+// An already existing file at the destinationPath is replaced.
+func CopySymlink(fs afero.Fs, sourcePath, destinationPath string) error {
+	linkReader, isLinkReader := unwrapFs(fs).(afero.LinkReader)
+	linker, isLinker := unwrapFs(fs).(afero.Linker)
+
+	if !isLinkReader || !isLinker {
+		return errors.WithStack(ErrLinkNotSupported)
+	}
+
+	linkTarget, err := linkReader.ReadlinkIfPossible(sourcePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.Remove(destinationPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	err = linker.SymlinkIfPossible(linkTarget, destinationPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if uid, gid, ok := ownerOf(fs, sourcePath); ok && isOsFs(fs) {
+		return ignorePermissionError(os.Lchown(destinationPath, uid, gid))
+	}
+
+	return nil
+}
+
+// RestoreMetadata sets the modification time and ownership of the destinationPath to the ones of the sourcePath.
+// Changing the ownership needs the right privileges, if they are missing, the ownership is silently kept as is.
+func RestoreMetadata(fs afero.Fs, sourcePath, destinationPath string) error {
+	sourceInfo, err := fs.Stat(sourcePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.Chtimes(destinationPath, sourceInfo.ModTime(), sourceInfo.ModTime())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if uid, gid, ok := ownerOf(fs, sourcePath); ok {
+		return ignorePermissionError(fs.Chown(destinationPath, uid, gid))
+	}
+
+	return nil
+}
+
+// ownerOf returns the uid and gid of the path, if the afero.Fs provides them.
+func ownerOf(fs afero.Fs, path string) (int, int, bool) {
+	info, err := Lstat(fs, path)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return ownerFromInfo(info)
+}
+
+func ignorePermissionError(err error) error {
+	if err == nil || errors.Is(err, os.ErrPermission) {
+		return nil
+	}
+
+	return errors.WithStack(err)
+}
+
+// unwrapFs returns the afero.Fs that is inside an afero.Afero, so its optional interfaces (afero.Linker, afero.Lstater, ...) can be checked.
+func unwrapFs(fs afero.Fs) afero.Fs {
+	switch typedFs := fs.(type) {
+	case afero.Afero:
+		return unwrapFs(typedFs.Fs)
+	case *afero.Afero:
+		return unwrapFs(typedFs.Fs)
+	default:
+		return fs
+	}
+}
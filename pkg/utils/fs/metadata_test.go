@@ -0,0 +1,86 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFolderPreserveMetadata(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("real fs -> symlinks and modification times are kept", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		base := t.TempDir()
+		src := filepath.Join(base, "src")
+		dst := filepath.Join(base, "dst")
+
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "bin", "1.2.3"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, "bin", "1.2.3", "agent.so"), []byte("agent"), 0644))
+		require.NoError(t, os.Symlink("1.2.3", filepath.Join(src, "bin", "current")))
+		require.NoError(t, os.Symlink("1.2.3/agent.so", filepath.Join(src, "bin", "agent.so")))
+		require.NoError(t, os.Chtimes(filepath.Join(src, "bin", "1.2.3", "agent.so"), modTime, modTime))
+		require.NoError(t, os.Chtimes(filepath.Join(src, "bin", "1.2.3"), modTime, modTime))
+
+		err := CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{PreserveMetadata: true})
+		require.NoError(t, err)
+
+		for _, link := range []string{"current", "agent.so"} {
+			linkTarget, err := os.Readlink(filepath.Join(dst, "bin", link))
+			require.NoError(t, err)
+
+			expectedTarget, err := os.Readlink(filepath.Join(src, "bin", link))
+			require.NoError(t, err)
+			assert.Equal(t, expectedTarget, linkTarget)
+		}
+
+		fileInfo, err := os.Stat(filepath.Join(dst, "bin", "1.2.3", "agent.so"))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(fileInfo.ModTime()))
+
+		dirInfo, err := os.Stat(filepath.Join(dst, "bin", "1.2.3"))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(dirInfo.ModTime()))
+	})
+	t.Run("memory fs -> modification times are kept", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		require.NoError(t, afero.WriteFile(fs, "/src/file.txt", []byte("content"), 0644))
+		require.NoError(t, fs.Chtimes("/src/file.txt", modTime, modTime))
+
+		err := CopyFolderWithOptions(testLog, fs, "/src", "/dst", CopyOptions{PreserveMetadata: true})
+		require.NoError(t, err)
+
+		fileInfo, err := fs.Stat("/dst/file.txt")
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(fileInfo.ModTime()))
+	})
+}
+
+func TestCopySymlink(t *testing.T) {
+	t.Run("existing target -> replaced", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		base := t.TempDir()
+
+		require.NoError(t, os.Symlink("somewhere", filepath.Join(base, "link")))
+		require.NoError(t, os.WriteFile(filepath.Join(base, "copy"), []byte("old"), 0644))
+
+		err := CopySymlink(fs, filepath.Join(base, "link"), filepath.Join(base, "copy"))
+		require.NoError(t, err)
+
+		linkTarget, err := os.Readlink(filepath.Join(base, "copy"))
+		require.NoError(t, err)
+		assert.Equal(t, "somewhere", linkTarget)
+	})
+	t.Run("memory fs -> not supported", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		err := CopySymlink(fs, "/link", "/copy")
+		require.ErrorIs(t, err, ErrLinkNotSupported)
+	})
+}
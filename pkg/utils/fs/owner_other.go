@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fs
+
+import (
+	"os"
+)
+
+func ownerFromInfo(_ os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,284 @@
+package fs
+
+import (
+	"os"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// CopyOptions configures how the files are copied by CopyFolderWithOptions and CopyFiles.
+type CopyOptions struct {
+	// Mode defines how a single file is copied, see the CopyMode constants, empty means CopyModeCopy.
+	Mode string
+	// Concurrency is the maximum number of files copied in parallel, anything below 1 means the files are copied one by one.
+	Concurrency int
+	// Incremental skips the files that are already present in the target with the same size, mode and modification time.
+	// The modification time of the copied files is set to the one of the source, so the next incremental copy can detect them.
+	// The callers that copy a whole folder (CopyFolderWithOptions) remove the files that are no longer part of the source afterwards, see RemoveStale.
+	Incremental bool
+	// IncrementalChecksum additionally verifies the md5 checksum of the already present files, if the FileCopy has one.
+	IncrementalChecksum bool
+	// PreserveMetadata recreates symlinks as symlinks (instead of copying what they point to) and keeps the modification time and ownership of the files and dirs.
+	PreserveMetadata bool
+	// Store is the folder of a content-addressable store, in case it is set, the files are put into it and hardlinked from there (see StoreFile), instead of according to the Mode.
+	// The hardlinks share the mode and modification time of the stored content, so it can't be combined with Incremental or PreserveMetadata.
+	Store string
+	// PathFilter selects the files of a folder that are copied (see CopyFolderWithOptions), nil means every file.
+	PathFilter *PathFilter
+	// BytesPerSecond limits the combined throughput of the copied files, anything below 1 means unlimited.
+	BytesPerSecond int64
+	// Throttle counts (and limits, according to BytesPerSecond) the bytes of the copied files, in case it is nil, CopyFiles creates one.
+	Throttle *Throttle
+	// Resumable journals the copied files, so an interrupted copy can be resumed by the next run, see Journal.
+	// It is only considered by the callers that copy into a work folder, which then set the Journal.
+	Resumable bool
+	// Journal keeps track of the copied files, nil means nothing is journaled.
+	Journal *Journal
+}
+
+// FileCopy describes a single file that needs to be copied.
+type FileCopy struct {
+	From string
+	To   string
+	// MD5 is the expected checksum of the file, it is only verified if set.
+	MD5 string
+}
+
+// CopyFiles copies the provided files using a bounded pool of workers, the parent dirs of the targets have to exist already.
+// In case of multiple failures, the error of the first failing file (according to the order of the list) is returned, same as it would be when copying one by one.
+func CopyFiles(log logr.Logger, fs afero.Fs, files []FileCopy, opts CopyOptions) error {
+	copyFileFunc, err := GetFileCopyFunc(opts.Mode)
+	if err != nil {
+		return err
+	}
+
+	isStreamed := opts.Mode == "" || opts.Mode == CopyModeCopy
+
+	if opts.Throttle == nil && opts.BytesPerSecond > 0 {
+		opts.Throttle = NewThrottle(opts.BytesPerSecond)
+	}
+
+	if opts.Store != "" {
+		copyFileFunc = func(fs afero.Fs, sourcePath, destinationPath string) error {
+			return storeFile(fs, opts.Store, sourcePath, destinationPath, opts.Throttle)
+		}
+		isStreamed = false
+	}
+
+	return forEachConcurrently(opts.Concurrency, len(files), func(i int) error {
+		file := files[i]
+
+		if opts.PreserveMetadata {
+			isSymlink, err := IsSymlink(fs, file.From)
+			if err != nil {
+				return err
+			}
+
+			if isSymlink {
+				log.V(1).Info("copying symlink", "from", file.From, "to", file.To)
+				opts.Journal.Touch(file.To)
+
+				return CopySymlink(fs, file.From, file.To)
+			}
+		}
+
+		if opts.Incremental && isUnchanged(fs, file, opts.IncrementalChecksum) {
+			log.V(1).Info("skipping unchanged file", "from", file.From, "to", file.To)
+			opts.Journal.Touch(file.To)
+
+			return nil
+		}
+
+		var sourceInfo os.FileInfo
+
+		if opts.Journal != nil {
+			var err error
+
+			sourceInfo, err = fs.Stat(file.From)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if opts.Journal.IsDone(file.To, sourceInfo.Size(), sourceInfo.ModTime()) {
+				log.V(1).Info("skipping already copied file", "from", file.From, "to", file.To)
+
+				return nil
+			}
+		}
+
+		log.V(1).Info("copying file", "from", file.From, "to", file.To, "mode", opts.Mode)
+
+		checksum, err := copySingleFile(fs, file, copyFileFunc, isStreamed, opts.Journal != nil, opts.Throttle)
+		if err != nil {
+			return err
+		}
+
+		if opts.Incremental || opts.PreserveMetadata {
+			err = keepFileInfo(fs, file)
+			if err != nil {
+				return err
+			}
+		}
+
+		if opts.PreserveMetadata {
+			err = RestoreMetadata(fs, file.From, file.To)
+			if err != nil {
+				return err
+			}
+		}
+
+		if opts.Journal != nil {
+			return opts.Journal.Done(file.To, checksum, sourceInfo.Size(), sourceInfo.ModTime())
+		}
+
+		return nil
+	})
+}
+
+// RestoreDirMetadata calls RestoreMetadata for the dirs in reverse order, so the children are handled before their parents.
+// Has to be called after all the files were copied, as creating a file in a dir changes the modification time of the dir.
+func RestoreDirMetadata(fs afero.Fs, dirs []FileCopy) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := RestoreMetadata(fs, dirs[i].From, dirs[i].To)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copySingleFile copies the file and verifies its MD5 (if set), streamed copies and the verification of linked files go through the throttle.
+// In case isHashed is set, the md5 checksum of the streamed content is returned, links return the MD5 of the FileCopy (if any), as their content is not read.
+func copySingleFile(fs afero.Fs, file FileCopy, copyFileFunc FileCopyFunc, isStreamed, isHashed bool, throttle *Throttle) (string, error) {
+	if isStreamed && (isHashed || file.MD5 != "") {
+		return copyFileWithChecksum(fs, file.From, file.To, file.MD5, throttle)
+	} else if isStreamed {
+		return "", copyFile(fs, file.From, file.To, nil, throttle)
+	}
+
+	if file.MD5 == "" {
+		return "", copyFileFunc(fs, file.From, file.To)
+	}
+
+	// links don't go through a stream, so the content has to be read separately
+	err := copyFileFunc(fs, file.From, file.To)
+	if err != nil {
+		return "", err
+	}
+
+	err = verifyMD5(fs, file.To, file.MD5, throttle)
+	if err != nil {
+		_ = fs.Remove(file.To)
+
+		return "", err
+	}
+
+	return file.MD5, nil
+}
+
+// isUnchanged checks if the target of the FileCopy already has the same size, mode and modification time as the source.
+// In case verifyChecksum is set and the FileCopy has an MD5, the content of the target is verified as well.
+func isUnchanged(fs afero.Fs, file FileCopy, verifyChecksum bool) bool {
+	sourceInfo, err := fs.Stat(file.From)
+	if err != nil {
+		return false
+	}
+
+	targetInfo, err := fs.Stat(file.To)
+	if err != nil {
+		return false
+	}
+
+	if sourceInfo.Size() != targetInfo.Size() ||
+		sourceInfo.Mode() != targetInfo.Mode() ||
+		!sourceInfo.ModTime().Equal(targetInfo.ModTime()) {
+		return false
+	}
+
+	if verifyChecksum && file.MD5 != "" {
+		return VerifyMD5(fs, file.To, file.MD5) == nil
+	}
+
+	return true
+}
+
+// keepFileInfo sets the mode and modification time of the target to the ones of the source.
+// The mode is only set on creation during the copy, so an already existing target could have kept its old mode.
+func keepFileInfo(fs afero.Fs, file FileCopy) error {
+	sourceInfo, err := fs.Stat(file.From)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.Chmod(file.To, sourceInfo.Mode())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(fs.Chtimes(file.To, sourceInfo.ModTime(), sourceInfo.ModTime()))
+}
+
+// forEachConcurrently calls `do` for every index in [0, count) with at most `concurrency` goroutines.
+// The indexes are handed out in order and once an index failed, no higher index is started anymore,
+// so the returned error is always the one of the lowest failing index, independent of the scheduling.
+func forEachConcurrently(concurrency, count int, do func(i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	concurrency = min(concurrency, count)
+
+	var (
+		mutex         sync.Mutex
+		waitGroup     sync.WaitGroup
+		firstErr      error
+		firstErrIndex = count
+	)
+
+	indexes := make(chan int)
+
+	for range concurrency {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for i := range indexes {
+				mutex.Lock()
+				isAfterFailure := i > firstErrIndex
+				mutex.Unlock()
+
+				if isAfterFailure {
+					continue
+				}
+
+				err := do(i)
+				if err == nil {
+					continue
+				}
+
+				mutex.Lock()
+
+				if i < firstErrIndex {
+					firstErr = err
+					firstErrIndex = i
+				}
+
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for i := range count {
+		indexes <- i
+	}
+
+	close(indexes)
+	waitGroup.Wait()
+
+	return firstErr
+}
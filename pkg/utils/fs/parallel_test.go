@@ -0,0 +1,186 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFolderWithOptions(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	src := "/src"
+
+	for i := range 10 {
+		dir := filepath.Join(src, fmt.Sprintf("dir%d", i))
+		err := fs.MkdirAll(dir, 0750)
+		require.NoError(t, err)
+
+		for j := range 5 {
+			err = afero.WriteFile(fs, filepath.Join(dir, fmt.Sprintf("file%d.txt", j)), []byte(fmt.Sprintf("%d-%d", i, j)), 0640)
+			require.NoError(t, err)
+		}
+	}
+
+	dst := "/dst"
+
+	err := CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{Concurrency: 4})
+	require.NoError(t, err)
+
+	checkFolder(t, fs, src, dst)
+}
+
+func TestCopyFiles(t *testing.T) {
+	t.Run("missing source -> error of the first failing file", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+
+		var files []FileCopy
+
+		for i := range 20 {
+			source := fmt.Sprintf("/src/file%d.txt", i)
+			if i != 7 && i != 13 {
+				err := afero.WriteFile(fs, source, []byte("content"), 0644)
+				require.NoError(t, err)
+			}
+
+			files = append(files, FileCopy{From: source, To: fmt.Sprintf("/src/copy%d.txt", i)})
+		}
+
+		err := CopyFiles(testLog, fs, files, CopyOptions{Concurrency: 5})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "file7.txt")
+	})
+}
+
+func TestForEachConcurrently(t *testing.T) {
+	t.Run("calls every index", func(t *testing.T) {
+		var calls atomic.Int32
+
+		err := forEachConcurrently(3, 100, func(_ int) error {
+			calls.Add(1)
+
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int32(100), calls.Load())
+	})
+	t.Run("lowest failing index wins", func(t *testing.T) {
+		for range 10 {
+			err := forEachConcurrently(8, 50, func(i int) error {
+				if i%10 == 9 {
+					return errors.Errorf("failed %d", i)
+				}
+
+				return nil
+			})
+			require.Error(t, err)
+			assert.Equal(t, "failed 9", err.Error())
+		}
+	})
+	t.Run("no concurrency set -> sequential", func(t *testing.T) {
+		var order []int
+
+		err := forEachConcurrently(0, 5, func(i int) error {
+			order = append(order, i)
+
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+	})
+	t.Run("nothing to do", func(t *testing.T) {
+		err := forEachConcurrently(4, 0, func(_ int) error {
+			return errors.New("should not be called")
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestCopyFilesIncremental(t *testing.T) {
+	source := "/src/file.txt"
+	target := "/dst/file.txt"
+	contentMD5 := "9893532233caff98cd083a116b013c0b" // md5 of "some content"
+
+	setupFs := func(t *testing.T) afero.Fs {
+		t.Helper()
+
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, source, []byte("some content"), 0644))
+		require.NoError(t, fs.MkdirAll(filepath.Dir(target), 0755))
+
+		err := CopyFiles(testLog, fs, []FileCopy{{From: source, To: target}}, CopyOptions{Incremental: true})
+		require.NoError(t, err)
+
+		sourceInfo, err := fs.Stat(source)
+		require.NoError(t, err)
+
+		targetInfo, err := fs.Stat(target)
+		require.NoError(t, err)
+		require.True(t, sourceInfo.ModTime().Equal(targetInfo.ModTime()))
+
+		return fs
+	}
+
+	// overwriteTarget changes the content of the target, while keeping the size and modification time
+	overwriteTarget := func(t *testing.T, fs afero.Fs) {
+		t.Helper()
+
+		targetInfo, err := fs.Stat(target)
+		require.NoError(t, err)
+
+		modTime := targetInfo.ModTime()
+		require.NoError(t, afero.WriteFile(fs, target, []byte("other conten"), 0644))
+		require.NoError(t, fs.Chtimes(target, modTime, modTime))
+	}
+
+	t.Run("unchanged -> skipped", func(t *testing.T) {
+		fs := setupFs(t)
+		overwriteTarget(t, fs)
+
+		err := CopyFiles(testLog, fs, []FileCopy{{From: source, To: target, MD5: contentMD5}}, CopyOptions{Incremental: true})
+		require.NoError(t, err)
+
+		content, err := afero.ReadFile(fs, target)
+		require.NoError(t, err)
+		assert.Equal(t, "other conten", string(content))
+	})
+	t.Run("unchanged, but checksum differs -> copied", func(t *testing.T) {
+		fs := setupFs(t)
+		overwriteTarget(t, fs)
+
+		err := CopyFiles(testLog, fs, []FileCopy{{From: source, To: target, MD5: contentMD5}}, CopyOptions{Incremental: true, IncrementalChecksum: true})
+		require.NoError(t, err)
+
+		content, err := afero.ReadFile(fs, target)
+		require.NoError(t, err)
+		assert.Equal(t, "some content", string(content))
+	})
+	t.Run("changed -> copied", func(t *testing.T) {
+		fs := setupFs(t)
+		require.NoError(t, afero.WriteFile(fs, target, []byte("old"), 0644))
+
+		err := CopyFiles(testLog, fs, []FileCopy{{From: source, To: target}}, CopyOptions{Incremental: true})
+		require.NoError(t, err)
+
+		content, err := afero.ReadFile(fs, target)
+		require.NoError(t, err)
+		assert.Equal(t, "some content", string(content))
+	})
+	t.Run("changed mode -> copied, mode updated", func(t *testing.T) {
+		fs := setupFs(t)
+		require.NoError(t, fs.Chmod(source, 0600))
+
+		err := CopyFiles(testLog, fs, []FileCopy{{From: source, To: target}}, CopyOptions{Incremental: true})
+		require.NoError(t, err)
+
+		targetInfo, err := fs.Stat(target)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), targetInfo.Mode().Perm())
+	})
+}
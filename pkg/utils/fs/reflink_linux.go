@@ -0,0 +1,14 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func cloneFile(destination, source *os.File) error {
+	return errors.WithStack(unix.IoctlFileClone(int(destination.Fd()), int(source.Fd()))) //nolint:gosec // file descriptors always fit into an int
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fs
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+func cloneFile(_, _ *os.File) error {
+	return errors.WithStack(ErrLinkNotSupported)
+}
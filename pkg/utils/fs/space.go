@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+var errFreeSpaceNotSupported = errors.New("determining the free space is not supported on this platform")
+
+// FreeSpace returns the number of bytes available (for unprivileged users) on the filesystem of the path, or of its closest existing parent.
+// The returned bool is false in case the afero.Fs is not backed by the real filesystem (or the platform is not supported), as then the free space can't be determined.
+func FreeSpace(fs afero.Fs, path string) (uint64, bool, error) {
+	if !isOsFs(fs) {
+		return 0, false, nil
+	}
+
+	existingPath, err := closestExistingPath(path)
+	if err != nil {
+		return 0, false, err
+	}
+
+	available, err := availableBytes(existingPath)
+	if errors.Is(err, errFreeSpaceNotSupported) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+
+	return available, true, nil
+}
+
+// DeviceID returns the ID of the filesystem (device) of the path, or of its closest existing parent, so paths on the same filesystem can be grouped.
+// The returned bool is false in case the afero.Fs is not backed by the real filesystem (or the platform is not supported).
+func DeviceID(fs afero.Fs, path string) (uint64, bool, error) {
+	if !isOsFs(fs) {
+		return 0, false, nil
+	}
+
+	existingPath, err := closestExistingPath(path)
+	if err != nil {
+		return 0, false, err
+	}
+
+	id, err := deviceID(existingPath)
+	if errors.Is(err, errFreeSpaceNotSupported) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+
+	return id, true, nil
+}
+
+func closestExistingPath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	for {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", errors.WithStack(err)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", errors.WithStack(err)
+		}
+
+		path = parent
+	}
+}
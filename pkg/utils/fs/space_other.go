@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fs
+
+func availableBytes(_ string) (uint64, error) {
+	return 0, errFreeSpaceNotSupported
+}
+
+func deviceID(_ string) (uint64, error) {
+	return 0, errFreeSpaceNotSupported
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package fs
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+func availableBytes(path string) (uint64, error) {
+	var stat unix.Statfs_t
+
+	err := unix.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil //nolint:gosec,unconvert // the types differ between platforms, the block size is never negative
+}
+
+func deviceID(path string) (uint64, error) {
+	var stat unix.Stat_t
+
+	err := unix.Stat(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Dev), nil //nolint:unconvert // the type differs between platforms
+}
@@ -0,0 +1,71 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+// RemoveStale removes the files of the `root` that are not the target of one of the copied files, for example the ones that were removed from the source since the last incremental copy.
+// Afterwards the dirs that became empty are removed as well, unless they are the target of one of the copied dirs.
+// Symlinks are kept, as the bootstrapper creates its own ones in the target (for example agent/bin/current), the ones of the source are recreated by every copy anyway.
+func RemoveStale(log logr.Logger, fs afero.Fs, root string, files, dirs []FileCopy) error {
+	copied := make(map[string]bool, len(files)+len(dirs))
+	for _, file := range files {
+		copied[filepath.Clean(file.To)] = true
+	}
+
+	for _, dir := range dirs {
+		copied[filepath.Clean(dir.To)] = true
+	}
+
+	root = filepath.Clean(root)
+
+	var staleDirs []string
+
+	err := afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch {
+		case path == root || copied[path] || info.Mode()&os.ModeSymlink != 0:
+			return nil
+		case info.IsDir():
+			staleDirs = append(staleDirs, path)
+
+			return nil
+		}
+
+		log.Info("removing file that is no longer part of the source", "path", path)
+
+		return errors.WithStack(fs.Remove(path))
+	})
+	if err != nil {
+		return err
+	}
+
+	// the walk visits the parents first, so the children are removed before their parents
+	for i := len(staleDirs) - 1; i >= 0; i-- {
+		entries, err := afero.ReadDir(fs, staleDirs[i])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if len(entries) > 0 {
+			continue
+		}
+
+		log.Info("removing dir that is no longer part of the source", "path", staleDirs[i])
+
+		err = fs.Remove(staleDirs[i])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
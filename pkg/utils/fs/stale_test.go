@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFolderIncrementalRemovesStale(t *testing.T) {
+	src := "/src"
+	dst := "/dst"
+
+	setupFs := func(t *testing.T) afero.Fs {
+		t.Helper()
+
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, filepath.Join(src, "kept.txt"), []byte("kept"), 0644))
+		require.NoError(t, afero.WriteFile(fs, filepath.Join(src, "removed.txt"), []byte("removed"), 0644))
+		require.NoError(t, afero.WriteFile(fs, filepath.Join(src, "old", "removed.txt"), []byte("removed"), 0644))
+		require.NoError(t, fs.MkdirAll(filepath.Join(src, "empty"), 0755))
+
+		require.NoError(t, CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{Incremental: true}))
+
+		return fs
+	}
+
+	t.Run("file removed from source -> removed from target", func(t *testing.T) {
+		fs := setupFs(t)
+		require.NoError(t, fs.Remove(filepath.Join(src, "removed.txt")))
+		require.NoError(t, fs.RemoveAll(filepath.Join(src, "old")))
+
+		err := CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{Incremental: true})
+		require.NoError(t, err)
+
+		assertExists(t, fs, filepath.Join(dst, "kept.txt"), true)
+		assertExists(t, fs, filepath.Join(dst, "empty"), true)
+		assertExists(t, fs, filepath.Join(dst, "removed.txt"), false)
+		assertExists(t, fs, filepath.Join(dst, "old"), false)
+	})
+	t.Run("file no longer selected -> removed from target", func(t *testing.T) {
+		fs := setupFs(t)
+
+		paths, err := NewPathFilter(nil, []string{"old"})
+		require.NoError(t, err)
+
+		err = CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{Incremental: true, PathFilter: paths})
+		require.NoError(t, err)
+
+		assertExists(t, fs, filepath.Join(dst, "removed.txt"), true)
+		assertExists(t, fs, filepath.Join(dst, "old"), false)
+	})
+	t.Run("not incremental -> nothing removed", func(t *testing.T) {
+		fs := setupFs(t)
+		require.NoError(t, fs.Remove(filepath.Join(src, "removed.txt")))
+
+		err := CopyFolderWithOptions(testLog, fs, src, dst, CopyOptions{})
+		require.NoError(t, err)
+
+		assertExists(t, fs, filepath.Join(dst, "removed.txt"), true)
+	})
+	t.Run("symlink in target -> kept", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		root := t.TempDir()
+		osSrc, osDst := filepath.Join(root, "src"), filepath.Join(root, "dst")
+
+		require.NoError(t, fs.MkdirAll(filepath.Join(osSrc, "bin", "1.2.3"), 0755))
+		require.NoError(t, afero.WriteFile(fs, filepath.Join(osSrc, "bin", "1.2.3", "lib.so"), []byte("lib"), 0644))
+		require.NoError(t, CopyFolderWithOptions(testLog, fs, osSrc, osDst, CopyOptions{Incremental: true}))
+		require.NoError(t, os.Symlink("1.2.3", filepath.Join(osDst, "bin", "current")))
+
+		err := CopyFolderWithOptions(testLog, fs, osSrc, osDst, CopyOptions{Incremental: true})
+		require.NoError(t, err)
+
+		linkTarget, err := os.Readlink(filepath.Join(osDst, "bin", "current"))
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3", linkTarget)
+	})
+}
@@ -0,0 +1,216 @@
+package fs
+
+import (
+	"crypto/md5" //nolint:gosec // the manifest.json of the CodeModule only provides md5 checksums
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+)
+
+const storeTmpPrefix = ".tmp-"
+
+// StoreFile copies the file into the content-addressable store (as store/<sha256 of the content>), in case the content is not stored yet, and hardlinks it to the destinationPath.
+// Hardlinked files share their mode, so in case the stored content has a different mode than the source, the file is copied instead.
+// The store must be on the same filesystem as the destinationPath.
+func StoreFile(fs afero.Fs, store, sourcePath, destinationPath string) error {
+	return storeFile(fs, store, sourcePath, destinationPath, nil)
+}
+
+// storeFile is the same as StoreFile, but the source is read through the Throttle, both to checksum it and to write it into the store.
+func storeFile(fs afero.Fs, store, sourcePath, destinationPath string, throttle *Throttle) error {
+	if !isOsFs(fs) {
+		return errors.WithStack(ErrLinkNotSupported)
+	}
+
+	sourceInfo, err := fs.Stat(sourcePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	sum, err := sha256File(fs, sourcePath, throttle)
+	if err != nil {
+		return err
+	}
+
+	isLinked, err := linkFromStore(fs, filepath.Join(store, sum), destinationPath, sourceInfo.Mode())
+	if err != nil || isLinked {
+		return err
+	}
+
+	sourceFile, err := fs.Open(sourcePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer func() { _ = sourceFile.Close() }()
+
+	_, err = WriteFileToStore(fs, store, throttle.Reader(sourceFile), destinationPath, sourceInfo.Mode(), "")
+
+	return err
+}
+
+// WriteFileToStore writes the content of the reader into the store the same way as StoreFile, and in case the expectedMD5 is set, verifies its checksum.
+// The content is written to a tmp file in the store first, which is discarded in case the content is already stored.
+// Returns the md5 checksum of the content.
+func WriteFileToStore(fs afero.Fs, store string, source io.Reader, destinationPath string, mode os.FileMode, expectedMD5 string) (string, error) {
+	if !isOsFs(fs) {
+		return "", errors.WithStack(ErrLinkNotSupported)
+	}
+
+	err := fs.MkdirAll(store, os.ModePerm)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	tmpFile, err := afero.TempFile(fs, store, storeTmpPrefix+"*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	tmpPath := tmpFile.Name()
+	_ = tmpFile.Close()
+
+	// does nothing in case the tmp file was moved into the store
+	defer func() { _ = fs.Remove(tmpPath) }()
+
+	md5Hasher := md5.New() //nolint:gosec // the manifest.json of the CodeModule only provides md5 checksums
+	sha256Hasher := sha256.New()
+
+	err = writeFile(fs, io.TeeReader(source, md5Hasher), tmpPath, mode, sha256Hasher)
+	if err != nil {
+		return "", err
+	}
+
+	if expectedMD5 != "" {
+		err = checkMD5(destinationPath, expectedMD5, md5Hasher)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// the tmp file was created with a restricted mode, which is not changed by writing to it
+	err = fs.Chmod(tmpPath, mode)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	storePath := filepath.Join(store, hex.EncodeToString(sha256Hasher.Sum(nil)))
+
+	isLinked, err := linkFromStore(fs, storePath, destinationPath, mode)
+	if err != nil {
+		return "", err
+	}
+
+	if !isLinked {
+		err = moveIntoStore(fs, tmpPath, storePath, destinationPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(md5Hasher.Sum(nil)), nil
+}
+
+// PruneStore removes the content of the store that is not linked anymore, for example because the versions that used it were removed.
+func PruneStore(log logr.Logger, fs afero.Fs, store string) error {
+	infos, err := afero.ReadDir(fs, store)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+
+	removed := 0
+
+	for _, info := range infos {
+		// tmp files could belong to a copy that is still running
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), storeTmpPrefix) {
+			continue
+		}
+
+		links, ok := linkCountFromInfo(info)
+		if !ok || links > 1 {
+			continue
+		}
+
+		err = fs.Remove(filepath.Join(store, info.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+
+		removed++
+	}
+
+	log.Info("pruned the store", "store", store, "removed", removed)
+
+	return nil
+}
+
+// linkFromStore hardlinks the stored content to the destinationPath, returns false in case the content is not stored (with the same mode).
+func linkFromStore(fs afero.Fs, storePath, destinationPath string, mode os.FileMode) (bool, error) {
+	storeInfo, err := fs.Stat(storePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if storeInfo.Mode().Perm() != mode.Perm() {
+		return false, nil
+	}
+
+	err = HardlinkFile(fs, storePath, destinationPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// pruned in the meantime
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// moveIntoStore moves the tmp file into the store and hardlinks it, in case the content is already stored with another mode, the tmp file is moved to the destinationPath instead.
+func moveIntoStore(fs afero.Fs, tmpPath, storePath, destinationPath string) error {
+	exists, err := afero.Exists(fs, storePath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if exists {
+		return errors.WithStack(fs.Rename(tmpPath, destinationPath))
+	}
+
+	// linked first, so PruneStore (of another bootstrapper) never sees the stored content without a link
+	err = HardlinkFile(fs, tmpPath, destinationPath)
+	if err != nil {
+		return err
+	}
+
+	return errors.WithStack(fs.Rename(tmpPath, storePath))
+}
+
+func sha256File(fs afero.Fs, path string, throttle *Throttle) (string, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	hasher := sha256.New()
+
+	_, err = io.Copy(hasher, throttle.Reader(file))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
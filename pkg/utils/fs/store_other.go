@@ -0,0 +1,11 @@
+//go:build !unix
+
+package fs
+
+import (
+	"os"
+)
+
+func linkCountFromInfo(_ os.FileInfo) (uint64, bool) {
+	return 0, false
+}
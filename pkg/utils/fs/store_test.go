@@ -0,0 +1,138 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreFile(t *testing.T) {
+	t.Run("same content in multiple versions -> stored once, hardlinked", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		dir := t.TempDir()
+		store := filepath.Join(dir, "store")
+
+		for _, version := range []string{"1.2.3", "1.2.4"} {
+			source := filepath.Join(dir, "source", version, "lib.so")
+			require.NoError(t, os.MkdirAll(filepath.Dir(source), 0755))
+			require.NoError(t, os.WriteFile(source, []byte("same content"), 0755))
+
+			target := filepath.Join(dir, version, "lib.so")
+			require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+
+			err := StoreFile(fs, store, source, target)
+			require.NoError(t, err)
+		}
+
+		stored := storedFiles(t, store)
+		require.Len(t, stored, 1)
+
+		assertSameFile(t, stored[0], filepath.Join(dir, "1.2.3", "lib.so"))
+		assertSameFile(t, stored[0], filepath.Join(dir, "1.2.4", "lib.so"))
+
+		info, err := os.Stat(stored[0])
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	})
+	t.Run("same content with another mode -> copied", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		dir := t.TempDir()
+		store := filepath.Join(dir, "store")
+
+		executable := filepath.Join(dir, "executable")
+		require.NoError(t, os.WriteFile(executable, []byte("same content"), 0755))
+		require.NoError(t, StoreFile(fs, store, executable, filepath.Join(dir, "linked")))
+
+		readonly := filepath.Join(dir, "readonly")
+		require.NoError(t, os.WriteFile(readonly, []byte("same content"), 0444))
+		require.NoError(t, StoreFile(fs, store, readonly, filepath.Join(dir, "copied")))
+
+		stored := storedFiles(t, store)
+		require.Len(t, stored, 1)
+		assertSameFile(t, stored[0], filepath.Join(dir, "linked"))
+
+		storedInfo, err := os.Stat(stored[0])
+		require.NoError(t, err)
+
+		copiedInfo, err := os.Stat(filepath.Join(dir, "copied"))
+		require.NoError(t, err)
+		assert.False(t, os.SameFile(storedInfo, copiedInfo))
+		assert.Equal(t, os.FileMode(0444), copiedInfo.Mode().Perm())
+	})
+	t.Run("memory fs -> not supported", func(t *testing.T) {
+		err := StoreFile(afero.NewMemMapFs(), "/store", "/source", "/target")
+		require.ErrorIs(t, err, ErrLinkNotSupported)
+	})
+}
+
+func TestWriteFileToStore(t *testing.T) {
+	t.Run("checksum mismatch -> error, nothing stored", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		dir := t.TempDir()
+		store := filepath.Join(dir, "store")
+		target := filepath.Join(dir, "target")
+
+		_, err := WriteFileToStore(fs, store, strings.NewReader("content"), target, 0644, "00000000000000000000000000000000")
+		require.Error(t, err)
+
+		assert.Empty(t, storedFiles(t, store))
+
+		_, err = os.Stat(target)
+		assert.True(t, os.IsNotExist(err))
+	})
+	t.Run("checksum match -> stored and linked", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		dir := t.TempDir()
+		store := filepath.Join(dir, "store")
+		target := filepath.Join(dir, "target")
+
+		checksum, err := WriteFileToStore(fs, store, strings.NewReader("content"), target, 0644, "9a0364b9e99bb480dd25e1f0284c8555")
+		require.NoError(t, err)
+		assert.Equal(t, "9a0364b9e99bb480dd25e1f0284c8555", checksum)
+
+		stored := storedFiles(t, store)
+		require.Len(t, stored, 1)
+		assertSameFile(t, stored[0], target)
+	})
+}
+
+func TestPruneStore(t *testing.T) {
+	fs := afero.NewOsFs()
+	dir := t.TempDir()
+	store := filepath.Join(dir, "store")
+
+	_, err := WriteFileToStore(fs, store, strings.NewReader("used"), filepath.Join(dir, "used"), 0644, "")
+	require.NoError(t, err)
+
+	_, err = WriteFileToStore(fs, store, strings.NewReader("unused"), filepath.Join(dir, "unused"), 0644, "")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, "unused")))
+
+	err = PruneStore(testLog, fs, store)
+	require.NoError(t, err)
+
+	stored := storedFiles(t, store)
+	require.Len(t, stored, 1)
+	assertSameFile(t, stored[0], filepath.Join(dir, "used"))
+
+	require.NoError(t, PruneStore(testLog, fs, filepath.Join(dir, "missing")))
+}
+
+func storedFiles(t *testing.T, store string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(store)
+	require.NoError(t, err)
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, filepath.Join(store, entry.Name()))
+	}
+
+	return files
+}
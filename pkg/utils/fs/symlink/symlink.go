@@ -1,12 +1,31 @@
 package symlink
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
 )
 
-func Create(log logr.Logger, fs afero.Fs, targetDir, symlinkDir string) error {
+const (
+	tmpSuffix         = ".tmp"
+	tmpRandomBytes    = 8
+	maxTmpNameRetries = 10
+
+	// staleTmpAge is how old a tmp symlink has to be, to be considered a leftover of a killed process instead of one that is about to be renamed.
+	staleTmpAge = time.Minute
+)
+
+// Replace creates the symlink, or replaces an already existing one, the new symlink is created under a unique tmp name next to the symlinkPath and then renamed to it.
+// This way the symlinkPath always exists, pointing either to the old or to the new target, even in case the process is killed in between.
+// The tmp name is unique (the same way as os.CreateTemp), so concurrent processes replacing the same symlink don't get into each other's way.
+func Replace(log logr.Logger, fs afero.Fs, targetDir, symlinkPath string) error {
 	// MemMapFs (used for testing) doesn't comply with the Linker interface
 	linker, ok := fs.(afero.Linker)
 	if !ok {
@@ -15,20 +34,84 @@ func Create(log logr.Logger, fs afero.Fs, targetDir, symlinkDir string) error {
 		return nil
 	}
 
-	// Check if the symlink already exists
-	if fileInfo, _ := fs.Stat(symlinkDir); fileInfo != nil {
-		log.Info("symlink already exists", "location", symlinkDir)
+	removeStaleTmps(log, fs, symlinkPath)
 
-		return nil
-	}
+	log.Info("replacing symlink", "points-to(relative)", targetDir, "location", symlinkPath)
 
-	log.Info("creating symlink", "points-to(relative)", targetDir, "location", symlinkDir)
-
-	if err := linker.SymlinkIfPossible(targetDir, symlinkDir); err != nil {
+	tmpPath, err := symlinkTmp(linker, targetDir, symlinkPath)
+	if err != nil {
 		log.Info("symlinking failed", "source", targetDir)
 
+		return err
+	}
+
+	if err := fs.Rename(tmpPath, symlinkPath); err != nil {
+		_ = fs.Remove(tmpPath)
+
 		return errors.WithStack(err)
 	}
 
 	return nil
 }
+
+// symlinkTmp creates the symlink under a unique tmp name next to the symlinkPath, a name that is already taken is retried with another one.
+func symlinkTmp(linker afero.Linker, targetDir, symlinkPath string) (string, error) {
+	for range maxTmpNameRetries {
+		suffix := make([]byte, tmpRandomBytes)
+
+		_, err := rand.Read(suffix)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		tmpPath := filepath.Join(filepath.Dir(symlinkPath), "."+filepath.Base(symlinkPath)+"."+hex.EncodeToString(suffix)+tmpSuffix)
+
+		err = linker.SymlinkIfPossible(targetDir, tmpPath)
+		if err == nil {
+			return tmpPath, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return "", errors.WithStack(err)
+		}
+	}
+
+	return "", errors.Errorf("failed to find a unique tmp name for the symlink %s", symlinkPath)
+}
+
+// removeStaleTmps removes the tmp symlinks of previous runs, that were killed before they could rename them.
+// Only the ones older than staleTmpAge are removed, so the tmp symlink of a concurrent process stays untouched.
+func removeStaleTmps(log logr.Logger, fs afero.Fs, symlinkPath string) {
+	dir := filepath.Dir(symlinkPath)
+	prefix := "." + filepath.Base(symlinkPath)
+
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, tmpSuffix) || time.Since(entry.ModTime()) < staleTmpAge {
+			continue
+		}
+
+		// the tmp name is either the fixed one of older releases, or one with a random part
+		if middle := strings.TrimSuffix(strings.TrimPrefix(name, prefix), tmpSuffix); middle != "" && !isRandomPart(middle) {
+			continue
+		}
+
+		if err := fs.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			log.Info("failed to remove a leftover tmp symlink", "path", filepath.Join(dir, name))
+		}
+	}
+}
+
+func isRandomPart(middle string) bool {
+	random, ok := strings.CutPrefix(middle, ".")
+	if !ok || len(random) != hex.EncodedLen(tmpRandomBytes) {
+		return false
+	}
+
+	_, err := hex.DecodeString(random)
+
+	return err == nil
+}
@@ -0,0 +1,103 @@
+package fs
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Throttle counts the bytes read through its readers, and in case of a limit, paces them so their combined throughput stays below it.
+// It is shared by the concurrently copied files, so the limit applies to the whole copy. A nil Throttle neither counts nor limits.
+type Throttle struct {
+	start time.Time
+	// next is the point in time when the already read bytes are within the limit.
+	next           time.Time
+	bytesPerSecond int64
+	bytes          int64
+	mutex          sync.Mutex
+}
+
+// NewThrottle creates a Throttle with the given limit, anything below 1 means unlimited (only counting).
+func NewThrottle(bytesPerSecond int64) *Throttle {
+	now := time.Now()
+
+	return &Throttle{
+		start:          now,
+		next:           now,
+		bytesPerSecond: bytesPerSecond,
+	}
+}
+
+// Reader wraps the reader, so what is read through it counts towards the Throttle.
+func (t *Throttle) Reader(reader io.Reader) io.Reader {
+	if t == nil {
+		return reader
+	}
+
+	return &throttledReader{reader: reader, throttle: t}
+}
+
+// Bytes returns the number of bytes read so far.
+func (t *Throttle) Bytes() int64 {
+	if t == nil {
+		return 0
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.bytes
+}
+
+// BytesPerSecond returns the effective throughput since the Throttle was created.
+func (t *Throttle) BytesPerSecond() float64 {
+	if t == nil {
+		return 0
+	}
+
+	elapsed := time.Since(t.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(t.Bytes()) / elapsed
+}
+
+// wait counts the read bytes and sleeps until they are within the limit.
+func (t *Throttle) wait(bytes int) {
+	t.mutex.Lock()
+
+	t.bytes += int64(bytes)
+
+	if t.bytesPerSecond < 1 {
+		t.mutex.Unlock()
+
+		return
+	}
+
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+
+	t.next = t.next.Add(time.Duration(int64(bytes) * int64(time.Second) / t.bytesPerSecond))
+	delay := t.next.Sub(now)
+
+	t.mutex.Unlock()
+
+	time.Sleep(delay)
+}
+
+type throttledReader struct {
+	reader   io.Reader
+	throttle *Throttle
+}
+
+func (r *throttledReader) Read(buffer []byte) (int, error) {
+	n, err := r.reader.Read(buffer)
+	if n > 0 {
+		r.throttle.wait(n)
+	}
+
+	return n, err
+}
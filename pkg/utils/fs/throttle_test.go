@@ -0,0 +1,80 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Run("nil throttle -> reader unchanged", func(t *testing.T) {
+		var throttle *Throttle
+
+		reader := strings.NewReader("content")
+
+		assert.Same(t, reader, throttle.Reader(reader))
+		assert.Zero(t, throttle.Bytes())
+		assert.Zero(t, throttle.BytesPerSecond())
+	})
+	t.Run("unlimited -> only counts", func(t *testing.T) {
+		throttle := NewThrottle(0)
+
+		content, err := io.ReadAll(throttle.Reader(strings.NewReader("content")))
+		require.NoError(t, err)
+
+		assert.Equal(t, "content", string(content))
+		assert.Equal(t, int64(len("content")), throttle.Bytes())
+	})
+	t.Run("limited -> paced", func(t *testing.T) {
+		bytesPerSecond := int64(1000)
+		throttle := NewThrottle(bytesPerSecond)
+		start := time.Now()
+
+		_, err := io.Copy(io.Discard, throttle.Reader(bytes.NewReader(make([]byte, 200))))
+		require.NoError(t, err)
+
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+		assert.Equal(t, int64(200), throttle.Bytes())
+		assert.LessOrEqual(t, throttle.BytesPerSecond(), float64(bytesPerSecond))
+	})
+	t.Run("copy files -> bytes of every file counted", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/src/a", []byte("aaa"), 0644))
+		require.NoError(t, afero.WriteFile(fs, "/src/b", []byte("bbbbb"), 0644))
+
+		throttle := NewThrottle(0)
+		files := []FileCopy{{From: "/src/a", To: "/dst/a"}, {From: "/src/b", To: "/dst/b"}}
+
+		err := CopyFiles(testLog, fs, files, CopyOptions{Concurrency: 2, Throttle: throttle})
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(8), throttle.Bytes())
+
+		content, err := afero.ReadFile(fs, "/dst/b")
+		require.NoError(t, err)
+		assert.Equal(t, "bbbbb", string(content))
+	})
+	t.Run("store -> read through the throttle", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		dir := t.TempDir()
+		require.NoError(t, fs.MkdirAll(filepath.Join(dir, "src"), 0755))
+		require.NoError(t, afero.WriteFile(fs, filepath.Join(dir, "src", "a"), []byte("aaa"), 0644))
+		require.NoError(t, fs.MkdirAll(filepath.Join(dir, "dst"), 0755))
+
+		throttle := NewThrottle(0)
+		files := []FileCopy{{From: filepath.Join(dir, "src", "a"), To: filepath.Join(dir, "dst", "a")}}
+
+		err := CopyFiles(testLog, fs, files, CopyOptions{Store: filepath.Join(dir, "store"), Throttle: throttle})
+		require.NoError(t, err)
+
+		// once for the checksum, once to write it into the store
+		assert.Equal(t, int64(6), throttle.Bytes())
+	})
+}